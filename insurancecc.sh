@@ -2,6 +2,9 @@
 
 export FABRIC_CFG_PATH=$PWD/../config/
 
+# The contract uses the shared module in ../common, which has to be vendored to be packaged
+(cd ./mychaincode/insurancecontract && go mod vendor)
+
 peer lifecycle chaincode package insurancecc.tar.gz --path ./mychaincode/insurancecontract/ --lang golang --label insurancecc_1.0
 
 export CORE_PEER_TLS_ENABLED=true
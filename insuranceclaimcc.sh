@@ -2,6 +2,9 @@
 
 export FABRIC_CFG_PATH=$PWD/../config/
 
+# The contract uses the shared module in ../common, which has to be vendored to be packaged
+(cd ./mychaincode/insuranceclaimcontract && go mod vendor)
+
 peer lifecycle chaincode package insuranceclaimcc.tar.gz --path ./mychaincode/insuranceclaimcontract/ --lang golang --label insuranceclaimcc_1.0
 
 export CORE_PEER_TLS_ENABLED=true
@@ -16,13 +16,13 @@ import cors from 'cors';
 
 const channelName = envOrDefault('CHANNEL_NAME', 'mychannel');
 const chaincodeName = envOrDefault('CHAINCODE_NAME', 'insurancecc');
-const mspId = envOrDefault('MSP_ID', 'Org3MSP');
-const cryptoPath = envOrDefault('CRYPTO_PATH', path.resolve(__dirname, '..', '..', '..', 'organizations', 'peerOrganizations', 'org3.example.com'));
-const keyDirectoryPath = envOrDefault('KEY_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@org3.example.com', 'msp', 'keystore'));
-const certDirectoryPath = envOrDefault('CERT_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@org3.example.com', 'msp', 'signcerts'));
-const tlsCertPath = envOrDefault('TLS_CERT_PATH', path.resolve(cryptoPath, 'peers', 'peer0.org3.example.com', 'tls', 'ca.crt'));
-const peerEndpoint = envOrDefault('PEER_ENDPOINT', 'localhost:11051');
-const peerHostAlias = envOrDefault('PEER_HOST_ALIAS', 'peer0.org3.example.com');
+const mspId = envOrDefault('MSP_ID', 'InsuranceMSP');
+const cryptoPath = envOrDefault('CRYPTO_PATH', path.resolve(__dirname, '..', '..', '..', 'crypto-config', 'peerOrganizations', 'insurance.example.com'));
+const keyDirectoryPath = envOrDefault('KEY_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@insurance.example.com', 'msp', 'keystore'));
+const certDirectoryPath = envOrDefault('CERT_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@insurance.example.com', 'msp', 'signcerts'));
+const tlsCertPath = envOrDefault('TLS_CERT_PATH', path.resolve(cryptoPath, 'peers', 'peer0.insurance.example.com', 'tls', 'ca.crt'));
+const peerEndpoint = envOrDefault('PEER_ENDPOINT', 'localhost:9051');
+const peerHostAlias = envOrDefault('PEER_HOST_ALIAS', 'peer0.insurance.example.com');
 
 const utf8Decoder = new TextDecoder();
 const app = express();
@@ -78,9 +78,10 @@ async function createInsurance(contract: Contract, insuranceDetails: any): Promi
         insuranceDetails.insuranceNumber,
         insuranceDetails.name,
         insuranceDetails.aadharNumber,
+        insuranceDetails.dob,
         insuranceDetails.startDate,
         insuranceDetails.endDate,
-        insuranceDetails.age.toString(),
+        (insuranceDetails.age ?? 0).toString(),
         insuranceDetails.claimLimit.toString(),
         insuranceDetails.alreadyClaimed.toString()
     );
@@ -97,16 +98,19 @@ async function updateInsurance(contract: Contract, insuranceDetails: any): Promi
         insuranceDetails.insuranceNumber,
         insuranceDetails.name,
         insuranceDetails.aadharNumber,
+        insuranceDetails.dob,
         insuranceDetails.startDate,
         insuranceDetails.endDate,
-        insuranceDetails.age.toString(),
+        (insuranceDetails.age ?? 0).toString(),
         insuranceDetails.claimLimit.toString(),
-        insuranceDetails.alreadyClaimed.toString()
+        // expectedVersion: the version of the policy the edit form was filled from. The
+        // claimed amount is not sent; only approved claims change it.
+        insuranceDetails.version.toString()
     );
 }
 
-async function deleteInsurance(contract: Contract, insuranceNumber: string): Promise<void> {
-    await contract.submitTransaction('DeleteInsurance', insuranceNumber);
+async function deleteInsurance(contract: Contract, insuranceNumber: string, reason: string): Promise<void> {
+    await contract.submitTransaction('DeleteInsurance', insuranceNumber, reason);
 }
 
 async function getAllInsurances(contract: Contract): Promise<any> {
@@ -114,6 +118,27 @@ async function getAllInsurances(contract: Contract): Promise<any> {
     return JSON.parse(utf8Decoder.decode(resultBytes));
 }
 
+// Insurance Claim Contract Functions. Only the insurer (or the TPA) may update a claim,
+// and only the insurer may delete one, so these are served here rather than by the
+// hospital's claim backend.
+async function updateClaim(claimContract: Contract, claimDetails: any): Promise<void> {
+    await claimContract.submitTransaction(
+        'UpdateClaim',
+        claimDetails.claimID,
+        claimDetails.treatmentID,
+        claimDetails.patientID,
+        claimDetails.aadharNumber,
+        claimDetails.insuranceNumber,
+        claimDetails.status,
+        // expectedVersion: the claim as the client last read it, or 0 to skip the check
+        (claimDetails.version ?? 0).toString()
+    );
+}
+
+async function deleteClaim(claimContract: Contract, claimID: string, reason: string): Promise<void> {
+    await claimContract.submitTransaction('DeleteClaim', claimID, reason);
+}
+
 // Express Routes
 app.post('/insurances', async (req: Request, res: Response) => {
     try {
@@ -142,6 +167,11 @@ app.get('/insurances/:id', async (req: Request, res: Response) => {
 });
 
 app.put('/insurances/:id', async (req: Request, res: Response) => {
+    // Without the version the edit started from, an update could undo a claim debit
+    if (!Number.isInteger(req.body?.version) || req.body.version < 1) {
+        res.status(400).send('Error updating insurance: the version of the policy being edited is required');
+        return;
+    }
     try {
         const gateway = await getGatewayClient();
         const network = gateway.getNetwork(channelName);
@@ -154,8 +184,23 @@ app.put('/insurances/:id', async (req: Request, res: Response) => {
     }
 });
 
-// Update the claim status of an insurance
-app.put('/claims/:id', async (req: Request, res: Response) => {
+// The claim lifecycle transactions of the insurance claim chaincode, by route action
+const claimTransitions: Record<string, string> = {
+    review: 'ReviewClaim',
+    query: 'RaiseQuery',
+    approve: 'ApproveClaim',
+    reject: 'RejectClaim',
+    settle: 'SettleClaim',
+    close: 'CloseClaim',
+};
+
+// Move a claim along its lifecycle, e.g. POST /claims/CLAIM1/approve
+app.post('/claims/:id/:action', async (req: Request, res: Response) => {
+    const transaction = claimTransitions[req.params.action];
+    if (!transaction) {
+        res.status(404).send(`Unknown claim action: ${req.params.action}`);
+        return;
+    }
     try {
         const gateway = await getGatewayClient();
         const network = gateway.getNetwork(channelName);
@@ -163,20 +208,7 @@ app.put('/claims/:id', async (req: Request, res: Response) => {
         // Switch to insurance claim chaincode
         const insuranceClaimContract = network.getContract('insuranceclaimcc');
 
-        const claim = await insuranceClaimContract.evaluateTransaction('ReadClaim', req.params.id);
-        const claimData = JSON.parse(utf8Decoder.decode(claim));
-
-        // Update the claim status
-        claimData.status = req.body.status;
-        await insuranceClaimContract.submitTransaction(
-            'UpdateClaim',
-            claimData.claimId,
-            claimData.treatmentId,
-            claimData.patientId,
-            claimData.aadharNumber,
-            claimData.insuranceNumber,
-            claimData.status,
-        );
+        await insuranceClaimContract.submitTransaction(transaction, req.params.id);
         
         res.status(200).send('Claim Status updated successfully');
     } catch (error) {
@@ -184,13 +216,39 @@ app.put('/claims/:id', async (req: Request, res: Response) => {
     }
 });
 
+app.put('/claims/:id', async (req: Request, res: Response) => {
+    try {
+        const gateway = await getGatewayClient();
+        const network = gateway.getNetwork(channelName);
+        const insuranceClaimContract = network.getContract('insuranceclaimcc');
+        
+        await updateClaim(insuranceClaimContract, { claimID: req.params.id, ...req.body });
+        res.status(200).send('Claim updated successfully');
+    } catch (error) {
+        res.status(500).send(`Error updating claim: ${error instanceof Error ? error.message : 'Unknown error'}`);
+    }
+});
+
+app.delete('/claims/:id', async (req: Request, res: Response) => {
+    try {
+        const gateway = await getGatewayClient();
+        const network = gateway.getNetwork(channelName);
+        const insuranceClaimContract = network.getContract('insuranceclaimcc');
+        
+        await deleteClaim(insuranceClaimContract, req.params.id, String(req.query.reason ?? req.body?.reason ?? ''));
+        res.status(200).send('Claim deleted successfully');
+    } catch (error) {
+        res.status(500).send(`Error deleting claim: ${error instanceof Error ? error.message : 'Unknown error'}`);
+    }
+});
+
 app.delete('/insurances/:id', async (req: Request, res: Response) => {
     try {
         const gateway = await getGatewayClient();
         const network = gateway.getNetwork(channelName);
         const contract = network.getContract(chaincodeName);
         
-        await deleteInsurance(contract, req.params.id);
+        await deleteInsurance(contract, req.params.id, String(req.query.reason ?? req.body?.reason ?? ''));
         res.status(200).send('Insurance deleted successfully');
     } catch (error) {
         res.status(500).send(`Error deleting insurance: ${error instanceof Error ? error.message : 'Unknown error'}`);
@@ -16,13 +16,13 @@ import cors from 'cors';
 
 const channelName = envOrDefault('CHANNEL_NAME', 'mychannel');
 const chaincodeName = envOrDefault('CHAINCODE_NAME', 'insuranceclaimcc');
-const mspId = envOrDefault('MSP_ID', 'Org2MSP');
-const cryptoPath = envOrDefault('CRYPTO_PATH', path.resolve(__dirname, '..', '..', '..', 'organizations', 'peerOrganizations', 'org2.example.com'));
-const keyDirectoryPath = envOrDefault('KEY_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@org2.example.com', 'msp', 'keystore'));
-const certDirectoryPath = envOrDefault('CERT_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@org2.example.com', 'msp', 'signcerts'));
-const tlsCertPath = envOrDefault('TLS_CERT_PATH', path.resolve(cryptoPath, 'peers', 'peer0.org2.example.com', 'tls', 'ca.crt'));
-const peerEndpoint = envOrDefault('PEER_ENDPOINT', 'localhost:9051');
-const peerHostAlias = envOrDefault('PEER_HOST_ALIAS', 'peer0.org2.example.com');
+const mspId = envOrDefault('MSP_ID', 'HealthcareMSP');
+const cryptoPath = envOrDefault('CRYPTO_PATH', path.resolve(__dirname, '..', '..', '..', 'crypto-config', 'peerOrganizations', 'healthcare.example.com'));
+const keyDirectoryPath = envOrDefault('KEY_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@healthcare.example.com', 'msp', 'keystore'));
+const certDirectoryPath = envOrDefault('CERT_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@healthcare.example.com', 'msp', 'signcerts'));
+const tlsCertPath = envOrDefault('TLS_CERT_PATH', path.resolve(cryptoPath, 'peers', 'peer0.healthcare.example.com', 'tls', 'ca.crt'));
+const peerEndpoint = envOrDefault('PEER_ENDPOINT', 'localhost:7051');
+const peerHostAlias = envOrDefault('PEER_HOST_ALIAS', 'peer0.healthcare.example.com');
 
 const utf8Decoder = new TextDecoder();
 const app = express();
@@ -79,8 +79,7 @@ async function createClaim(contract: Contract, claimDetails: any): Promise<void>
         claimDetails.treatmentID,
         claimDetails.patientID,
         claimDetails.aadharNumber,
-        claimDetails.insuranceNumber,
-        claimDetails.status
+        claimDetails.insuranceNumber
     );
 }
 
@@ -89,22 +88,6 @@ async function readClaim(contract: Contract, claimID: string): Promise<any> {
     return JSON.parse(utf8Decoder.decode(resultBytes));
 }
 
-async function updateClaim(contract: Contract, claimDetails: any): Promise<void> {
-    await contract.submitTransaction(
-        'UpdateClaim',
-        claimDetails.claimID,
-        claimDetails.treatmentID,
-        claimDetails.patientID,
-        claimDetails.aadharNumber,
-        claimDetails.insuranceNumber,
-        claimDetails.status
-    );
-}
-
-async function deleteClaim(contract: Contract, claimID: string): Promise<void> {
-    await contract.submitTransaction('DeleteClaim', claimID);
-}
-
 async function getAllClaims(contract: Contract): Promise<any> {
     const resultBytes = await contract.evaluateTransaction('GetAllClaims');
     return JSON.parse(utf8Decoder.decode(resultBytes));
@@ -137,32 +120,6 @@ app.get('/claims/:id', async (req: Request, res: Response) => {
     }
 });
 
-app.put('/claims/:id', async (req: Request, res: Response) => {
-    try {
-        const gateway = await getGatewayClient();
-        const network = gateway.getNetwork(channelName);
-        const contract = network.getContract(chaincodeName);
-        
-        await updateClaim(contract, { claimID: req.params.id, ...req.body });
-        res.status(200).send('Claim updated successfully');
-    } catch (error) {
-        res.status(500).send(`Error updating claim: ${error instanceof Error ? error.message : 'Unknown error'}`);
-    }
-});
-
-app.delete('/claims/:id', async (req: Request, res: Response) => {
-    try {
-        const gateway = await getGatewayClient();
-        const network = gateway.getNetwork(channelName);
-        const contract = network.getContract(chaincodeName);
-        
-        await deleteClaim(contract, req.params.id);
-        res.status(200).send('Claim deleted successfully');
-    } catch (error) {
-        res.status(500).send(`Error deleting claim: ${error instanceof Error ? error.message : 'Unknown error'}`);
-    }
-});
-
 app.get('/claims', async (req: Request, res: Response) => {
     try {
         const gateway = await getGatewayClient();
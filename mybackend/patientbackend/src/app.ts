@@ -18,25 +18,25 @@ import cors from 'cors';
 
 const channelName = envOrDefault('CHANNEL_NAME', 'mychannel');
 const chaincodeName = envOrDefault('CHAINCODE_NAME', 'patientcc');
-const mspId = envOrDefault('MSP_ID', 'Org1MSP');
+const mspId = envOrDefault('MSP_ID', 'HealthcareMSP');
 
 // Path to crypto materials.
-const cryptoPath = envOrDefault('CRYPTO_PATH', path.resolve(__dirname, '..', '..', '..', 'organizations', 'peerOrganizations', 'org1.example.com'));
+const cryptoPath = envOrDefault('CRYPTO_PATH', path.resolve(__dirname, '..', '..', '..', 'crypto-config', 'peerOrganizations', 'healthcare.example.com'));
 
 // Path to user private key directory.
-const keyDirectoryPath = envOrDefault('KEY_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@org1.example.com', 'msp', 'keystore'));
+const keyDirectoryPath = envOrDefault('KEY_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@healthcare.example.com', 'msp', 'keystore'));
 
 // Path to user certificate directory.
-const certDirectoryPath = envOrDefault('CERT_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@org1.example.com', 'msp', 'signcerts'));
+const certDirectoryPath = envOrDefault('CERT_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@healthcare.example.com', 'msp', 'signcerts'));
 
 // Path to peer tls certificate.
-const tlsCertPath = envOrDefault('TLS_CERT_PATH', path.resolve(cryptoPath, 'peers', 'peer0.org1.example.com', 'tls', 'ca.crt'));
+const tlsCertPath = envOrDefault('TLS_CERT_PATH', path.resolve(cryptoPath, 'peers', 'peer0.healthcare.example.com', 'tls', 'ca.crt'));
 
 // Gateway peer endpoint.
 const peerEndpoint = envOrDefault('PEER_ENDPOINT', 'localhost:7051');
 
 // Gateway peer SSL host name override.
-const peerHostAlias = envOrDefault('PEER_HOST_ALIAS', 'peer0.org1.example.com');
+const peerHostAlias = envOrDefault('PEER_HOST_ALIAS', 'peer0.healthcare.example.com');
 
 const utf8Decoder = new TextDecoder();
 // const assetId = `asset${String(Date.now())}`;
@@ -168,28 +168,35 @@ async function initLedger(contract: Contract): Promise<void> {
     console.log('*** Transaction committed successfully');
 }
 
+// Patient details are private, so they are sent as transient data rather than as arguments
+function patientTransientData(patientDetails: any): string {
+    return JSON.stringify({
+        name: patientDetails.name,
+        age: Number(patientDetails.age),
+        gender: patientDetails.gender,
+        bloodType: patientDetails.bloodType,
+        height: Number(patientDetails.height),
+        weight: Number(patientDetails.weight),
+        address: patientDetails.address,
+        dob: patientDetails.dob,
+        aadharNumber: patientDetails.aadharNumber,
+        insuranceNumber: patientDetails.insuranceNumber,
+        phoneNumber: patientDetails.phoneNumber,
+        emailID: patientDetails.emailID,
+        smokerStatus: patientDetails.smokerStatus,
+    });
+}
+
 async function updatePatient(contract: Contract, patientDetails: any): Promise<void> {
-    await contract.submitTransaction(
-        'UpdatePatient',
-        patientDetails.patientID,
-        patientDetails.name,
-        patientDetails.age.toString(),
-        patientDetails.gender,
-        patientDetails.bloodType,
-        patientDetails.height.toString(),
-        patientDetails.weight.toString(),
-        patientDetails.address,
-        patientDetails.dob,
-        patientDetails.aadharNumber,
-        patientDetails.insuranceNumber,
-        patientDetails.phoneNumber,
-        patientDetails.emailID,
-        patientDetails.smokerStatus,
-    );
+    await contract.submit('UpdatePatient', {
+        // The patient ID, then the version the details were read at, 0 for any
+        arguments: [patientDetails.patientID, (patientDetails.version ?? 0).toString()],
+        transientData: { patient: patientTransientData(patientDetails) },
+    });
 }
 
-async function deletePatient(contract: Contract, patientID: string): Promise<void> {
-    await contract.submitTransaction('DeletePatient', patientID);
+async function deletePatient(contract: Contract, patientID: string, reason: string, cascade: boolean): Promise<void> {
+    await contract.submitTransaction('DeletePatient', patientID, reason, cascade.toString());
 }
 
 async function patientExists(contract: Contract, patientID: string): Promise<boolean> {
@@ -213,23 +220,10 @@ async function getAllPatients(contract: Contract): Promise<void> {
 
 // Create a new patient
 async function createPatient(contract: Contract, patientDetails: any): Promise<void> {
-    await contract.submitTransaction(
-        'CreatePatient',
-        patientDetails.patientID,
-        patientDetails.name,
-        patientDetails.age.toString(),
-        patientDetails.gender,
-        patientDetails.bloodType,
-        patientDetails.height.toString(),
-        patientDetails.weight.toString(),
-        patientDetails.address,
-        patientDetails.dob,
-        patientDetails.aadharNumber,
-        patientDetails.insuranceNumber,
-        patientDetails.phoneNumber,
-        patientDetails.emailID,
-        patientDetails.smokerStatus,
-    );
+    await contract.submit('CreatePatient', {
+        arguments: [patientDetails.patientID],
+        transientData: { patient: patientTransientData(patientDetails) },
+    });
 }
 
 // Read a patient by ID
@@ -324,7 +318,9 @@ app.delete('/patients/:id', async (req: Request, res: Response) => {
         const network = gateway.getNetwork(channelName);
         const contract = network.getContract(chaincodeName);
 
-        await deletePatient(contract, patientID);
+        // cascade=true archives the patient's treatments too instead of refusing
+        const cascade = String(req.query.cascade ?? req.body?.cascade ?? 'false') === 'true';
+        await deletePatient(contract, patientID, String(req.query.reason ?? req.body?.reason ?? ''), cascade);
         res.status(200).send('Patient record deleted successfully');
     } catch (error) {
         res.status(500).send(`Error deleting patient record: ${error instanceof Error ? error.message : 'Unknown error'}`);
@@ -16,13 +16,13 @@ import cors from 'cors';
 
 const channelName = envOrDefault('CHANNEL_NAME', 'mychannel');
 const chaincodeName = envOrDefault('CHAINCODE_NAME', 'treatmentcc'); // Updated chaincode name
-const mspId = envOrDefault('MSP_ID', 'Org1MSP');
-const cryptoPath = envOrDefault('CRYPTO_PATH', path.resolve(__dirname, '..', '..', '..', 'organizations', 'peerOrganizations', 'org1.example.com'));
-const keyDirectoryPath = envOrDefault('KEY_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@org1.example.com', 'msp', 'keystore'));
-const certDirectoryPath = envOrDefault('CERT_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@org1.example.com', 'msp', 'signcerts'));
-const tlsCertPath = envOrDefault('TLS_CERT_PATH', path.resolve(cryptoPath, 'peers', 'peer0.org1.example.com', 'tls', 'ca.crt'));
+const mspId = envOrDefault('MSP_ID', 'HealthcareMSP');
+const cryptoPath = envOrDefault('CRYPTO_PATH', path.resolve(__dirname, '..', '..', '..', 'crypto-config', 'peerOrganizations', 'healthcare.example.com'));
+const keyDirectoryPath = envOrDefault('KEY_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@healthcare.example.com', 'msp', 'keystore'));
+const certDirectoryPath = envOrDefault('CERT_DIRECTORY_PATH', path.resolve(cryptoPath, 'users', 'User1@healthcare.example.com', 'msp', 'signcerts'));
+const tlsCertPath = envOrDefault('TLS_CERT_PATH', path.resolve(cryptoPath, 'peers', 'peer0.healthcare.example.com', 'tls', 'ca.crt'));
 const peerEndpoint = envOrDefault('PEER_ENDPOINT', 'localhost:7051');
-const peerHostAlias = envOrDefault('PEER_HOST_ALIAS', 'peer0.org1.example.com');
+const peerHostAlias = envOrDefault('PEER_HOST_ALIAS', 'peer0.healthcare.example.com');
 
 const utf8Decoder = new TextDecoder();
 const app = express();
@@ -74,21 +74,30 @@ async function newSigner(): Promise<Signer> {
 }
 
 // Treatment-specific functions
+
+// Clinical details are private, so they are sent as transient data rather than as arguments
+function treatmentTransientData(treatmentDetails: any): string {
+    return JSON.stringify({
+        medicalCondition: treatmentDetails.medicalCondition,
+        roomNumber: treatmentDetails.roomNumber,
+        admissionType: treatmentDetails.admissionType,
+        medication: treatmentDetails.medication,
+        doctorName: treatmentDetails.doctorName,
+    });
+}
+
 async function createTreatment(contract: Contract, treatmentDetails: any): Promise<void> {
-    await contract.submitTransaction(
-        'CreateTreatment',
-        treatmentDetails.treatmentID,
-        treatmentDetails.medicalCondition,
-        treatmentDetails.hospitalName,
-        treatmentDetails.roomNumber,
-        treatmentDetails.admissionType,
-        treatmentDetails.medication,
-        treatmentDetails.patientID,
-        treatmentDetails.admissionDate,
-        treatmentDetails.releaseDate,
-        treatmentDetails.billingAmount.toString(),
-        treatmentDetails.doctorName
-    );
+    await contract.submit('CreateTreatment', {
+        arguments: [
+            treatmentDetails.treatmentID,
+            treatmentDetails.hospitalName,
+            treatmentDetails.patientID,
+            treatmentDetails.admissionDate,
+            treatmentDetails.releaseDate,
+            treatmentDetails.billingAmount.toString(),
+        ],
+        transientData: { treatment: treatmentTransientData(treatmentDetails) },
+    });
 }
 
 async function readTreatment(contract: Contract, treatmentID: string): Promise<any> {
@@ -97,24 +106,23 @@ async function readTreatment(contract: Contract, treatmentID: string): Promise<a
 }
 
 async function updateTreatment(contract: Contract, treatmentDetails: any): Promise<void> {
-    await contract.submitTransaction(
-        'UpdateTreatment',
-        treatmentDetails.treatmentID,
-        treatmentDetails.medicalCondition,
-        treatmentDetails.hospitalName,
-        treatmentDetails.roomNumber,
-        treatmentDetails.admissionType,
-        treatmentDetails.medication,
-        treatmentDetails.patientID,
-        treatmentDetails.admissionDate,
-        treatmentDetails.releaseDate,
-        treatmentDetails.billingAmount.toString(),
-        treatmentDetails.doctorName
-    );
+    await contract.submit('UpdateTreatment', {
+        arguments: [
+            treatmentDetails.treatmentID,
+            treatmentDetails.hospitalName,
+            treatmentDetails.patientID,
+            treatmentDetails.admissionDate,
+            treatmentDetails.releaseDate,
+            treatmentDetails.billingAmount.toString(),
+            // expectedVersion: UpdateTreatment fails with CONFLICT if the treatment changed since it was read
+            (treatmentDetails.version ?? 0).toString(),
+        ],
+        transientData: { treatment: treatmentTransientData(treatmentDetails) },
+    });
 }
 
-async function deleteTreatment(contract: Contract, treatmentID: string): Promise<void> {
-    await contract.submitTransaction('DeleteTreatment', treatmentID);
+async function deleteTreatment(contract: Contract, treatmentID: string, reason: string): Promise<void> {
+    await contract.submitTransaction('DeleteTreatment', treatmentID, reason);
 }
 
 async function getAllTreatments(contract: Contract): Promise<any> {
@@ -188,7 +196,7 @@ app.delete('/treatments/:id', async (req: Request, res: Response) => {
         const network = gateway.getNetwork(channelName);
         const contract = network.getContract(chaincodeName);
         
-        await deleteTreatment(contract, req.params.id);
+        await deleteTreatment(contract, req.params.id, String(req.query.reason ?? req.body?.reason ?? ''));
         res.status(200).send('Treatment deleted successfully');
     } catch (error) {
         res.status(500).send(`Error deleting treatment: ${error instanceof Error ? error.message : 'Unknown error'}`);
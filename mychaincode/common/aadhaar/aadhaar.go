@@ -0,0 +1,87 @@
+// Package aadhaar validates and masks Aadhaar numbers, the 12 digit identity numbers
+// linking patients, insurance policies and claims across the chaincodes.
+package aadhaar
+
+import (
+	"strings"
+)
+
+// Number is an Aadhaar number that passed Parse
+type Number string
+
+// ParseError explains why a value is not a valid Aadhaar number
+type ParseError struct {
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return "invalid Aadhaar number: " + e.Reason
+}
+
+// Parse checks that value is 12 digits, does not start with one of the reserved digits
+// 0 and 1, and ends in a valid Verhoeff check digit
+func Parse(value string) (Number, error) {
+	if len(value) != 12 || strings.Trim(value, "0123456789") != "" {
+		return "", &ParseError{Reason: "must be exactly 12 digits"}
+	}
+	if value[0] == '0' || value[0] == '1' {
+		return "", &ParseError{Reason: "must not start with 0 or 1"}
+	}
+	if !verhoeffValid(value) {
+		return "", &ParseError{Reason: "has an invalid check digit"}
+	}
+	return Number(value), nil
+}
+
+// Masked renders the number with all but its last four digits hidden, e.g. XXXX-XXXX-1234
+func (n Number) Masked() string {
+	return Mask(string(n))
+}
+
+// Mask hides all but the last four digits of an Aadhaar number. Values too short to be
+// one are hidden completely; empty values stay empty.
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) < 12 {
+		return "XXXX-XXXX-XXXX"
+	}
+	return "XXXX-XXXX-" + value[len(value)-4:]
+}
+
+// Verhoeff's dihedral group multiplication and position permutation tables
+var (
+	verhoeffMultiplication = [10][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffPermutation = [8][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// verhoeffValid reports whether the last digit of digits is its Verhoeff check digit
+func verhoeffValid(digits string) bool {
+	check := 0
+	for i := 0; i < len(digits); i++ {
+		digit := int(digits[len(digits)-1-i] - '0')
+		check = verhoeffMultiplication[check][verhoeffPermutation[i%8][digit]]
+	}
+	return check == 0
+}
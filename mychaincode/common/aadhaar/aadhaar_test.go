@@ -0,0 +1,70 @@
+package aadhaar
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value  string
+		reason string // empty if value is valid
+	}{
+		{"234567890124", ""},
+		{"987654321096", ""},
+		{"234567890123", "has an invalid check digit"},
+		{"23456789012", "must be exactly 12 digits"},
+		{"2345678901245", "must be exactly 12 digits"},
+		{"23456789012A", "must be exactly 12 digits"},
+		{"", "must be exactly 12 digits"},
+		{"034567890124", "must not start with 0 or 1"},
+		{"134567890124", "must not start with 0 or 1"},
+	}
+
+	for _, tt := range tests {
+		number, err := Parse(tt.value)
+		if tt.reason == "" {
+			if err != nil || string(number) != tt.value {
+				t.Errorf("Parse(%q) = %q, %v; want %q, nil", tt.value, number, err, tt.value)
+			}
+			continue
+		}
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Reason != tt.reason {
+			t.Errorf("Parse(%q) error = %v; want reason %q", tt.value, err, tt.reason)
+		}
+	}
+}
+
+func TestVerhoeffDetectsSingleDigitErrors(t *testing.T) {
+	valid := "234567890124"
+	for i := 1; i < len(valid); i++ {
+		for d := byte('0'); d <= '9'; d++ {
+			if d == valid[i] {
+				continue
+			}
+			changed := valid[:i] + string(d) + valid[i+1:]
+			if verhoeffValid(changed) {
+				t.Errorf("verhoeffValid(%q) = true after changing digit %d", changed, i)
+			}
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := map[string]string{
+		"234567890124": "XXXX-XXXX-0124",
+		"12345":        "XXXX-XXXX-XXXX",
+		"":             "",
+	}
+	for value, want := range tests {
+		if got := Mask(value); got != want {
+			t.Errorf("Mask(%q) = %q, want %q", value, got, want)
+		}
+	}
+
+	if got := Number("987654321096").Masked(); got != "XXXX-XXXX-1096" {
+		t.Errorf("Masked() = %q, want XXXX-XXXX-1096", got)
+	}
+}
@@ -0,0 +1,95 @@
+// Package access decides which clients may call a transaction, based on the MSP of the
+// submitting client and the role attribute of its certificate
+package access
+
+import (
+	"fmt"
+
+	"common/errs"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MSP IDs of the organizations on mychannel, as defined in configtx.yaml: the hospitals,
+// the insurer and the third-party administrator (TPA) reviewing claims
+const (
+	HealthcareMSP = "HealthcareMSP"
+	InsuranceMSP  = "InsuranceMSP"
+	TPAMSP        = "TPAMSP"
+)
+
+// RoleAttribute is the certificate attribute that narrows down what a client within an
+// MSP may do. Clients whose certificate carries no role are only checked by MSP.
+const RoleAttribute = "role"
+
+// Roles checked through RoleAttribute
+const (
+	AdjudicatorRole = "adjudicator"
+	AdminRole       = "admin" // may purge deleted records, see RequireRole
+)
+
+// ClientInMSP reports whether the submitting client belongs to one of the given MSPs
+func ClientInMSP(ctx contractapi.TransactionContextInterface, mspIDs ...string) (bool, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	for _, allowed := range mspIDs {
+		if mspID == allowed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Authorize checks that the submitting client belongs to one of the given MSPs
+func Authorize(ctx contractapi.TransactionContextInterface, function string, mspIDs ...string) error {
+	allowed, err := ClientInMSP(ctx, mspIDs...)
+	if err != nil || allowed {
+		return err
+	}
+
+	mspID, _ := ctx.GetClientIdentity().GetMSPID()
+	return &errs.PermissionError{Function: function, MSPID: mspID}
+}
+
+// AuthorizeRole checks that the submitting client belongs to one of the given MSPs and,
+// if its certificate carries a role attribute, that the role is the required one
+func AuthorizeRole(ctx contractapi.TransactionContextInterface, function string, role string, mspIDs ...string) error {
+	err := Authorize(ctx, function, mspIDs...)
+	if err != nil {
+		return err
+	}
+
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue(RoleAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to get client role: %v", err)
+	}
+	if found && value != role {
+		mspID, _ := ctx.GetClientIdentity().GetMSPID()
+		return &errs.PermissionError{Function: function, MSPID: mspID, Role: value}
+	}
+
+	return nil
+}
+
+// RequireRole checks that the submitting client belongs to one of the given MSPs and that
+// its certificate carries the given role. Unlike AuthorizeRole, clients without a role
+// attribute are denied, so it guards transactions no ordinary client should call.
+func RequireRole(ctx contractapi.TransactionContextInterface, function string, role string, mspIDs ...string) error {
+	err := Authorize(ctx, function, mspIDs...)
+	if err != nil {
+		return err
+	}
+
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue(RoleAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to get client role: %v", err)
+	}
+	if !found || value != role {
+		mspID, _ := ctx.GetClientIdentity().GetMSPID()
+		return &errs.PermissionError{Function: function, MSPID: mspID, Role: value}
+	}
+
+	return nil
+}
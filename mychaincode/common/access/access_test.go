@@ -0,0 +1,102 @@
+package access_test
+
+import (
+	"errors"
+	"testing"
+
+	"common/access"
+	"common/chaincodetest"
+	"common/errs"
+)
+
+func TestAuthorize(t *testing.T) {
+	ctx := chaincodetest.NewContext(access.HealthcareMSP)
+
+	if err := access.Authorize(ctx, "CreatePatient", access.HealthcareMSP); err != nil {
+		t.Errorf("Authorize = %v, want nil", err)
+	}
+	if err := access.Authorize(ctx, "CreateClaim", access.InsuranceMSP, access.HealthcareMSP); err != nil {
+		t.Errorf("Authorize with a second MSP = %v, want nil", err)
+	}
+
+	err := access.Authorize(ctx, "CreateInsurance", access.InsuranceMSP)
+	var permissionErr *errs.PermissionError
+	if !errors.As(err, &permissionErr) {
+		t.Fatalf("Authorize = %v, want a PermissionError", err)
+	}
+	if permissionErr.Function != "CreateInsurance" || permissionErr.MSPID != access.HealthcareMSP {
+		t.Errorf("PermissionError = %+v", permissionErr)
+	}
+	coded := errs.From(err)
+	if coded.Code != errs.Forbidden || coded.Message != "permission denied: clients of HealthcareMSP may not call CreateInsurance" {
+		t.Errorf("error = %+v", coded)
+	}
+}
+
+func TestAuthorizeRole(t *testing.T) {
+	insurer := chaincodetest.NewClient(access.InsuranceMSP)
+	tests := []struct {
+		name   string
+		client *chaincodetest.ClientIdentity
+		role   string // expected role in the PermissionError, empty if allowed
+		denied bool
+	}{
+		{"no role attribute", insurer, "", false},
+		{"required role", insurer.WithAttribute(access.RoleAttribute, access.AdjudicatorRole), "", false},
+		{"other role", insurer.WithAttribute(access.RoleAttribute, "clerk"), "clerk", true},
+		{"other MSP", chaincodetest.NewClient(access.TPAMSP).WithAttribute(access.RoleAttribute, access.AdjudicatorRole), "", true},
+	}
+
+	for _, tt := range tests {
+		ctx := &chaincodetest.Context{Stub: chaincodetest.NewStub(), Client: tt.client}
+		err := access.AuthorizeRole(ctx, "ApproveClaim", access.AdjudicatorRole, access.InsuranceMSP)
+		if !tt.denied {
+			if err != nil {
+				t.Errorf("%s: AuthorizeRole = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+
+		var permissionErr *errs.PermissionError
+		if !errors.As(err, &permissionErr) || permissionErr.Role != tt.role {
+			t.Errorf("%s: AuthorizeRole = %v, want a PermissionError with role %q", tt.name, err, tt.role)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	insurer := chaincodetest.NewClient(access.InsuranceMSP)
+	tests := []struct {
+		name   string
+		client *chaincodetest.ClientIdentity
+		denied bool
+	}{
+		{"required role", insurer.WithAttribute(access.RoleAttribute, access.AdminRole), false},
+		{"no role attribute", insurer, true},
+		{"other role", insurer.WithAttribute(access.RoleAttribute, access.AdjudicatorRole), true},
+		{"other MSP", chaincodetest.NewClient(access.TPAMSP).WithAttribute(access.RoleAttribute, access.AdminRole), true},
+	}
+
+	for _, tt := range tests {
+		ctx := &chaincodetest.Context{Stub: chaincodetest.NewStub(), Client: tt.client}
+		err := access.RequireRole(ctx, "PurgeClaim", access.AdminRole, access.InsuranceMSP)
+		var permissionErr *errs.PermissionError
+		if denied := errors.As(err, &permissionErr); denied != tt.denied {
+			t.Errorf("%s: RequireRole = %v, want denied %v", tt.name, err, tt.denied)
+		}
+	}
+}
+
+func TestClientInMSP(t *testing.T) {
+	ctx := chaincodetest.NewContext(access.TPAMSP)
+
+	if in, err := access.ClientInMSP(ctx, access.HealthcareMSP, access.InsuranceMSP); err != nil || in {
+		t.Errorf("ClientInMSP = %v, %v; want false", in, err)
+	}
+	if in, err := access.ClientInMSP(ctx, access.TPAMSP); err != nil || !in {
+		t.Errorf("ClientInMSP = %v, %v; want true", in, err)
+	}
+	if in, err := access.ClientInMSP(ctx); err != nil || in {
+		t.Errorf("ClientInMSP of no MSPs = %v, %v; want false", in, err)
+	}
+}
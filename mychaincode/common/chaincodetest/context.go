@@ -0,0 +1,86 @@
+package chaincodetest
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// ClientIdentity is the identity of the client submitting a transaction
+type ClientIdentity struct {
+	ID         string
+	MSPID      string
+	Attributes map[string]string // certificate attributes, such as the role
+}
+
+// NewClient returns a client of the given MSP whose certificate carries no attributes
+func NewClient(mspID string) *ClientIdentity {
+	return &ClientIdentity{ID: "x509::CN=user1::" + mspID, MSPID: mspID, Attributes: map[string]string{}}
+}
+
+// WithAttribute returns a copy of the client whose certificate also carries the given attribute
+func (c *ClientIdentity) WithAttribute(name string, value string) *ClientIdentity {
+	client := *c
+	client.Attributes = map[string]string{name: value}
+	for n, v := range c.Attributes {
+		if n != name {
+			client.Attributes[n] = v
+		}
+	}
+	return &client
+}
+
+func (c *ClientIdentity) GetID() (string, error) {
+	return c.ID, nil
+}
+
+func (c *ClientIdentity) GetMSPID() (string, error) {
+	return c.MSPID, nil
+}
+
+func (c *ClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := c.Attributes[attrName]
+	return value, found, nil
+}
+
+func (c *ClientIdentity) AssertAttributeValue(attrName string, attrValue string) error {
+	value, found := c.Attributes[attrName]
+	if !found || value != attrValue {
+		return fmt.Errorf("attribute '%s' equals '%s', not '%s'", attrName, value, attrValue)
+	}
+	return nil
+}
+
+// GetX509Certificate returns nil, as the client has no real certificate
+func (c *ClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// Context is a contractapi.TransactionContextInterface over a Stub
+type Context struct {
+	Stub   *Stub
+	Client *ClientIdentity
+}
+
+// NewContext returns the context of the first transaction on an empty ledger, submitted
+// by a client of the given MSP
+func NewContext(mspID string) *Context {
+	return &Context{Stub: NewStub(), Client: NewClient(mspID)}
+}
+
+// Next starts the next transaction on the same ledger and returns its context, submitted
+// by client
+func (c *Context) Next(client *ClientIdentity) *Context {
+	c.Stub.StartTransaction()
+	return &Context{Stub: c.Stub, Client: client}
+}
+
+func (c *Context) GetStub() shim.ChaincodeStubInterface {
+	return c.Stub
+}
+
+func (c *Context) GetClientIdentity() cid.ClientIdentity {
+	return c.Client
+}
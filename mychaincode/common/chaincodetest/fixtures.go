@@ -0,0 +1,58 @@
+package chaincodetest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"common/access"
+	"common/events"
+	"common/invoke"
+	"common/money"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// The clients the contracts' tests submit transactions as
+var (
+	Hospital      = NewClient(access.HealthcareMSP)
+	HospitalAdmin = Hospital.WithAttribute(access.RoleAttribute, access.AdminRole)
+	Insurer       = NewClient(access.InsuranceMSP)
+	Adjudicator   = Insurer.WithAttribute(access.RoleAttribute, access.AdjudicatorRole)
+	InsurerAdmin  = Insurer.WithAttribute(access.RoleAttribute, access.AdminRole)
+	TPA           = NewClient(access.TPAMSP)
+)
+
+// INR returns an amount in minor units of the default currency
+func INR(amount int64) money.Money {
+	return money.Money{Amount: amount, Currency: money.DefaultCurrency}
+}
+
+// LastEvent decodes the most recent chaincode event, failing the test if there is none
+// or it is not named after its payload's event type
+func LastEvent(t testing.TB, ctx *Context) events.RecordEvent {
+	t.Helper()
+	event := ctx.Stub.LastEvent()
+	if event == nil {
+		t.Fatal("no chaincode event was set")
+	}
+	var payload events.RecordEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.EventType != event.EventName {
+		t.Errorf("event %s has payload of type %s", event.EventName, payload.EventType)
+	}
+	return payload
+}
+
+// WithClaims stands in for the claim chaincode, answering its queries with the given
+// claims, by claim ID and status
+func WithClaims(ctx *Context, statuses map[string]string) {
+	ctx.Stub.Chaincodes[invoke.ClaimChaincode] = func(function string, args []string) peer.Response {
+		var claims []invoke.ClaimSummary
+		for claimID, status := range statuses {
+			claims = append(claims, invoke.ClaimSummary{ClaimID: claimID, Status: status})
+		}
+		return Success(claims)
+	}
+}
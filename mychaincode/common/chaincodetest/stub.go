@@ -0,0 +1,387 @@
+// Package chaincodetest provides an in-memory transaction context for unit testing the
+// contracts without a peer: world state with key history, private data, transient data,
+// chaincode events, client identities and stand-ins for the chaincodes a contract invokes.
+package chaincodetest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Epoch is the timestamp of the first transaction on a new Stub. Every later transaction
+// is one minute after the one before it.
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Chaincode stands in for another chaincode, answering the InvokeChaincode calls made to
+// it with the response the real chaincode would give
+type Chaincode func(function string, args []string) peer.Response
+
+// Success returns a successful chaincode response with value encoded as JSON, the way
+// contractapi encodes the results of transactions
+func Success(value interface{}) peer.Response {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(payload)
+}
+
+// Stub is an in-memory shim.ChaincodeStubInterface. It extends shimtest.MockStub with
+// the parts of the stub the contracts use that MockStub leaves out.
+type Stub struct {
+	*shimtest.MockStub
+
+	// Events holds every chaincode event set so far, oldest first
+	Events []*peer.ChaincodeEvent
+	// Chaincodes answers InvokeChaincode calls, by chaincode name
+	Chaincodes map[string]Chaincode
+	// Invoked names the chaincode the client's proposal invoked. Set it to the name of
+	// another chaincode to test a transaction as called by that chaincode.
+	Invoked string
+
+	history      map[string][]*queryresult.KeyModification
+	transactions int
+}
+
+// NewStub returns an empty ledger with its first transaction started
+func NewStub() *Stub {
+	s := &Stub{
+		MockStub:   shimtest.NewMockStub("chaincode", nil),
+		Chaincodes: make(map[string]Chaincode),
+		history:    make(map[string][]*queryresult.KeyModification),
+	}
+	s.StartTransaction()
+	return s
+}
+
+// StartTransaction starts the next transaction, with IDs tx1, tx2 and so on. Transient
+// data does not carry over from the previous transaction.
+func (s *Stub) StartTransaction() {
+	s.transactions++
+	s.MockTransactionStart(fmt.Sprintf("tx%d", s.transactions))
+	s.SetTxTime(Epoch.Add(time.Duration(s.transactions-1) * time.Minute))
+	s.TransientMap = nil
+}
+
+// SetTxTime sets the timestamp of the current transaction
+func (s *Stub) SetTxTime(t time.Time) {
+	s.TxTimestamp = timestamppb.New(t)
+}
+
+// LastEvent returns the most recent chaincode event, or nil if none was set
+func (s *Stub) LastEvent() *peer.ChaincodeEvent {
+	if len(s.Events) == 0 {
+		return nil
+	}
+	return s.Events[len(s.Events)-1]
+}
+
+// PutState writes a key and records the new value in the key's history
+func (s *Stub) PutState(key string, value []byte) error {
+	err := s.MockStub.PutState(key, value)
+	if err != nil {
+		return err
+	}
+	s.record(key, value, len(value) == 0)
+	return nil
+}
+
+// DelState deletes a key and records the deletion in the key's history
+func (s *Stub) DelState(key string) error {
+	err := s.MockStub.DelState(key)
+	if err != nil {
+		return err
+	}
+	s.record(key, nil, true)
+	return nil
+}
+
+func (s *Stub) record(key string, value []byte, isDelete bool) {
+	s.history[key] = append(s.history[key], &queryresult.KeyModification{
+		TxId:      s.TxID,
+		Value:     value,
+		Timestamp: s.TxTimestamp,
+		IsDelete:  isDelete,
+	})
+}
+
+// GetHistoryForKey returns every write to a key, newest first as on a Fabric 2 peer
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	var modifications []*queryresult.KeyModification
+	for i := len(s.history[key]) - 1; i >= 0; i-- {
+		modifications = append(modifications, s.history[key][i])
+	}
+	return &historyIterator{modifications: modifications}, nil
+}
+
+// GetStateByRange returns the simple keys in the range. As on a peer, an empty start or
+// end key leaves that end of the range open and composite keys are never included.
+func (s *Stub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = "\x01"
+	}
+	if endKey == "" {
+		endKey = string(utf8.MaxRune)
+	}
+	return s.MockStub.GetStateByRange(startKey, endKey)
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns up to pageSize keys starting at
+// bookmark. The bookmark returned is the next key, or empty after the last page.
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string,
+	pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	resultsIterator, err := s.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultsIterator.Close()
+
+	page := &kvIterator{}
+	metadata := &peer.QueryResponseMetadata{}
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if kv.Key < bookmark {
+			continue
+		}
+		if int32(len(page.kvs)) == pageSize {
+			metadata.Bookmark = kv.Key
+			break
+		}
+		page.kvs = append(page.kvs, kv)
+	}
+	metadata.FetchedRecordsCount = int32(len(page.kvs))
+
+	return page, metadata, nil
+}
+
+// GetQueryResult runs a CouchDB query against the world state. Only the selector is
+// honoured: it may compare top level fields for equality or with $eq, $ne, $gt, $gte,
+// $lt, $lte and $in. Values that are not JSON objects never match.
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	err := json.Unmarshal([]byte(query), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+
+	results := &kvIterator{}
+	for elem := s.Keys.Front(); elem != nil; elem = elem.Next() {
+		key := elem.Value.(string)
+		var doc map[string]interface{}
+		if json.Unmarshal(s.State[key], &doc) != nil {
+			continue
+		}
+		match, err := matches(doc, parsed.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			results.kvs = append(results.kvs, &queryresult.KV{Key: key, Value: s.State[key]})
+		}
+	}
+
+	return results, nil
+}
+
+// matches reports whether a JSON document satisfies a CouchDB selector
+func matches(doc map[string]interface{}, selector map[string]interface{}) (bool, error) {
+	for field, condition := range selector {
+		operators, ok := condition.(map[string]interface{})
+		if !ok {
+			operators = map[string]interface{}{"$eq": condition}
+		}
+		for operator, operand := range operators {
+			match, err := compare(doc[field], operator, operand)
+			if err != nil || !match {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// compare applies a single CouchDB condition operator to a field value
+func compare(value interface{}, operator string, operand interface{}) (bool, error) {
+	switch operator {
+	case "$eq":
+		return reflect.DeepEqual(value, operand), nil
+	case "$ne":
+		return !reflect.DeepEqual(value, operand), nil
+	case "$in":
+		candidates, ok := operand.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("$in needs an array, got %v", operand)
+		}
+		for _, candidate := range candidates {
+			if reflect.DeepEqual(value, candidate) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$gt", "$gte", "$lt", "$lte":
+		order, ok := order(value, operand)
+		if !ok {
+			return false, nil
+		}
+		switch operator {
+		case "$gt":
+			return order > 0, nil
+		case "$gte":
+			return order >= 0, nil
+		case "$lt":
+			return order < 0, nil
+		default:
+			return order <= 0, nil
+		}
+	default:
+		return false, fmt.Errorf("unsupported query operator %s", operator)
+	}
+}
+
+// order compares two numbers or two strings, reporting false for anything else
+func order(a interface{}, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	}
+	return 0, false
+}
+
+// DelPrivateData deletes a key from a private data collection
+func (s *Stub) DelPrivateData(collection string, key string) error {
+	delete(s.PvtState[collection], key)
+	return nil
+}
+
+// GetPrivateDataHash returns the SHA-256 hash of a private data value, or nil if the key
+// is not in the collection
+func (s *Stub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value, ok := s.PvtState[collection][key]
+	if !ok {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// SetEvent records a chaincode event in Events
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	s.Events = append(s.Events, &peer.ChaincodeEvent{EventName: name, Payload: payload, TxId: s.TxID})
+	return nil
+}
+
+// GetSignedProposal returns a proposal invoking the chaincode named by Invoked
+func (s *Stub) GetSignedProposal() (*peer.SignedProposal, error) {
+	spec, err := proto.Marshal(&peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{ChaincodeId: &peer.ChaincodeID{Name: s.Invoked}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(&peer.ChaincodeProposalPayload{Input: spec})
+	if err != nil {
+		return nil, err
+	}
+	proposal, err := proto.Marshal(&peer.Proposal{Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+	return &peer.SignedProposal{ProposalBytes: proposal}, nil
+}
+
+// InvokeChaincode calls the stand-in registered in Chaincodes under chaincodeName
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	chaincode, ok := s.Chaincodes[chaincodeName]
+	if !ok {
+		return shim.Error(fmt.Sprintf("chaincode %s is not installed", chaincodeName))
+	}
+	if len(args) == 0 {
+		return shim.Error("no function given")
+	}
+
+	var params []string
+	for _, arg := range args[1:] {
+		params = append(params, string(arg))
+	}
+	return chaincode(string(args[0]), params)
+}
+
+// kvIterator iterates over a fixed list of key-value pairs
+type kvIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *kvIterator) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+func (it *kvIterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, fmt.Errorf("no more results")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *kvIterator) Close() error {
+	return nil
+}
+
+// historyIterator iterates over a fixed list of key modifications
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.modifications) == 0 {
+		return nil, fmt.Errorf("no more results")
+	}
+	modification := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return modification, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
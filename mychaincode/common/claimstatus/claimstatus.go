@@ -0,0 +1,44 @@
+// Package claimstatus names the statuses of the claim lifecycle. The claim chaincode
+// moves claims through them; the other chaincodes check them before changing or deleting
+// a record that claims refer to.
+package claimstatus
+
+// Claim statuses making up the claim lifecycle
+const (
+	Submitted   = "Submitted"
+	UnderReview = "UnderReview"
+	QueryRaised = "QueryRaised"
+	Approved    = "Approved"
+	Rejected    = "Rejected"
+	Withdrawn   = "Withdrawn"
+	Settled     = "Settled"
+	Closed      = "Closed"
+)
+
+// Terminal are the statuses of claims that will not be paid or processed any further.
+// Rejected and withdrawn claims may still be closed, but no longer need the records they
+// refer to.
+var Terminal = []string{Rejected, Withdrawn, Closed}
+
+// Decided are the statuses of claims the insurer has approved, or closed. What such a
+// claim was paid for, its treatment's patient and billing amount, may no longer change.
+var Decided = []string{Approved, Settled, Closed}
+
+// IsTerminal reports whether status is one of Terminal
+func IsTerminal(status string) bool {
+	return contains(Terminal, status)
+}
+
+// IsDecided reports whether status is one of Decided
+func IsDecided(status string) bool {
+	return contains(Decided, status)
+}
+
+func contains(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
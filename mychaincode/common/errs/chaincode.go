@@ -0,0 +1,32 @@
+package errs
+
+import (
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// WithCodes wraps a chaincode so that every error response it returns carries an encoded
+// Error. Messages that are not one already, such as those of contractapi itself, are sent
+// as Internal errors.
+func WithCodes(chaincode shim.Chaincode) shim.Chaincode {
+	return codedChaincode{chaincode}
+}
+
+type codedChaincode struct {
+	chaincode shim.Chaincode
+}
+
+func (c codedChaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return encodeError(c.chaincode.Init(stub))
+}
+
+func (c codedChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	return encodeError(c.chaincode.Invoke(stub))
+}
+
+func encodeError(response peer.Response) peer.Response {
+	if response.Status < shim.ERRORTHRESHOLD || Parse(response.Message) != nil {
+		return response
+	}
+	return shim.Error(New(Internal, "%s", response.Message).Error())
+}
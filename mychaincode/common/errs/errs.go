@@ -0,0 +1,176 @@
+// Package errs holds the error types shared by the chaincodes. Every error a client can act
+// on carries a Code and reaches the client as a JSON encoded Error in the response message,
+// so that clients branch on codes instead of matching messages.
+package errs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Code tells clients what kind of error occurred
+type Code string
+
+const (
+	NotFound         Code = "NOT_FOUND"         // the record does not exist
+	AlreadyExists    Code = "ALREADY_EXISTS"    // the record to be created already exists
+	ValidationFailed Code = "VALIDATION_FAILED" // the input is invalid, see the details
+	Forbidden        Code = "FORBIDDEN"         // the client may not call the transaction
+	LimitExceeded    Code = "LIMIT_EXCEEDED"    // an amount exceeds what is left of a limit
+	InvalidState     Code = "INVALID_STATE"     // the record's status does not allow the operation
+	Conflict         Code = "CONFLICT"          // the record changed since the client read it
+	Internal         Code = "INTERNAL"          // any other error, including contractapi's own
+)
+
+// Error is an error as clients see it
+type Error struct {
+	Code    Code                   `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// New returns an error with the given code and message
+func New(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// With adds a detail to the error and returns it
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Error returns the error encoded as JSON, as it is sent to clients
+func (e *Error) Error() string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(e)
+	if err != nil {
+		return e.Message
+	}
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// Coder is implemented by error types that translate into an Error, such as NotFoundError
+type Coder interface {
+	Coded() *Error
+}
+
+// From returns err as an *Error. Errors without a code are Internal.
+func From(err error) *Error {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded
+	}
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.Coded()
+	}
+	return &Error{Code: Internal, Message: err.Error()}
+}
+
+// Parse decodes an error message as sent to clients, e.g. that of a failed call to another
+// chaincode. It returns nil if the message is not an encoded Error.
+func Parse(message string) *Error {
+	var coded Error
+	err := json.Unmarshal([]byte(message), &coded)
+	if err != nil || coded.Code == "" {
+		return nil
+	}
+	return &coded
+}
+
+// NotFoundError is returned when a record does not exist in the world state
+type NotFoundError struct {
+	Kind   string // e.g. "claim"
+	IDName string // e.g. "ID", or "number" for insurance policies
+	ID     string
+}
+
+func (e *NotFoundError) Coded() *Error {
+	return New(NotFound, "%s with %s %s does not exist", e.Kind, e.IDName, e.ID).With("kind", e.Kind).With("id", e.ID)
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Coded().Error()
+}
+
+// AlreadyExistsError is returned when a record to be created already exists
+type AlreadyExistsError struct {
+	Kind   string
+	IDName string
+	ID     string
+}
+
+func (e *AlreadyExistsError) Coded() *Error {
+	return New(AlreadyExists, "%s with %s %s already exists", e.Kind, e.IDName, e.ID).With("kind", e.Kind).With("id", e.ID)
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return e.Coded().Error()
+}
+
+// ConflictError is returned when a client updates a record expecting a version other than
+// the stored one, i.e. someone else changed the record since the client read it
+type ConflictError struct {
+	Kind     string
+	IDName   string
+	ID       string
+	Expected int
+	Actual   int
+}
+
+func (e *ConflictError) Coded() *Error {
+	return New(Conflict, "%s with %s %s is at version %d, not the expected version %d", e.Kind, e.IDName, e.ID, e.Actual, e.Expected).
+		With("kind", e.Kind).With("id", e.ID).With("expected", e.Expected).With("actual", e.Actual)
+}
+
+func (e *ConflictError) Error() string {
+	return e.Coded().Error()
+}
+
+// InUseError is returned when a record cannot be deleted because other records still
+// refer to it, e.g. a patient with open claims
+type InUseError struct {
+	Kind         string
+	IDName       string
+	ID           string
+	Dependents   string // what refers to the record, e.g. "open claims"
+	DependentIDs []string
+}
+
+func (e *InUseError) Coded() *Error {
+	return New(InvalidState, "%s with %s %s is in use by %s: %s", e.Kind, e.IDName, e.ID, e.Dependents, strings.Join(e.DependentIDs, ", ")).
+		With("kind", e.Kind).With("id", e.ID).With("dependents", e.Dependents).With("dependentIDs", e.DependentIDs)
+}
+
+func (e *InUseError) Error() string {
+	return e.Coded().Error()
+}
+
+// PermissionError is returned when the submitting client may not call a transaction
+type PermissionError struct {
+	Function string
+	MSPID    string
+	Role     string
+}
+
+func (e *PermissionError) Coded() *Error {
+	if e.Role != "" {
+		return New(Forbidden, "permission denied: clients of %s with role %q may not call %s", e.MSPID, e.Role, e.Function).
+			With("function", e.Function).With("mspID", e.MSPID).With("role", e.Role)
+	}
+	return New(Forbidden, "permission denied: clients of %s may not call %s", e.MSPID, e.Function).
+		With("function", e.Function).With("mspID", e.MSPID)
+}
+
+func (e *PermissionError) Error() string {
+	return e.Coded().Error()
+}
@@ -0,0 +1,84 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func TestError(t *testing.T) {
+	err := New(LimitExceeded, "claim amount %s exceeds <remaining> limit", "INR 10.00").With("insuranceNumber", "INS1")
+	want := `{"code":"LIMIT_EXCEEDED","message":"claim amount INR 10.00 exceeds <remaining> limit","details":{"insuranceNumber":"INS1"}}`
+	if err.Error() != want {
+		t.Errorf("Error() = %s, want %s", err.Error(), want)
+	}
+
+	parsed := Parse(err.Error())
+	if parsed == nil || parsed.Code != LimitExceeded || parsed.Message != err.Message || parsed.Details["insuranceNumber"] != "INS1" {
+		t.Errorf("Parse = %+v", parsed)
+	}
+	for _, message := range []string{"plain failure", `{"message":"no code"}`, ""} {
+		if parsed := Parse(message); parsed != nil {
+			t.Errorf("Parse(%q) = %+v, want nil", message, parsed)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		err     error
+		code    Code
+		message string
+	}{
+		{New(InvalidState, "closed"), InvalidState, "closed"},
+		{fmt.Errorf("wrapped: %w", &NotFoundError{Kind: "claim", IDName: "ID", ID: "C1"}), NotFound, "claim with ID C1 does not exist"},
+		{&AlreadyExistsError{Kind: "policy", IDName: "number", ID: "P1"}, AlreadyExists, "policy with number P1 already exists"},
+		{&ConflictError{Kind: "claim", IDName: "ID", ID: "C1", Expected: 2, Actual: 3}, Conflict,
+			"claim with ID C1 is at version 3, not the expected version 2"},
+		{&InUseError{Kind: "patient", IDName: "ID", ID: "P1", Dependents: "open claims", DependentIDs: []string{"C1", "C2"}}, InvalidState,
+			"patient with ID P1 is in use by open claims: C1, C2"},
+		{&PermissionError{Function: "ApproveClaim", MSPID: "InsuranceMSP", Role: "clerk"}, Forbidden,
+			`permission denied: clients of InsuranceMSP with role "clerk" may not call ApproveClaim`},
+		{errors.New("disk on fire"), Internal, "disk on fire"},
+	}
+	for _, tt := range tests {
+		coded := From(tt.err)
+		if coded.Code != tt.code || coded.Message != tt.message {
+			t.Errorf("From(%v) = %+v, want %s %q", tt.err, coded, tt.code, tt.message)
+		}
+	}
+}
+
+// responder is a chaincode answering every call with the same response
+type responder peer.Response
+
+func (r responder) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return peer.Response(r)
+}
+
+func (r responder) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	return peer.Response(r)
+}
+
+func TestWithCodes(t *testing.T) {
+	notFound := (&NotFoundError{Kind: "claim", IDName: "ID", ID: "C1"}).Error()
+	tests := []struct {
+		response peer.Response
+		message  string
+	}{
+		{shim.Success([]byte("{}")), ""},
+		{shim.Error(notFound), notFound},
+		{shim.Error("Function Foo not found in contract"), `{"code":"INTERNAL","message":"Function Foo not found in contract"}`},
+	}
+	for _, tt := range tests {
+		chaincode := WithCodes(responder(tt.response))
+		for _, response := range []peer.Response{chaincode.Init(nil), chaincode.Invoke(nil)} {
+			if response.Status != tt.response.Status || response.Message != tt.message || string(response.Payload) != string(tt.response.Payload) {
+				t.Errorf("response to %+v = %+v", tt.response, response)
+			}
+		}
+	}
+}
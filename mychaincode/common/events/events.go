@@ -0,0 +1,35 @@
+// Package events emits the chaincode events clients listen to instead of polling
+package events
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// RecordEvent is the payload of every chaincode event. OldStatus is empty for new records
+// and NewStatus for deleted ones; both are always empty for records without a status.
+type RecordEvent struct {
+	EventType string `json:"eventType"`
+	RecordID  string `json:"recordID"`
+	OldStatus string `json:"oldStatus"`
+	NewStatus string `json:"newStatus"`
+	TxID      string `json:"txID"`
+}
+
+// Emit sets the transaction's chaincode event, named after eventType. Fabric keeps only
+// one event per transaction, so it should be called once, after the state change it reports.
+func Emit(ctx contractapi.TransactionContextInterface, eventType string, recordID string, oldStatus string, newStatus string) error {
+	payload, err := json.Marshal(RecordEvent{
+		EventType: eventType,
+		RecordID:  recordID,
+		OldStatus: oldStatus,
+		NewStatus: newStatus,
+		TxID:      ctx.GetStub().GetTxID(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().SetEvent(eventType, payload)
+}
@@ -0,0 +1,58 @@
+package invoke
+
+import (
+	"common/claimstatus"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ClaimSummary is the part of a claim that the other chaincodes check before deleting a
+// record the claim refers to
+type ClaimSummary struct {
+	ClaimID string `json:"claimID"`
+	Status  string `json:"status"`
+}
+
+// Open reports whether the claim is still being processed, i.e. not in one of the
+// claimstatus.Terminal statuses
+func (c ClaimSummary) Open() bool {
+	return !claimstatus.IsTerminal(c.Status)
+}
+
+// Decided reports whether the insurer has approved or closed the claim, i.e. it is in one
+// of the claimstatus.Decided statuses
+func (c ClaimSummary) Decided() bool {
+	return claimstatus.IsDecided(c.Status)
+}
+
+// ClaimIDs calls query, one of the claim chaincode's QueryClaimsBy* functions such as
+// "QueryClaimsByPatient", for id and returns the IDs of the claims it found
+func ClaimIDs(ctx contractapi.TransactionContextInterface, query string, id string) ([]string, error) {
+	return claimIDs(ctx, query, id, nil)
+}
+
+// OpenClaimIDs is like ClaimIDs but returns only the claims that are still open
+func OpenClaimIDs(ctx contractapi.TransactionContextInterface, query string, id string) ([]string, error) {
+	return claimIDs(ctx, query, id, ClaimSummary.Open)
+}
+
+// DecidedClaimIDs is like ClaimIDs but returns only the claims the insurer has decided
+func DecidedClaimIDs(ctx contractapi.TransactionContextInterface, query string, id string) ([]string, error) {
+	return claimIDs(ctx, query, id, ClaimSummary.Decided)
+}
+
+func claimIDs(ctx contractapi.TransactionContextInterface, query string, id string, include func(ClaimSummary) bool) ([]string, error) {
+	var claims []ClaimSummary
+	err := Chaincode(ctx, ClaimChaincode, &claims, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimIDs []string
+	for _, claim := range claims {
+		if include == nil || include(claim) {
+			claimIDs = append(claimIDs, claim.ClaimID)
+		}
+	}
+	return claimIDs, nil
+}
@@ -0,0 +1,91 @@
+// Package invoke calls the other chaincodes of the healthcare network on the same channel
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"common/errs"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Names of the chaincodes, as deployed on the channel
+const (
+	PatientChaincode   = "patientcc"
+	TreatmentChaincode = "treatmentcc"
+	InsuranceChaincode = "insurancecc"
+	ClaimChaincode     = "insuranceclaimcc"
+)
+
+// Chaincode calls a function on another chaincode on the same channel and unmarshals its
+// JSON response into result, unless result or the response is empty. Coded errors of the
+// other chaincode are returned as they are.
+func Chaincode(ctx contractapi.TransactionContextInterface, chaincodeName string, result interface{}, function string, args ...string) error {
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(chaincodeName, invokeArgs, "")
+	if response.Status != shim.OK {
+		// Pass on what went wrong, such as NOT_FOUND or LIMIT_EXCEEDED, with its code
+		if coded := errs.Parse(response.Message); coded != nil && coded.Code != errs.Internal {
+			return coded
+		}
+		return fmt.Errorf("failed to invoke %s on %s: %s", function, chaincodeName, response.Message)
+	}
+	// contractapi sends nil results, such as a query that found nothing, as no payload
+	if result == nil || len(response.Payload) == 0 {
+		return nil
+	}
+
+	err := json.Unmarshal(response.Payload, result)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s response from %s: %v", function, chaincodeName, err)
+	}
+
+	return nil
+}
+
+// Invoked returns the name of the chaincode the client's proposal invoked. A chaincode
+// called through Chaincode sees the name of the chaincode that called it, not its own.
+func Invoked(ctx contractapi.TransactionContextInterface) (string, error) {
+	signed, err := ctx.GetStub().GetSignedProposal()
+	if err != nil {
+		return "", fmt.Errorf("failed to get signed proposal: %v", err)
+	}
+	var proposal peer.Proposal
+	err = proto.Unmarshal(signed.GetProposalBytes(), &proposal)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode proposal: %v", err)
+	}
+	var payload peer.ChaincodeProposalPayload
+	err = proto.Unmarshal(proposal.Payload, &payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode proposal payload: %v", err)
+	}
+	var spec peer.ChaincodeInvocationSpec
+	err = proto.Unmarshal(payload.Input, &spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode chaincode invocation: %v", err)
+	}
+	return spec.GetChaincodeSpec().GetChaincodeId().GetName(), nil
+}
+
+// AuthorizeCaller checks that function is called by the chaincode named caller as part of
+// one of its transactions, not by a client directly
+func AuthorizeCaller(ctx contractapi.TransactionContextInterface, function string, caller string) error {
+	invoked, err := Invoked(ctx)
+	if err != nil {
+		return err
+	}
+	if invoked != caller {
+		return errs.New(errs.Forbidden, "permission denied: %s may only be called by %s", function, caller).
+			With("function", function).With("caller", caller)
+	}
+	return nil
+}
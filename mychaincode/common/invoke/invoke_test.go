@@ -0,0 +1,100 @@
+package invoke_test
+
+import (
+	"testing"
+
+	"common/chaincodetest"
+	"common/errs"
+	"common/invoke"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func TestChaincode(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	ctx.Stub.Chaincodes[invoke.ClaimChaincode] = func(function string, args []string) peer.Response {
+		switch {
+		case function == "Echo":
+			return chaincodetest.Success(args)
+		case function == "Nothing":
+			return shim.Success(nil)
+		case function == "Missing":
+			return shim.Error(errs.New(errs.NotFound, "claim with ID %s does not exist", args[0]).Error())
+		}
+		return shim.Error("disk on fire")
+	}
+
+	var echoed []string
+	if err := invoke.Chaincode(ctx, invoke.ClaimChaincode, &echoed, "Echo", "a", "b"); err != nil || len(echoed) != 2 || echoed[1] != "b" {
+		t.Errorf("Echo = %v, %v", echoed, err)
+	}
+	if err := invoke.Chaincode(ctx, invoke.ClaimChaincode, nil, "Echo"); err != nil {
+		t.Errorf("Echo without a result = %v", err)
+	}
+
+	echoed = []string{"unchanged"}
+	if err := invoke.Chaincode(ctx, invoke.ClaimChaincode, &echoed, "Nothing"); err != nil || len(echoed) != 1 {
+		t.Errorf("Nothing = %v, %v; want the result left as it is", echoed, err)
+	}
+
+	err := invoke.Chaincode(ctx, invoke.ClaimChaincode, nil, "Missing", "CLAIM9")
+	if coded := errs.From(err); coded.Code != errs.NotFound || coded.Message != "claim with ID CLAIM9 does not exist" {
+		t.Errorf("Missing = %v, want the callee's NOT_FOUND error", err)
+	}
+	err = invoke.Chaincode(ctx, invoke.ClaimChaincode, nil, "Crash")
+	if coded := errs.From(err); coded.Code != errs.Internal || coded.Message != "failed to invoke Crash on insuranceclaimcc: disk on fire" {
+		t.Errorf("Crash = %v, want an internal error", err)
+	}
+	if err := invoke.Chaincode(ctx, invoke.TreatmentChaincode, nil, "ReadTreatment", "TREATMENT1"); err == nil {
+		t.Error("invoking a chaincode that is not installed succeeded")
+	}
+}
+
+func TestAuthorizeCaller(t *testing.T) {
+	ctx := chaincodetest.NewContext("InsuranceMSP")
+	ctx.Stub.Invoked = invoke.ClaimChaincode
+	if invoked, err := invoke.Invoked(ctx); err != nil || invoked != invoke.ClaimChaincode {
+		t.Errorf("Invoked = %q, %v", invoked, err)
+	}
+	if err := invoke.AuthorizeCaller(ctx, "DebitClaimLimit", invoke.ClaimChaincode); err != nil {
+		t.Errorf("AuthorizeCaller from %s = %v", invoke.ClaimChaincode, err)
+	}
+
+	ctx.Stub.Invoked = invoke.InsuranceChaincode
+	err := invoke.AuthorizeCaller(ctx, "DebitClaimLimit", invoke.ClaimChaincode)
+	if coded := errs.From(err); err == nil || coded.Code != errs.Forbidden || coded.Details["caller"] != invoke.ClaimChaincode {
+		t.Errorf("AuthorizeCaller from a client = %v, want FORBIDDEN", err)
+	}
+}
+
+func TestClaimIDs(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	ctx.Stub.Chaincodes[invoke.ClaimChaincode] = func(function string, args []string) peer.Response {
+		if function == "QueryClaimsByPatient" && args[0] == "PATIENT2" {
+			return chaincodetest.Success([]invoke.ClaimSummary{{"CLAIM4", "Rejected"}})
+		}
+		if function != "QueryClaimsByPatient" || args[0] != "PATIENT1" {
+			return chaincodetest.Success([]invoke.ClaimSummary{})
+		}
+		return chaincodetest.Success([]invoke.ClaimSummary{{"CLAIM1", "Closed"}, {"CLAIM2", "UnderReview"}, {"CLAIM3", "Settled"}})
+	}
+
+	if ids, err := invoke.ClaimIDs(ctx, "QueryClaimsByPatient", "PATIENT1"); err != nil || len(ids) != 3 {
+		t.Errorf("ClaimIDs = %v, %v; want all three claims", ids, err)
+	}
+	ids, err := invoke.OpenClaimIDs(ctx, "QueryClaimsByPatient", "PATIENT1")
+	if err != nil || len(ids) != 2 || ids[0] != "CLAIM2" || ids[1] != "CLAIM3" {
+		t.Errorf("OpenClaimIDs = %v, %v; want CLAIM2 and CLAIM3", ids, err)
+	}
+	ids, err = invoke.DecidedClaimIDs(ctx, "QueryClaimsByPatient", "PATIENT1")
+	if err != nil || len(ids) != 2 || ids[0] != "CLAIM1" || ids[1] != "CLAIM3" {
+		t.Errorf("DecidedClaimIDs = %v, %v; want CLAIM1 and CLAIM3", ids, err)
+	}
+	if ids, err := invoke.OpenClaimIDs(ctx, "QueryClaimsByPatient", "PATIENT2"); err != nil || len(ids) != 0 {
+		t.Errorf("OpenClaimIDs of a patient whose only claim was rejected = %v, %v; want none", ids, err)
+	}
+	if ids, err := invoke.OpenClaimIDs(ctx, "QueryClaimsByPatient", "PATIENT9"); err != nil || len(ids) != 0 {
+		t.Errorf("OpenClaimIDs of a patient without claims = %v, %v", ids, err)
+	}
+}
@@ -0,0 +1,95 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Metadata tracks the changes to a record. Records embed it, so its fields appear next
+// to theirs in the JSON, and Repository.Put keeps it up to date on every write. Records
+// written before it was introduced have none, i.e. version 0.
+type Metadata struct {
+	Version           int    `json:"version,omitempty" metadata:",optional"` // 1 when created, one more on every write
+	LastModifiedTxID  string `json:"lastModifiedTxID,omitempty" metadata:",optional"`
+	LastModifiedAt    string `json:"lastModifiedAt,omitempty" metadata:",optional"`    // RFC 3339, UTC
+	LastModifiedBy    string `json:"lastModifiedBy,omitempty" metadata:",optional"`    // the submitting client's ID
+	LastModifiedByMSP string `json:"lastModifiedByMSP,omitempty" metadata:",optional"` // and its MSP
+
+	// Set while the record is soft deleted, see Repository.SoftDelete
+	Deleted       bool   `json:"deleted,omitempty" metadata:",optional"`
+	DeletedReason string `json:"deletedReason,omitempty" metadata:",optional"`
+	DeletedBy     string `json:"deletedBy,omitempty" metadata:",optional"` // the deleting client's ID
+	DeletedAt     string `json:"deletedAt,omitempty" metadata:",optional"` // RFC 3339, UTC
+}
+
+// MetadataFields are the JSON names of the Metadata fields, which clients cannot set
+// themselves, e.g. in a patch
+var MetadataFields = []string{
+	"version", "lastModifiedTxID", "lastModifiedAt", "lastModifiedBy", "lastModifiedByMSP",
+	"deleted", "deletedReason", "deletedBy", "deletedAt",
+}
+
+// versioned is implemented by records embedding Metadata
+type versioned interface {
+	metadata() *Metadata
+}
+
+func (m *Metadata) metadata() *Metadata {
+	return m
+}
+
+// stamp sets m to the version after that of the stored record, or to version 1 if there
+// is none, and records the current transaction and its submitter as the last change
+func (m *Metadata) stamp(ctx contractapi.TransactionContextInterface, storedJSON []byte) error {
+	var stored Metadata
+	if storedJSON != nil {
+		err := json.Unmarshal(storedJSON, &stored)
+		if err != nil {
+			return err
+		}
+	}
+	change, err := currentChange(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.Version = stored.Version + 1
+	m.LastModifiedTxID = ctx.GetStub().GetTxID()
+	m.LastModifiedAt = change.at
+	m.LastModifiedBy = change.clientID
+	m.LastModifiedByMSP = change.mspID
+	return nil
+}
+
+// change is who makes the current transaction's changes, and when
+type change struct {
+	clientID string
+	mspID    string
+	at       string // RFC 3339, UTC
+}
+
+// currentChange returns the submitting client and the transaction timestamp
+func currentChange(ctx contractapi.TransactionContextInterface) (*change, error) {
+	timestamp, err := TxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client ID: %v", err)
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	return &change{clientID: clientID, mspID: mspID, at: timestamp.Format(time.RFC3339)}, nil
+}
+
+// isDeleted reports whether record is a soft deleted one
+func isDeleted(record any) bool {
+	v, ok := record.(versioned)
+	return ok && v.metadata().Deleted
+}
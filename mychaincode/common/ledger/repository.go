@@ -0,0 +1,471 @@
+// Package ledger stores chaincode records as JSON in the world state under composite
+// keys, one object type per kind of record
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"common/errs"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Repository reads and writes the records of type T, which live under composite keys
+// of ObjectType with the record's ID as the only attribute
+type Repository[T any] struct {
+	ObjectType string // e.g. "claim~id"
+	Kind       string // names the records in errors, e.g. "claim"
+	IDName     string // names their IDs in errors, e.g. "ID"
+}
+
+// Page is one page of records along with the bookmark for the next page
+type Page[T any] struct {
+	Records             []*T
+	FetchedRecordsCount int32
+	Bookmark            string
+}
+
+// Version is one committed version of a record, as returned by History
+type Version[T any] struct {
+	TxID      string
+	Timestamp string // RFC 3339, UTC
+	IsDelete  bool
+	Record    *T // nil when the version is a deletion
+}
+
+// Key returns the composite world state key of the record with the given ID
+func (r Repository[T]) Key(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(r.ObjectType, []string{id})
+}
+
+// NotFound returns the error reported when the record with the given ID does not exist
+func (r Repository[T]) NotFound(id string) error {
+	return &errs.NotFoundError{Kind: r.Kind, IDName: r.IDName, ID: id}
+}
+
+// AlreadyExists returns the error reported when the record with the given ID already exists
+func (r Repository[T]) AlreadyExists(id string) error {
+	return &errs.AlreadyExistsError{Kind: r.Kind, IDName: r.IDName, ID: id}
+}
+
+// InUse returns the error reported when the record with the given ID cannot be deleted
+// because the given dependents, e.g. "open claims", refer to it
+func (r Repository[T]) InUse(id string, dependents string, dependentIDs []string) error {
+	return &errs.InUseError{Kind: r.Kind, IDName: r.IDName, ID: id, Dependents: dependents, DependentIDs: dependentIDs}
+}
+
+// Exists reports whether a record with the given ID exists, soft deleted or not, so that
+// the IDs of deleted records are not reused
+func (r Repository[T]) Exists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	key, err := r.Key(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	recordJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+
+	return recordJSON != nil, nil
+}
+
+// Read returns the record with the given ID, or a *errs.NotFoundError if there is none or
+// it is soft deleted
+func (r Repository[T]) Read(ctx contractapi.TransactionContextInterface, id string) (*T, error) {
+	record, err := r.ReadIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if isDeleted(record) {
+		return nil, r.NotFound(id)
+	}
+
+	return record, nil
+}
+
+// ReadIncludingDeleted returns the record with the given ID even if it is soft deleted,
+// or a *errs.NotFoundError if there is none
+func (r Repository[T]) ReadIncludingDeleted(ctx contractapi.TransactionContextInterface, id string) (*T, error) {
+	key, err := r.Key(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	recordJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, r.NotFound(id)
+	}
+
+	var record T
+	err = json.Unmarshal(recordJSON, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Put writes the record with the given ID. Records embedding Metadata are first stamped
+// with the version after the stored one and the current transaction.
+func (r Repository[T]) Put(ctx contractapi.TransactionContextInterface, id string, record *T) error {
+	key, err := r.Key(ctx, id)
+	if err != nil {
+		return err
+	}
+	if v, ok := any(record).(versioned); ok {
+		storedJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return fmt.Errorf("failed to read from world state: %v", err)
+		}
+		err = v.metadata().stamp(ctx, storedJSON)
+		if err != nil {
+			return err
+		}
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, recordJSON)
+}
+
+// CheckVersion returns a *errs.ConflictError unless expected is 0, meaning the client
+// does not care, or the version of the record, which must embed Metadata
+func (r Repository[T]) CheckVersion(id string, record *T, expected int) error {
+	v, ok := any(record).(versioned)
+	if !ok {
+		return fmt.Errorf("%s records are not versioned", r.Kind)
+	}
+	if expected != 0 && expected != v.metadata().Version {
+		return &errs.ConflictError{Kind: r.Kind, IDName: r.IDName, ID: id, Expected: expected, Actual: v.metadata().Version}
+	}
+	return nil
+}
+
+// Delete removes the record with the given ID from the world state for good, or returns
+// a *errs.NotFoundError
+func (r Repository[T]) Delete(ctx contractapi.TransactionContextInterface, id string) error {
+	exists, err := r.Exists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return r.NotFound(id)
+	}
+	key, err := r.Key(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelState(key)
+}
+
+// SoftDelete marks the record with the given ID, which must embed Metadata, as deleted
+// for the given reason by the submitting client. It stays in the world state, but Read and
+// the listings treat it as gone until it is restored. It returns the deleted record.
+func (r Repository[T]) SoftDelete(ctx contractapi.TransactionContextInterface, id string, reason string) (*T, error) {
+	var v validation.Validator
+	v.Required("reason", reason)
+	err := v.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := r.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := any(record).(versioned)
+	if !ok {
+		return nil, fmt.Errorf("%s records cannot be soft deleted", r.Kind)
+	}
+	change, err := currentChange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.metadata().Deleted = true
+	m.metadata().DeletedReason = reason
+	m.metadata().DeletedBy = change.clientID
+	m.metadata().DeletedAt = change.at
+
+	return record, r.Put(ctx, id, record)
+}
+
+// Restore undoes the soft deletion of the record with the given ID and returns it. It
+// fails with INVALID_STATE if the record is not deleted.
+func (r Repository[T]) Restore(ctx contractapi.TransactionContextInterface, id string) (*T, error) {
+	record, err := r.ReadIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !isDeleted(record) {
+		return nil, errs.New(errs.InvalidState, "%s with %s %s is not deleted", r.Kind, r.IDName, id).With("kind", r.Kind).With("id", id)
+	}
+	m := any(record).(versioned).metadata()
+	m.Deleted = false
+	m.DeletedReason = ""
+	m.DeletedBy = ""
+	m.DeletedAt = ""
+
+	return record, r.Put(ctx, id, record)
+}
+
+// Purge removes the soft deleted record with the given ID from the world state for good.
+// Records are soft deleted first, so that purging one is always a deliberate second step;
+// purging a record that is not deleted fails with INVALID_STATE.
+func (r Repository[T]) Purge(ctx contractapi.TransactionContextInterface, id string) error {
+	record, err := r.ReadIncludingDeleted(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !isDeleted(record) {
+		return errs.New(errs.InvalidState, "%s with %s %s must be deleted before it is purged", r.Kind, r.IDName, id).With("kind", r.Kind).With("id", id)
+	}
+
+	return r.Delete(ctx, id)
+}
+
+// All returns every record of the repository except the soft deleted ones
+func (r Repository[T]) All(ctx contractapi.TransactionContextInterface) ([]*T, error) {
+	records, err := r.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return filter(records, false), nil
+}
+
+// Deleted returns the soft deleted records of the repository
+func (r Repository[T]) Deleted(ctx contractapi.TransactionContextInterface) ([]*T, error) {
+	records, err := r.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return filter(records, true), nil
+}
+
+// scan returns every record of the repository, soft deleted or not
+func (r Repository[T]) scan(ctx contractapi.TransactionContextInterface) ([]*T, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(r.ObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var records []*T
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record T
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+
+	return records, nil
+}
+
+// filter returns the records that are soft deleted, or those that are not
+func filter[T any](records []*T, deleted bool) []*T {
+	var kept []*T
+	for _, record := range records {
+		if isDeleted(record) == deleted {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// Page returns up to pageSize records starting at bookmark. Pass an empty bookmark for
+// the first page and the returned bookmark for the next. Soft deleted records are left
+// out, so a page may hold fewer records than FetchedRecordsCount.
+func (r Repository[T]) Page(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*Page[T], error) {
+	if pageSize <= 0 {
+		return nil, errs.New(errs.ValidationFailed, "page size must be positive, got %d", pageSize).With("pageSize", pageSize)
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(r.ObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	page := Page[T]{Records: []*T{}}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record T
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, err
+		}
+		if !isDeleted(&record) {
+			page.Records = append(page.Records, &record)
+		}
+	}
+	page.FetchedRecordsCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+
+	return &page, nil
+}
+
+// Query returns the records matching a CouchDB rich query, except the soft deleted ones
+func (r Repository[T]) Query(ctx contractapi.TransactionContextInterface, query string) ([]*T, error) {
+	_, records, err := r.query(ctx, query)
+	return records, err
+}
+
+// QueryIDs returns the IDs of the records matching a CouchDB rich query, except the soft
+// deleted ones, e.g. for records that do not hold their own ID. Run MigrateKeys first.
+func (r Repository[T]) QueryIDs(ctx contractapi.TransactionContextInterface, query string) ([]string, error) {
+	keys, _, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := ctx.GetStub().CreateCompositeKey(r.ObjectType, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, key := range keys {
+		// Splitting a key that is not a composite one panics
+		if !strings.HasPrefix(key, prefix) {
+			return nil, fmt.Errorf("%s record under key %q has no %s in its key", r.Kind, key, r.IDName)
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(key)
+		if err != nil || len(attributes) != 1 {
+			return nil, fmt.Errorf("%s record under key %q has no %s in its key", r.Kind, key, r.IDName)
+		}
+		ids = append(ids, attributes[0])
+	}
+	return ids, nil
+}
+
+// query returns the keys and records matching a CouchDB rich query, except the soft
+// deleted ones
+func (r Repository[T]) query(ctx contractapi.TransactionContextInterface, query string) ([]string, []*T, error) {
+	resultsIterator, err := ctx.GetStub().GetQueryResult(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultsIterator.Close()
+
+	var keys []string
+	var records []*T
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var record T
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !isDeleted(&record) {
+			keys = append(keys, queryResponse.Key)
+			records = append(records, &record)
+		}
+	}
+
+	return keys, records, nil
+}
+
+// History returns every committed version of the record with the given ID, newest first
+func (r Repository[T]) History(ctx contractapi.TransactionContextInterface, id string) ([]*Version[T], error) {
+	key, err := r.Key(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var history []*Version[T]
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		version := Version[T]{
+			TxID:      modification.TxId,
+			Timestamp: modification.Timestamp.AsTime().UTC().Format(time.RFC3339Nano),
+			IsDelete:  modification.IsDelete,
+		}
+		if !modification.IsDelete {
+			var record T
+			err = json.Unmarshal(modification.Value, &record)
+			if err != nil {
+				return nil, err
+			}
+			version.Record = &record
+		}
+		history = append(history, &version)
+	}
+
+	return history, nil
+}
+
+// MigrateKeys moves records stored under bare keys, as written before composite keys
+// were introduced, to their composite keys. It returns how many records were moved.
+func (r Repository[T]) MigrateKeys(ctx contractapi.TransactionContextInterface) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		key, err := r.Key(ctx, queryResponse.Key)
+		if err != nil {
+			return 0, err
+		}
+		existing, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if existing != nil {
+			return 0, fmt.Errorf("%s with %s %s exists under both its bare and composite key", r.Kind, r.IDName, queryResponse.Key)
+		}
+
+		err = ctx.GetStub().PutState(key, queryResponse.Value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to put to world state: %v", err)
+		}
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete bare key %s: %v", queryResponse.Key, err)
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
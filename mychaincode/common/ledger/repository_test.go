@@ -0,0 +1,309 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+
+	"common/chaincodetest"
+	"common/errs"
+)
+
+type widget struct {
+	ID   string `json:"id"`
+	Size int    `json:"size"`
+}
+
+var widgets = Repository[widget]{ObjectType: "widget~id", Kind: "widget", IDName: "ID"}
+
+func putWidgets(t *testing.T, ctx *chaincodetest.Context, ids ...string) {
+	t.Helper()
+	for i, id := range ids {
+		if err := widgets.Put(ctx, id, &widget{ID: id, Size: i + 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadWriteDelete(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+
+	exists, err := widgets.Exists(ctx, "W1")
+	if err != nil || exists {
+		t.Fatalf("Exists before Put = %v, %v", exists, err)
+	}
+	putWidgets(t, ctx, "W1")
+
+	exists, err = widgets.Exists(ctx, "W1")
+	if err != nil || !exists {
+		t.Fatalf("Exists after Put = %v, %v", exists, err)
+	}
+	got, err := widgets.Read(ctx, "W1")
+	if err != nil || *got != (widget{ID: "W1", Size: 1}) {
+		t.Fatalf("Read = %+v, %v", got, err)
+	}
+
+	key, err := widgets.Key(ctx, "W1")
+	if err != nil || key != "\x00widget~id\x00W1\x00" {
+		t.Errorf("Key = %q, %v", key, err)
+	}
+
+	if err := widgets.Delete(ctx, "W1"); err != nil {
+		t.Fatalf("Delete = %v", err)
+	}
+	var notFound *errs.NotFoundError
+	if _, err := widgets.Read(ctx, "W1"); !errors.As(err, &notFound) {
+		t.Errorf("Read after Delete = %v, want a NotFoundError", err)
+	}
+	err = widgets.Delete(ctx, "W1")
+	if !errors.As(err, &notFound) || errs.From(err).Message != "widget with ID W1 does not exist" {
+		t.Errorf("Delete of a missing widget = %v, want a NotFoundError", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	want := `{"code":"NOT_FOUND","message":"widget with ID W9 does not exist","details":{"id":"W9","kind":"widget"}}`
+	if got := widgets.NotFound("W9").Error(); got != want {
+		t.Errorf("NotFound = %s, want %s", got, want)
+	}
+	want = `{"code":"ALREADY_EXISTS","message":"widget with ID W9 already exists","details":{"id":"W9","kind":"widget"}}`
+	if got := widgets.AlreadyExists("W9").Error(); got != want {
+		t.Errorf("AlreadyExists = %s, want %s", got, want)
+	}
+}
+
+func TestAllAndPage(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	putWidgets(t, ctx, "W1", "W2", "W3")
+	// Records of other object types are not included
+	if err := ctx.Stub.PutState("W9", []byte(`{"id":"W9"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := widgets.All(ctx)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("All = %d records, %v; want 3", len(all), err)
+	}
+
+	first, err := widgets.Page(ctx, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.FetchedRecordsCount != 2 || first.Records[0].ID != "W1" || first.Records[1].ID != "W2" || first.Bookmark == "" {
+		t.Fatalf("first page = %+v", first)
+	}
+	second, err := widgets.Page(ctx, 2, first.Bookmark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.FetchedRecordsCount != 1 || second.Records[0].ID != "W3" || second.Bookmark != "" {
+		t.Fatalf("second page = %+v", second)
+	}
+
+	if _, err := widgets.Page(ctx, 0, ""); err == nil {
+		t.Error("Page with page size 0 succeeded")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	putWidgets(t, ctx, "W1", "W2", "W3")
+
+	got, err := widgets.Query(ctx, `{"selector":{"size":{"$gte":2}}}`)
+	if err != nil || len(got) != 2 || got[0].ID != "W2" || got[1].ID != "W3" {
+		t.Errorf("Query = %v, %v", got, err)
+	}
+	if _, err := widgets.Query(ctx, `{"selector":{"size":{"$regex":"1"}}}`); err == nil {
+		t.Error("Query with an unsupported operator succeeded")
+	}
+
+	ids, err := widgets.QueryIDs(ctx, `{"selector":{"size":{"$lt":3}}}`)
+	if err != nil || len(ids) != 2 || ids[0] != "W1" || ids[1] != "W2" {
+		t.Errorf("QueryIDs = %v, %v", ids, err)
+	}
+	// A record under a key from before MigrateKeys has no ID to report
+	if err := ctx.Stub.PutState("W9", []byte(`{"id":"W9","size":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := widgets.QueryIDs(ctx, `{"selector":{"size":1}}`); err == nil {
+		t.Errorf("QueryIDs over a legacy key = %v, want an error", ids)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	putWidgets(t, ctx, "W1")
+	ctx = ctx.Next(ctx.Client)
+	if err := widgets.Put(ctx, "W1", &widget{ID: "W1", Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(ctx.Client)
+	if err := widgets.Delete(ctx, "W1"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := widgets.History(ctx, "W1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("History has %d versions, want 3", len(history))
+	}
+	if !history[0].IsDelete || history[0].Record != nil || history[0].TxID != "tx3" {
+		t.Errorf("newest version = %+v", history[0])
+	}
+	if history[1].Record.Size != 5 || history[1].Timestamp != "2024-01-01T00:01:00Z" {
+		t.Errorf("second version = %+v", history[1])
+	}
+	if history[2].Record.Size != 1 || history[2].TxID != "tx1" {
+		t.Errorf("oldest version = %+v", history[2])
+	}
+}
+
+type gadget struct {
+	ID string `json:"id"`
+	Metadata
+}
+
+var gadgets = Repository[gadget]{ObjectType: "gadget~id", Kind: "gadget", IDName: "ID"}
+
+func TestMetadata(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	if err := gadgets.Put(ctx, "G1", &gadget{ID: "G1"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(chaincodetest.NewClient("InsuranceMSP"))
+	// The version the client sends is ignored, Put counts on from the stored one
+	if err := gadgets.Put(ctx, "G1", &gadget{ID: "G1", Metadata: Metadata{Version: 7}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := gadgets.Read(ctx, "G1")
+	want := Metadata{
+		Version:           2,
+		LastModifiedTxID:  "tx2",
+		LastModifiedAt:    "2024-01-01T00:01:00Z",
+		LastModifiedBy:    "x509::CN=user1::InsuranceMSP",
+		LastModifiedByMSP: "InsuranceMSP",
+	}
+	if err != nil || got.Metadata != want {
+		t.Fatalf("Read = %+v, %v, want metadata %+v", got, err, want)
+	}
+
+	if err := gadgets.CheckVersion("G1", got, 2); err != nil {
+		t.Errorf("CheckVersion of the current version = %v", err)
+	}
+	if err := gadgets.CheckVersion("G1", got, 0); err != nil {
+		t.Errorf("CheckVersion without an expected version = %v", err)
+	}
+	var conflict *errs.ConflictError
+	if err := gadgets.CheckVersion("G1", got, 1); !errors.As(err, &conflict) || conflict.Actual != 2 {
+		t.Errorf("CheckVersion of a stale version = %v, want a ConflictError", err)
+	}
+
+	// Records without Metadata are written as they are
+	putWidgets(t, ctx, "W1")
+	if err := widgets.CheckVersion("W1", &widget{ID: "W1"}, 1); err == nil {
+		t.Error("CheckVersion of an unversioned record succeeded")
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	for _, id := range []string{"G1", "G2"} {
+		if err := gadgets.Put(ctx, id, &gadget{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx = ctx.Next(chaincodetest.NewClient("InsuranceMSP"))
+	if _, err := gadgets.SoftDelete(ctx, "G1", ""); errs.From(err).Code != errs.ValidationFailed {
+		t.Errorf("SoftDelete without a reason = %v, want VALIDATION_FAILED", err)
+	}
+	deleted, err := gadgets.SoftDelete(ctx, "G1", "duplicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted.Deleted || deleted.DeletedReason != "duplicate" || deleted.DeletedBy != "x509::CN=user1::InsuranceMSP" ||
+		deleted.DeletedAt != "2024-01-01T00:01:00Z" || deleted.Version != 2 {
+		t.Errorf("deleted gadget = %+v", deleted)
+	}
+
+	var notFound *errs.NotFoundError
+	if _, err := gadgets.Read(ctx, "G1"); !errors.As(err, &notFound) {
+		t.Errorf("Read of a deleted gadget = %v, want a NotFoundError", err)
+	}
+	if _, err := gadgets.SoftDelete(ctx, "G1", "again"); !errors.As(err, &notFound) {
+		t.Errorf("SoftDelete of a deleted gadget = %v, want a NotFoundError", err)
+	}
+	if exists, _ := gadgets.Exists(ctx, "G1"); !exists {
+		t.Error("Exists of a deleted gadget = false, want true so that its ID is not reused")
+	}
+	if got, err := gadgets.ReadIncludingDeleted(ctx, "G1"); err != nil || !got.Deleted {
+		t.Errorf("ReadIncludingDeleted = %+v, %v", got, err)
+	}
+	if all, _ := gadgets.All(ctx); len(all) != 1 || all[0].ID != "G2" {
+		t.Errorf("All = %+v, want only G2", all)
+	}
+	if gone, _ := gadgets.Deleted(ctx); len(gone) != 1 || gone[0].ID != "G1" {
+		t.Errorf("Deleted = %+v, want only G1", gone)
+	}
+	if page, _ := gadgets.Page(ctx, 10, ""); len(page.Records) != 1 || page.Records[0].ID != "G2" {
+		t.Errorf("Page = %+v, want only G2", page.Records)
+	}
+	if found, _ := gadgets.Query(ctx, `{"selector":{}}`); len(found) != 1 || found[0].ID != "G2" {
+		t.Errorf("Query = %+v, want only G2", found)
+	}
+
+	if err := gadgets.Purge(ctx, "G2"); errs.From(err).Code != errs.InvalidState {
+		t.Errorf("Purge of a live gadget = %v, want INVALID_STATE", err)
+	}
+	if _, err := gadgets.Restore(ctx, "G2"); errs.From(err).Code != errs.InvalidState {
+		t.Errorf("Restore of a live gadget = %v, want INVALID_STATE", err)
+	}
+
+	ctx = ctx.Next(ctx.Client)
+	restored, err := gadgets.Restore(ctx, "G1")
+	if err != nil || restored.Deleted || restored.DeletedReason != "" || restored.Version != 3 {
+		t.Errorf("Restore = %+v, %v", restored, err)
+	}
+	if _, err := gadgets.Read(ctx, "G1"); err != nil {
+		t.Errorf("Read of a restored gadget = %v", err)
+	}
+
+	if _, err := gadgets.SoftDelete(ctx, "G1", "duplicate"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gadgets.Purge(ctx, "G1"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := gadgets.Exists(ctx, "G1"); exists {
+		t.Error("Exists of a purged gadget = true")
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	putWidgets(t, ctx, "W1")
+	if err := ctx.Stub.PutState("W2", []byte(`{"id":"W2","size":2}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := widgets.MigrateKeys(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateKeys = %d, %v; want 1", migrated, err)
+	}
+	if value, _ := ctx.Stub.GetState("W2"); value != nil {
+		t.Error("bare key W2 still exists")
+	}
+	if got, err := widgets.Read(ctx, "W2"); err != nil || got.Size != 2 {
+		t.Errorf("Read after migration = %+v, %v", got, err)
+	}
+
+	// A record under both keys is a conflict the migration refuses to resolve
+	if err := ctx.Stub.PutState("W1", []byte(`{"id":"W1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := widgets.MigrateKeys(ctx); err == nil {
+		t.Error("MigrateKeys with W1 under both keys succeeded")
+	}
+}
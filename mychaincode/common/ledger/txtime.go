@@ -0,0 +1,18 @@
+package ledger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// TxTime returns the timestamp the client set on the current transaction, in UTC. Unlike
+// the peer's clock it is the same on every endorser, so it is safe to compute with.
+func TxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	return timestamp.AsTime().UTC(), nil
+}
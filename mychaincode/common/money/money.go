@@ -0,0 +1,173 @@
+// Package money represents amounts as integer minor units with a currency code.
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is assumed when an amount is given without a currency code
+const DefaultCurrency = "INR"
+
+// Money is an amount in minor currency units (paise for INR), kept as an integer so
+// that sums are exact and the JSON is identical on every peer
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// UnmarshalJSON accepts both the {"amount", "currency"} form and a plain JSON number,
+// which is how amounts were stored before they were kept in minor units
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var legacy float64
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		*m, err = FromFloat(legacy)
+		return err
+	}
+
+	type money Money
+	var value money
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*m = Money(value)
+	return nil
+}
+
+// String formats an amount as "INR 500.50"
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s %s%d.%02d", m.Currency, sign, amount/100, amount%100)
+}
+
+// Add returns the sum of two amounts. A zero Money takes the other amount's currency.
+// Sums that do not fit in an int64 of minor units fail.
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := commonCurrency(m, other)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, fmt.Errorf("%s + %s is out of range", m, other)
+	}
+	return Money{Amount: sum, Currency: currency}, nil
+}
+
+// Sub returns the difference of two amounts. A zero Money takes the other amount's currency.
+// Differences that do not fit in an int64 of minor units fail.
+func (m Money) Sub(other Money) (Money, error) {
+	currency, err := commonCurrency(m, other)
+	if err != nil {
+		return Money{}, err
+	}
+	difference := m.Amount - other.Amount
+	if (other.Amount > 0 && difference > m.Amount) || (other.Amount < 0 && difference < m.Amount) {
+		return Money{}, fmt.Errorf("%s - %s is out of range", m, other)
+	}
+	return Money{Amount: difference, Currency: currency}, nil
+}
+
+// Mul returns the amount multiplied by a quantity. Products that do not fit in an int64
+// of minor units fail.
+func (m Money) Mul(quantity int) (Money, error) {
+	factor := int64(quantity)
+	product := m.Amount * factor
+	if m.Amount != 0 && (product/m.Amount != factor || (m.Amount == -1 && factor == math.MinInt64)) {
+		return Money{}, fmt.Errorf("%s * %d is out of range", m, quantity)
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// commonCurrency returns the currency two amounts can be combined in
+func commonCurrency(a Money, b Money) (string, error) {
+	switch {
+	case a.Currency == b.Currency:
+		return a.Currency, nil
+	case a.Currency == "" && a.Amount == 0:
+		return b.Currency, nil
+	case b.Currency == "" && b.Amount == 0:
+		return a.Currency, nil
+	}
+	return "", fmt.Errorf("cannot combine amounts in %s and %s", a.Currency, b.Currency)
+}
+
+// Parse parses an amount such as "500.50", "500" or "INR 500.50" with at most
+// two decimal places. Amounts without a currency code are in DefaultCurrency. Amounts
+// that do not fit in an int64 of minor units fail.
+func Parse(value string) (Money, error) {
+	currency := DefaultCurrency
+	number := strings.TrimSpace(value)
+	if fields := strings.Fields(number); len(fields) == 2 {
+		currency = strings.ToUpper(fields[0])
+		number = fields[1]
+	}
+	if len(currency) != 3 {
+		return Money{}, fmt.Errorf("invalid currency code in amount %q", value)
+	}
+
+	negative := strings.HasPrefix(number, "-")
+	number = strings.TrimPrefix(number, "-")
+	whole, fraction, point := strings.Cut(number, ".")
+	if whole == "" || (point && fraction == "") || len(fraction) > 2 {
+		return Money{}, fmt.Errorf("invalid amount %q: expected a number with at most two decimal places", value)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	major, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q: %v", value, err)
+	}
+	minor, err := strconv.ParseUint(fraction, 10, 8)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q: %v", value, err)
+	}
+	if major > (math.MaxInt64-minor)/100 {
+		return Money{}, fmt.Errorf("invalid amount %q: too large", value)
+	}
+
+	amount := int64(major*100 + minor)
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// FromFloat converts a legacy floating point amount in DefaultCurrency, rounding
+// to the nearest minor unit. Amounts that do not fit in an int64 of minor units fail.
+func FromFloat(value float64) (Money, error) {
+	minor := math.Round(value * 100)
+	// float64(math.MaxInt64) rounds up to 2^63, which itself is out of range
+	if math.IsNaN(minor) || minor >= math.MaxInt64 || minor < math.MinInt64 {
+		return Money{}, fmt.Errorf("amount %v is out of range", value)
+	}
+	return Money{Amount: int64(minor), Currency: DefaultCurrency}, nil
+}
+
+// HasLegacyAmount reports whether any of the named fields of a JSON record still holds
+// a plain number rather than a Money object
+func HasLegacyAmount(recordJSON []byte, fields ...string) (bool, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(recordJSON, &record); err != nil {
+		return false, err
+	}
+	for _, field := range fields {
+		raw := strings.TrimSpace(string(record[field]))
+		if raw != "" && raw != "null" && !strings.HasPrefix(raw, "{") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,185 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Money
+	}{
+		{"500", Money{Amount: 50000, Currency: "INR"}},
+		{"500.5", Money{Amount: 50050, Currency: "INR"}},
+		{"500.50", Money{Amount: 50050, Currency: "INR"}},
+		{" 0.07 ", Money{Amount: 7, Currency: "INR"}},
+		{"-12.34", Money{Amount: -1234, Currency: "INR"}},
+		{"usd 10.00", Money{Amount: 1000, Currency: "USD"}},
+		{"INR 1200.75", Money{Amount: 120075, Currency: "INR"}},
+		{"92233720368547758.07", Money{Amount: math.MaxInt64, Currency: "INR"}},
+		{"-92233720368547758.07", Money{Amount: -math.MaxInt64, Currency: "INR"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "1.234", ".50", "500.", "1.x", "1.-5", "92233720368547758.08", "100000000000000000", "18446744073709551616", "RUPEES 10", "IN 10", "INR 10 extra"} {
+		if got, err := Parse(value); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := map[Money]string{
+		{Amount: 50050, Currency: "INR"}: "INR 500.50",
+		{Amount: 7, Currency: "INR"}:     "INR 0.07",
+		{Amount: -1234, Currency: "USD"}: "USD -12.34",
+	}
+	for m, want := range tests {
+		if got := m.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a := Money{Amount: 1000, Currency: "INR"}
+	b := Money{Amount: 250, Currency: "INR"}
+
+	sum, err := a.Add(b)
+	if err != nil || sum != (Money{Amount: 1250, Currency: "INR"}) {
+		t.Errorf("Add = %v, %v", sum, err)
+	}
+	diff, err := b.Sub(a)
+	if err != nil || diff != (Money{Amount: -750, Currency: "INR"}) {
+		t.Errorf("Sub = %v, %v", diff, err)
+	}
+	if got, err := b.Mul(3); err != nil || got != (Money{Amount: 750, Currency: "INR"}) {
+		t.Errorf("Mul = %v, %v", got, err)
+	}
+
+	// A zero amount without a currency takes the other one's
+	sum, err = Money{}.Add(b)
+	if err != nil || sum != b {
+		t.Errorf("zero Add = %v, %v", sum, err)
+	}
+	diff, err = a.Sub(Money{})
+	if err != nil || diff != a {
+		t.Errorf("Sub zero = %v, %v", diff, err)
+	}
+
+	_, err = a.Add(Money{Amount: 1, Currency: "USD"})
+	if err == nil {
+		t.Error("adding INR and USD succeeded")
+	}
+	_, err = a.Sub(Money{Amount: 1, Currency: "USD"})
+	if err == nil {
+		t.Error("subtracting USD from INR succeeded")
+	}
+}
+
+func TestArithmeticOverflow(t *testing.T) {
+	largest := Money{Amount: math.MaxInt64, Currency: "INR"}
+	smallest := Money{Amount: math.MinInt64, Currency: "INR"}
+	one := Money{Amount: 1, Currency: "INR"}
+
+	if got, err := largest.Add(one); err == nil {
+		t.Errorf("MaxInt64 + 1 = %v, want an error", got)
+	}
+	if got, err := smallest.Add(Money{Amount: -1, Currency: "INR"}); err == nil {
+		t.Errorf("MinInt64 + -1 = %v, want an error", got)
+	}
+	if got, err := smallest.Sub(one); err == nil {
+		t.Errorf("MinInt64 - 1 = %v, want an error", got)
+	}
+	if got, err := one.Sub(smallest); err == nil {
+		t.Errorf("1 - MinInt64 = %v, want an error", got)
+	}
+	for _, quantity := range []int{2, -2, math.MaxInt64} {
+		if got, err := largest.Mul(quantity); err == nil {
+			t.Errorf("MaxInt64 * %d = %v, want an error", quantity, got)
+		}
+	}
+	if got, err := (Money{Amount: -1, Currency: "INR"}).Mul(math.MinInt64); err == nil {
+		t.Errorf("-1 * MinInt64 = %v, want an error", got)
+	}
+	if got, err := smallest.Mul(-1); err == nil {
+		t.Errorf("MinInt64 * -1 = %v, want an error", got)
+	}
+
+	// Results right at the limits are fine
+	if got, err := largest.Sub(one); err != nil || got.Amount != math.MaxInt64-1 {
+		t.Errorf("MaxInt64 - 1 = %v, %v", got, err)
+	}
+	if got, err := (Money{Amount: math.MaxInt64 / 2, Currency: "INR"}).Mul(2); err != nil || got.Amount != math.MaxInt64-1 {
+		t.Errorf("MaxInt64/2 * 2 = %v, %v", got, err)
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	if got, err := FromFloat(1200.755); err != nil || got != (Money{Amount: 120076, Currency: "INR"}) {
+		t.Errorf("FromFloat(1200.755) = %v, %v", got, err)
+	}
+	for _, value := range []float64{1e17, -1e17, math.Inf(1), math.NaN()} {
+		if got, err := FromFloat(value); err == nil {
+			t.Errorf("FromFloat(%v) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var record struct {
+		New    Money `json:"new"`
+		Legacy Money `json:"legacy"`
+		Null   Money `json:"null"`
+	}
+	err := json.Unmarshal([]byte(`{"new":{"amount":50050,"currency":"USD"},"legacy":1200.755,"null":null}`), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.New != (Money{Amount: 50050, Currency: "USD"}) {
+		t.Errorf("new = %v", record.New)
+	}
+	if record.Legacy != (Money{Amount: 120076, Currency: "INR"}) {
+		t.Errorf("legacy = %v", record.Legacy)
+	}
+	if record.Null != (Money{}) {
+		t.Errorf("null = %v", record.Null)
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`"500"`), &m); err == nil {
+		t.Error("unmarshalling a string succeeded")
+	}
+	if err := json.Unmarshal([]byte(`1e300`), &m); err == nil {
+		t.Errorf("unmarshalling an out of range legacy amount = %v, want an error", m)
+	}
+}
+
+func TestHasLegacyAmount(t *testing.T) {
+	tests := []struct {
+		record string
+		want   bool
+	}{
+		{`{"claimLimit":100000,"alreadyClaimed":{"amount":0,"currency":"INR"}}`, true},
+		{`{"claimLimit":{"amount":1,"currency":"INR"},"alreadyClaimed":{"amount":0,"currency":"INR"}}`, false},
+		{`{"claimLimit":null}`, false},
+		{`{"name":"John"}`, false},
+	}
+	for _, tt := range tests {
+		got, err := HasLegacyAmount([]byte(tt.record), "claimLimit", "alreadyClaimed")
+		if err != nil || got != tt.want {
+			t.Errorf("HasLegacyAmount(%s) = %v, %v; want %v", tt.record, got, err, tt.want)
+		}
+	}
+
+	if _, err := HasLegacyAmount([]byte(`[1]`), "claimLimit"); err == nil {
+		t.Error("HasLegacyAmount of a JSON array succeeded")
+	}
+}
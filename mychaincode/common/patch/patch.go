@@ -0,0 +1,70 @@
+// Package patch merges partial updates into stored records. A patch is a JSON object
+// holding only the fields to change, named as in the record's JSON encoding.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"common/errs"
+	"common/validation"
+)
+
+// Apply merges patchJSON into record, a pointer to a struct, leaving the fields the patch
+// does not mention as they are. The fixed fields, such as the record's ID, may not be
+// patched. A patch that is not a JSON object, or that names fixed or unknown fields, sets
+// a field to null or gives it a value of the wrong type fails with VALIDATION_FAILED.
+func Apply(record interface{}, patchJSON []byte, fixed ...string) error {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(patchJSON, &fields)
+	if err != nil || fields == nil {
+		return errs.New(errs.ValidationFailed, "a patch must be a JSON object of the fields to change")
+	}
+	if len(fields) == 0 {
+		return errs.New(errs.ValidationFailed, "a patch must change at least one field")
+	}
+
+	var v validation.Validator
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if string(fields[name]) == "null" {
+			v.Fail(name, "must not be null")
+		}
+		for _, fixedName := range fixed {
+			// encoding/json matches field names case-insensitively
+			if strings.EqualFold(name, fixedName) {
+				v.Fail(name, "cannot be changed")
+			}
+		}
+	}
+	err = v.Err()
+	if err != nil {
+		return err
+	}
+
+	// Each field is decoded on its own so that every error names the field it is about
+	for _, name := range names {
+		field, _ := json.Marshal(map[string]json.RawMessage{name: fields[name]})
+		decoder := json.NewDecoder(bytes.NewReader(field))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(record)
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case err == nil:
+		case errors.As(err, &typeErr):
+			v.Fail(name, "must not be a JSON %s", typeErr.Value)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			v.Fail(name, "is not a field of the record")
+		default:
+			v.AddError(name, err)
+		}
+	}
+	return v.Err()
+}
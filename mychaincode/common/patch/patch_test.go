@@ -0,0 +1,61 @@
+package patch
+
+import (
+	"errors"
+	"testing"
+
+	"common/errs"
+	"common/money"
+	"common/validation"
+)
+
+type widget struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Count int         `json:"count"`
+	Price money.Money `json:"price"`
+}
+
+func TestApply(t *testing.T) {
+	record := widget{ID: "W1", Name: "Bolt", Count: 3, Price: money.Money{Amount: 100, Currency: money.DefaultCurrency}}
+	err := Apply(&record, []byte(`{"count": 5, "price": {"amount": 250, "currency": "INR"}}`), "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := widget{ID: "W1", Name: "Bolt", Count: 5, Price: money.Money{Amount: 250, Currency: money.DefaultCurrency}}
+	if record != want {
+		t.Errorf("patched record = %+v, want %+v", record, want)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		patch string
+		field string // of the single field error, if any
+	}{
+		{`[1, 2]`, ""},
+		{`null`, ""},
+		{`{}`, ""},
+		{`{"id": "W2"}`, "id"},
+		{`{"ID": "W2"}`, "ID"},
+		{`{"name": null}`, "name"},
+		{`{"colour": "red"}`, "colour"},
+		{`{"count": "five"}`, "count"},
+		{`{"price": "a lot"}`, "price"},
+	}
+	for _, tt := range tests {
+		record := widget{ID: "W1", Name: "Bolt"}
+		err := Apply(&record, []byte(tt.patch), "id")
+		if errs.From(err).Code != errs.ValidationFailed {
+			t.Errorf("Apply(%s) = %v, want VALIDATION_FAILED", tt.patch, err)
+			continue
+		}
+		var fieldErrors validation.Errors
+		if tt.field != "" && (!errors.As(err, &fieldErrors) || len(fieldErrors) != 1 || fieldErrors[0].Field != tt.field) {
+			t.Errorf("Apply(%s) = %v, want an error for %s", tt.patch, err, tt.field)
+		}
+		if record.ID != "W1" {
+			t.Errorf("Apply(%s) changed the ID to %s", tt.patch, record.ID)
+		}
+	}
+}
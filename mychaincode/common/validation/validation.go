@@ -0,0 +1,177 @@
+// Package validation checks the inputs of chaincode transactions. A Validator collects
+// every invalid field, so that a client learns about all of them from a single call.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"common/aadhaar"
+	"common/errs"
+)
+
+// DateLayout is the format all dates on the ledger are stored in
+const DateLayout = "2006-01-02"
+
+// FieldError describes why the value of a single field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Errors lists every invalid field of an input. Clients get them as a VALIDATION_FAILED
+// errs.Error whose "fields" detail holds the FieldErrors.
+type Errors []FieldError
+
+func (e Errors) Coded() *errs.Error {
+	messages := make([]string, len(e))
+	for i, fieldError := range e {
+		messages[i] = fieldError.Error()
+	}
+	return errs.New(errs.ValidationFailed, "invalid input: %s", strings.Join(messages, "; ")).With("fields", []FieldError(e))
+}
+
+func (e Errors) Error() string {
+	return e.Coded().Error()
+}
+
+// Validator collects field errors. The zero value is ready to use.
+type Validator struct {
+	errors Errors
+}
+
+// Fail records that field is invalid for the given reason
+func (v *Validator) Fail(field string, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// AddError records err, if any, as the reason field is invalid. It is meant for the
+// errors of parsers such as money.Parse.
+func (v *Validator) AddError(field string, err error) {
+	if err != nil {
+		v.Fail(field, "%v", err)
+	}
+}
+
+// Required checks that value is not blank
+func (v *Validator) Required(field string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Fail(field, "must not be empty")
+		return false
+	}
+	return true
+}
+
+// OneOf checks that value is one of the allowed values
+func (v *Validator) OneOf(field string, value string, allowed ...string) {
+	for _, option := range allowed {
+		if value == option {
+			return
+		}
+	}
+	v.Fail(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// Between checks that value lies within min and max, inclusive
+func (v *Validator) Between(field string, value int, min int, max int) {
+	if value < min || value > max {
+		v.Fail(field, "must be between %d and %d, got %d", min, max, value)
+	}
+}
+
+// Digits checks that value consists of exactly n digits
+func (v *Validator) Digits(field string, value string, n int) bool {
+	if len(value) != n || strings.Trim(value, "0123456789") != "" {
+		v.Fail(field, "must be exactly %d digits", n)
+		return false
+	}
+	return true
+}
+
+// Aadhaar checks that value is a valid Aadhaar number, see aadhaar.Parse
+func (v *Validator) Aadhaar(field string, value string) {
+	_, err := aadhaar.Parse(value)
+	var parseErr *aadhaar.ParseError
+	if errors.As(err, &parseErr) {
+		v.Fail(field, "%s", parseErr.Reason)
+	}
+}
+
+// Email checks that value is a plain e-mail address
+func (v *Validator) Email(field string, value string) {
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		v.Fail(field, "must be an e-mail address")
+	}
+}
+
+// Date checks that value is a date in DateLayout and returns it
+func (v *Validator) Date(field string, value string) (time.Time, bool) {
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		v.Fail(field, "must be a date in YYYY-MM-DD format, got %q", value)
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// DateOrder checks that both values are dates and that the second one is not before the first
+func (v *Validator) DateOrder(fromField string, from string, toField string, to string) {
+	fromDate, fromOK := v.Date(fromField, from)
+	toDate, toOK := v.Date(toField, to)
+	if fromOK && toOK && toDate.Before(fromDate) {
+		v.Fail(toField, "must not be before %s", fromField)
+	}
+}
+
+// DateOfBirth checks that value is a date that is neither after today nor more than 150
+// years before it, and returns the age on today
+func (v *Validator) DateOfBirth(field string, value string, today time.Time) (int, bool) {
+	dob, ok := v.Date(field, value)
+	if !ok {
+		return 0, false
+	}
+	if dob.After(today) {
+		v.Fail(field, "must not be in the future")
+		return 0, false
+	}
+	age := AgeOn(dob, today)
+	if age > 150 {
+		v.Fail(field, "must be at most 150 years ago")
+		return 0, false
+	}
+	return age, true
+}
+
+// Age checks that a submitted age matches the one derived from the date of birth. An age
+// of 0 counts as not submitted.
+func (v *Validator) Age(field string, submitted int, derived int) {
+	if submitted != 0 && submitted != derived {
+		v.Fail(field, "must be %d to match the date of birth, got %d", derived, submitted)
+	}
+}
+
+// AgeOn returns the age in completed years on date of someone born on dob. Someone born
+// on 29 February turns a year older on 1 March in common years.
+func AgeOn(dob time.Time, date time.Time) int {
+	age := date.Year() - dob.Year()
+	if date.Month() < dob.Month() || (date.Month() == dob.Month() && date.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
+
+// Err returns the collected field errors as Errors, or nil if there are none
+func (v *Validator) Err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
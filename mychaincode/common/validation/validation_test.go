@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"common/errs"
+)
+
+func TestValidatorCollectsEveryError(t *testing.T) {
+	var v Validator
+	v.Required("name", " ")
+	v.OneOf("gender", "Unknown", "Male", "Female")
+	v.Between("age", 200, 0, 150)
+	v.Digits("phoneNumber", "12345", 10)
+	v.Aadhaar("aadharNumber", "234567890123")
+	v.Email("emailID", "John <john@example.com>")
+	v.Date("dob", "01-01-1990")
+	v.AddError("amount", errors.New("bad amount"))
+
+	var fieldErrors Errors
+	if !errors.As(v.Err(), &fieldErrors) {
+		t.Fatalf("Err() = %v, want Errors", v.Err())
+	}
+	want := []string{"name", "gender", "age", "phoneNumber", "aadharNumber", "emailID", "dob", "amount"}
+	if len(fieldErrors) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(fieldErrors), len(want), fieldErrors)
+	}
+	for i, field := range want {
+		if fieldErrors[i].Field != field {
+			t.Errorf("error %d is for %s, want %s", i, fieldErrors[i].Field, field)
+		}
+	}
+	if fieldErrors[4].Message != "has an invalid check digit" {
+		t.Errorf("aadharNumber message = %q", fieldErrors[4].Message)
+	}
+}
+
+func TestValidatorAcceptsValidInput(t *testing.T) {
+	var v Validator
+	if !v.Required("name", "John") {
+		t.Error("Required rejected a name")
+	}
+	v.OneOf("gender", "Male", "Male", "Female")
+	v.Between("age", 150, 0, 150)
+	if !v.Digits("phoneNumber", "0987654321", 10) {
+		t.Error("Digits rejected a phone number")
+	}
+	v.Aadhaar("aadharNumber", "234567890124")
+	v.Email("emailID", "john@example.com")
+	if date, ok := v.Date("dob", "1990-01-31"); !ok || date.Day() != 31 {
+		t.Errorf("Date = %v, %v", date, ok)
+	}
+	v.DateOrder("admissionDate", "2023-10-01", "releaseDate", "2023-10-01")
+	v.AddError("amount", nil)
+
+	if err := v.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestDateOrder(t *testing.T) {
+	var v Validator
+	v.DateOrder("startDate", "2024-01-01", "endDate", "2023-01-01")
+	want := "invalid input: endDate must not be before startDate"
+	if err := v.Err(); err == nil || errs.From(err).Message != want {
+		t.Errorf("Err() = %v, want %s", err, want)
+	}
+
+	// An unparsable date is reported once, without an ordering error
+	v = Validator{}
+	v.DateOrder("startDate", "2024-01-01", "endDate", "someday")
+	if err := v.Err(); err == nil || len(err.(Errors)) != 1 || err.(Errors)[0].Field != "endDate" {
+		t.Errorf("Err() = %v, want a single endDate error", err)
+	}
+}
+
+func TestDateOfBirth(t *testing.T) {
+	today := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		dob     string
+		age     int
+		message string
+	}{
+		{dob: "1990-03-15", age: 34},
+		{dob: "1990-03-16", age: 33},
+		{dob: "2024-03-15", age: 0},
+		{dob: "2024-03-16", message: "must not be in the future"},
+		{dob: "1873-03-15", message: "must be at most 150 years ago"},
+		{dob: "15/03/1990", message: `must be a date in YYYY-MM-DD format, got "15/03/1990"`},
+	}
+	for _, test := range tests {
+		var v Validator
+		age, ok := v.DateOfBirth("dob", test.dob, today)
+		if test.message == "" {
+			if !ok || age != test.age || v.Err() != nil {
+				t.Errorf("DateOfBirth(%s) = %d, %v, %v, want %d", test.dob, age, ok, v.Err(), test.age)
+			}
+			continue
+		}
+		if ok || v.Err() == nil || v.Err().(Errors)[0].Message != test.message {
+			t.Errorf("DateOfBirth(%s) = %v, %v, want %q", test.dob, ok, v.Err(), test.message)
+		}
+	}
+}
+
+func TestAge(t *testing.T) {
+	var v Validator
+	v.Age("age", 0, 34)
+	v.Age("age", 34, 34)
+	if err := v.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+
+	v.Age("age", 30, 34)
+	want := "invalid input: age must be 34 to match the date of birth, got 30"
+	if err := v.Err(); err == nil || errs.From(err).Message != want {
+		t.Errorf("Err() = %v, want %s", err, want)
+	}
+}
+
+func TestAgeOn(t *testing.T) {
+	leapling := time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		date time.Time
+		age  int
+	}{
+		{time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC), 22},
+		{time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), 23},
+		{time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), 24},
+	}
+	for _, test := range tests {
+		if age := AgeOn(leapling, test.date); age != test.age {
+			t.Errorf("AgeOn(%s) = %d, want %d", test.date.Format(DateLayout), age, test.age)
+		}
+	}
+}
+
+func TestErrorsAreCoded(t *testing.T) {
+	var v Validator
+	v.Required("name", "")
+	v.Digits("phoneNumber", "123", 10)
+
+	want := `{"code":"VALIDATION_FAILED","message":"invalid input: name must not be empty; phoneNumber must be exactly 10 digits",` +
+		`"details":{"fields":[{"field":"name","message":"must not be empty"},{"field":"phoneNumber","message":"must be exactly 10 digits"}]}}`
+	if got := v.Err().Error(); got != want {
+		t.Errorf("Err() = %s, want %s", got, want)
+	}
+}
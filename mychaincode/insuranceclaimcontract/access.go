@@ -0,0 +1,21 @@
+package main
+
+import (
+	"common/access"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// authorizeTransition checks that the submitting client may move a claim to the given status
+func authorizeTransition(ctx contractapi.TransactionContextInterface, function string, status string) error {
+	switch status {
+	case StatusSubmitted, StatusWithdrawn:
+		return access.Authorize(ctx, function, access.HealthcareMSP, access.TPAMSP)
+	case StatusUnderReview, StatusQueryRaised:
+		return access.Authorize(ctx, function, access.TPAMSP, access.InsuranceMSP)
+	case StatusApproved, StatusRejected:
+		return access.AuthorizeRole(ctx, function, access.AdjudicatorRole, access.InsuranceMSP)
+	default:
+		return access.Authorize(ctx, function, access.InsuranceMSP)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"common/access"
+	"common/errs"
+	"common/events"
+	"common/invoke"
+	"common/money"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// treatmentServiceCode is the service code of the line item a claim gets by default,
+// covering the whole billed amount of its treatment
+const treatmentServiceCode = "TREATMENT"
+
+// maxLineItemQuantity is the largest quantity of a service a line item may bill
+const maxLineItemQuantity = 10000
+
+// LineItem is a single billed service on a claim. ApprovedPrice is the per-unit price
+// the insurer accepted and defaults to UnitPrice.
+type LineItem struct {
+	ServiceCode   string      `json:"serviceCode"`
+	Description   string      `json:"description,omitempty" metadata:",optional"`
+	Quantity      int         `json:"quantity"`
+	UnitPrice     money.Money `json:"unitPrice"`
+	ApprovedPrice money.Money `json:"approvedPrice"`
+}
+
+// Disallowance records the part of a line item the insurer refused to pay and why
+type Disallowance struct {
+	ServiceCode string      `json:"serviceCode"`
+	ReasonCode  string      `json:"reasonCode"`
+	Amount      money.Money `json:"amount"`
+}
+
+// defaultLineItems returns the single line item a claim starts with, billing the
+// treatment's full amount
+func defaultLineItems(billingAmount money.Money) []LineItem {
+	return []LineItem{
+		{
+			ServiceCode:   treatmentServiceCode,
+			Description:   "Billed treatment",
+			Quantity:      1,
+			UnitPrice:     billingAmount,
+			ApprovedPrice: billingAmount,
+		},
+	}
+}
+
+// recomputeAmounts derives the requested and disallowed amounts of a claim from its
+// line items and disallowances
+func recomputeAmounts(claim *InsuranceClaim) error {
+	var requested money.Money
+	for _, item := range claim.LineItems {
+		price, err := item.UnitPrice.Mul(item.Quantity)
+		if err != nil {
+			return err
+		}
+		total, err := requested.Add(price)
+		if err != nil {
+			return err
+		}
+		requested = total
+	}
+
+	disallowed := money.Money{Currency: requested.Currency}
+	for _, disallowance := range claim.Disallowances {
+		total, err := disallowed.Add(disallowance.Amount)
+		if err != nil {
+			return err
+		}
+		disallowed = total
+	}
+
+	claim.RequestedAmount = requested
+	claim.DisallowedAmount = disallowed
+	return nil
+}
+
+// SetClaimLineItems replaces the itemized bill of a claim that has not yet been picked up
+// for review, clearing any earlier disallowances. The line items may not total more than
+// the billing amount of the claim's treatment.
+func (s *InsuranceClaimContract) SetClaimLineItems(ctx contractapi.TransactionContextInterface, claimID string, lineItems []LineItem) error {
+	err := access.Authorize(ctx, "SetClaimLineItems", access.HealthcareMSP, access.TPAMSP)
+	if err != nil {
+		return err
+	}
+
+	claim, err := claimRepository.Read(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if claim.Status != StatusSubmitted && claim.Status != StatusQueryRaised {
+		return errs.New(errs.InvalidState, "line items of claim with ID %s cannot be changed in status %s", claimID, claim.Status).
+			With("claimID", claimID).With("status", claim.Status)
+	}
+	if len(lineItems) == 0 {
+		return errs.New(errs.ValidationFailed, "claim with ID %s must have at least one line item", claimID).With("claimID", claimID)
+	}
+
+	seen := make(map[string]bool)
+	for i := range lineItems {
+		item := &lineItems[i]
+		if item.ServiceCode == "" {
+			return errs.New(errs.ValidationFailed, "line item %d has no service code", i+1).With("lineItem", i+1)
+		}
+		if seen[item.ServiceCode] {
+			return errs.New(errs.ValidationFailed, "service code %s appears on more than one line item", item.ServiceCode).
+				With("serviceCode", item.ServiceCode)
+		}
+		seen[item.ServiceCode] = true
+		if item.Quantity <= 0 || item.Quantity > maxLineItemQuantity {
+			return errs.New(errs.ValidationFailed, "line item %s must have a positive quantity of at most %d", item.ServiceCode, maxLineItemQuantity).
+				With("serviceCode", item.ServiceCode)
+		}
+		if item.UnitPrice.Amount < 0 {
+			return errs.New(errs.ValidationFailed, "line item %s must not have a negative unit price", item.ServiceCode).
+				With("serviceCode", item.ServiceCode)
+		}
+		item.ApprovedPrice = item.UnitPrice
+	}
+
+	claim.LineItems = lineItems
+	claim.Disallowances = nil
+	err = recomputeAmounts(claim)
+	if err != nil {
+		return errs.New(errs.ValidationFailed, "%v", err).With("claimID", claimID)
+	}
+
+	var treatment treatmentRecord
+	err = invoke.Chaincode(ctx, invoke.TreatmentChaincode, &treatment, "ReadTreatmentRecord", claim.TreatmentID)
+	if err != nil {
+		return err
+	}
+	excess, err := claim.RequestedAmount.Sub(treatment.BillingAmount)
+	if err != nil {
+		return errs.New(errs.ValidationFailed, "%v", err).With("claimID", claimID)
+	}
+	if excess.Amount > 0 {
+		return errs.New(errs.ValidationFailed, "line items of claim with ID %s total %s, more than the %s billed for treatment %s", claimID, claim.RequestedAmount, treatment.BillingAmount, claim.TreatmentID).
+			With("claimID", claimID).With("treatmentID", claim.TreatmentID)
+	}
+
+	err = claimRepository.Put(ctx, claim.ClaimID, claim)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventClaimLineItemsChanged, claimID, claim.Status, claim.Status)
+}
+
+// DisallowLineItem lowers the approved unit price of a line item on a claim under review
+// and records the shortfall against the given reason code. approvedPrice is parsed with
+// money.Parse.
+func (s *InsuranceClaimContract) DisallowLineItem(
+	ctx contractapi.TransactionContextInterface,
+	claimID string,
+	serviceCode string,
+	approvedPrice string,
+	reasonCode string,
+) error {
+	err := access.AuthorizeRole(ctx, "DisallowLineItem", access.AdjudicatorRole, access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	price, err := money.Parse(approvedPrice)
+	if err != nil {
+		var v validation.Validator
+		v.AddError("approvedPrice", err)
+		return v.Err()
+	}
+
+	claim, err := claimRepository.Read(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if claim.Status != StatusUnderReview {
+		return errs.New(errs.InvalidState, "line items of claim with ID %s can only be adjudicated while %s, not %s", claimID, StatusUnderReview, claim.Status).
+			With("claimID", claimID).With("status", claim.Status)
+	}
+	if reasonCode == "" {
+		return errs.New(errs.ValidationFailed, "a reason code is required to disallow part of line item %s", serviceCode).
+			With("serviceCode", serviceCode)
+	}
+
+	var item *LineItem
+	for i := range claim.LineItems {
+		if claim.LineItems[i].ServiceCode == serviceCode {
+			item = &claim.LineItems[i]
+		}
+	}
+	if item == nil {
+		return errs.New(errs.NotFound, "claim with ID %s has no line item %s", claimID, serviceCode).
+			With("claimID", claimID).With("serviceCode", serviceCode)
+	}
+	shortfall, err := item.UnitPrice.Sub(price)
+	if err != nil {
+		var v validation.Validator
+		v.AddError("approvedPrice", err)
+		return v.Err()
+	}
+	if price.Amount < 0 || shortfall.Amount <= 0 {
+		return errs.New(errs.ValidationFailed, "approved price for line item %s must be at least 0 and below its unit price %s", serviceCode, item.UnitPrice).
+			With("serviceCode", serviceCode).With("unitPrice", item.UnitPrice.String())
+	}
+	disallowed, err := shortfall.Mul(item.Quantity)
+	if err != nil {
+		return errs.New(errs.ValidationFailed, "%v", err).With("serviceCode", serviceCode)
+	}
+	item.ApprovedPrice = price
+
+	disallowances := []Disallowance{}
+	for _, disallowance := range claim.Disallowances {
+		if disallowance.ServiceCode != serviceCode {
+			disallowances = append(disallowances, disallowance)
+		}
+	}
+	claim.Disallowances = append(disallowances, Disallowance{
+		ServiceCode: serviceCode,
+		ReasonCode:  reasonCode,
+		Amount:      disallowed,
+	})
+	err = recomputeAmounts(claim)
+	if err != nil {
+		return err
+	}
+
+	err = claimRepository.Put(ctx, claim.ClaimID, claim)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventClaimLineItemsChanged, claimID, claim.Status, claim.Status)
+}
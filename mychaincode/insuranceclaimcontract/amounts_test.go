@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"common/chaincodetest"
+	"common/errs"
+)
+
+func sampleLineItems() []LineItem {
+	return []LineItem{
+		{ServiceCode: "ROOM", Description: "Room, per night", Quantity: 4, UnitPrice: chaincodetest.INR(100000)},
+		{ServiceCode: "MEDS", Quantity: 1, UnitPrice: chaincodetest.INR(25050)},
+	}
+}
+
+// billedNetwork returns the chaincodes of newNetwork with TREATMENT1 billed at the
+// total of sampleLineItems
+func billedNetwork() *network {
+	n := newNetwork()
+	treatment := n.treatments["TREATMENT1"]
+	treatment.BillingAmount = chaincodetest.INR(425050)
+	n.treatments["TREATMENT1"] = treatment
+	return n
+}
+
+func TestSetClaimLineItems(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(billedNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.SetClaimLineItems(ctx, "CLAIM1", sampleLineItems()); err != nil {
+		t.Fatal(err)
+	}
+	claim := readClaim(t, ctx, "CLAIM1")
+	if claim.RequestedAmount != chaincodetest.INR(425050) || claim.DisallowedAmount.Amount != 0 || len(claim.LineItems) != 2 {
+		t.Errorf("claim = %+v", claim)
+	}
+	for _, item := range claim.LineItems {
+		if item.ApprovedPrice != item.UnitPrice {
+			t.Errorf("line item %s approved at %s, want its unit price %s", item.ServiceCode, item.ApprovedPrice, item.UnitPrice)
+		}
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventClaimLineItemsChanged || event.NewStatus != StatusSubmitted {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestSetClaimLineItemsErrors(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(billedNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	tests := []struct {
+		name    string
+		items   func() []LineItem
+		message string
+	}{
+		{"no line items", func() []LineItem { return nil }, "at least one line item"},
+		{"no service code", func() []LineItem { items := sampleLineItems(); items[1].ServiceCode = ""; return items }, "line item 2 has no service code"},
+		{"a repeated service code", func() []LineItem { items := sampleLineItems(); items[1].ServiceCode = "ROOM"; return items }, "ROOM appears on more than one"},
+		{"a zero quantity", func() []LineItem { items := sampleLineItems(); items[0].Quantity = 0; return items }, "ROOM must have a positive quantity"},
+		{"too large a quantity", func() []LineItem {
+			items := sampleLineItems()
+			items[0].Quantity = maxLineItemQuantity + 1
+			return items
+		}, "ROOM must have a positive quantity of at most 10000"},
+		// Wrapped around, these would total less than the bill
+		{"an overflowing line item", func() []LineItem {
+			items := sampleLineItems()
+			items[0].Quantity = 2
+			items[0].UnitPrice = chaincodetest.INR(math.MaxInt64/2 + 1)
+			return items
+		}, "is out of range"},
+		{"an overflowing total", func() []LineItem {
+			items := sampleLineItems()
+			items[0].Quantity = 1
+			items[0].UnitPrice = chaincodetest.INR(math.MaxInt64)
+			return items
+		}, "is out of range"},
+		{"a negative price", func() []LineItem {
+			items := sampleLineItems()
+			items[1].UnitPrice = chaincodetest.INR(-1)
+			return items
+		}, "MEDS must not have a negative unit price"},
+		{"mixed currencies", func() []LineItem {
+			items := sampleLineItems()
+			items[1].UnitPrice.Currency = "USD"
+			return items
+		}, "cannot combine amounts in INR and USD"},
+		{"a total above the bill", func() []LineItem {
+			items := sampleLineItems()
+			items[1].UnitPrice = chaincodetest.INR(25051)
+			return items
+		}, "total INR 4250.51, more than the INR 4250.50 billed for treatment TREATMENT1"},
+		{"a bill in another currency", func() []LineItem {
+			items := sampleLineItems()
+			for i := range items {
+				items[i].UnitPrice.Currency = "USD"
+			}
+			return items
+		}, "cannot combine amounts in USD and INR"},
+	}
+	for _, tt := range tests {
+		err := contract.SetClaimLineItems(ctx, "CLAIM1", tt.items())
+		if err == nil || !strings.Contains(errs.From(err).Message, tt.message) {
+			t.Errorf("SetClaimLineItems with %s = %v, want an error containing %q", tt.name, err, tt.message)
+		}
+	}
+
+	var notFound *errs.NotFoundError
+	if err := contract.SetClaimLineItems(ctx, "CLAIM9", sampleLineItems()); !errors.As(err, &notFound) {
+		t.Errorf("SetClaimLineItems of a missing claim = %v, want a NotFoundError", err)
+	}
+
+	var denied *errs.PermissionError
+	ctx.Client = chaincodetest.Insurer
+	if err := contract.SetClaimLineItems(ctx, "CLAIM1", sampleLineItems()); !errors.As(err, &denied) {
+		t.Errorf("SetClaimLineItems by the insurer = %v, want a PermissionError", err)
+	}
+
+	// Once under review the bill is fixed
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+	err := contract.SetClaimLineItems(ctx, "CLAIM1", sampleLineItems())
+	if err == nil || !strings.Contains(errs.From(err).Message, "cannot be changed in status UnderReview") {
+		t.Errorf("SetClaimLineItems of a claim under review = %v", err)
+	}
+}
+
+func TestDisallowLineItem(t *testing.T) {
+	n := billedNetwork()
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(n, chaincodetest.Hospital), "CLAIM1")
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.SetClaimLineItems(ctx, "CLAIM1", sampleLineItems()); err != nil {
+		t.Fatal(err)
+	}
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+
+	// Only INR 800.00 of the INR 1000.00 room rate is covered, over all four nights
+	ctx = ctx.Next(chaincodetest.Adjudicator)
+	if err := contract.DisallowLineItem(ctx, "CLAIM1", "ROOM", "800", "ROOM_RATE_CAP"); err != nil {
+		t.Fatal(err)
+	}
+	claim := readClaim(t, ctx, "CLAIM1")
+	if claim.DisallowedAmount != chaincodetest.INR(80000) || claim.LineItems[0].ApprovedPrice != chaincodetest.INR(80000) {
+		t.Errorf("claim = %+v", claim)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventClaimLineItemsChanged || event.NewStatus != StatusUnderReview {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Adjudicating the same line item again replaces its disallowance
+	if err := contract.DisallowLineItem(ctx, "CLAIM1", "ROOM", "900", "ROOM_RATE_CAP"); err != nil {
+		t.Fatal(err)
+	}
+	claim = readClaim(t, ctx, "CLAIM1")
+	if len(claim.Disallowances) != 1 || claim.DisallowedAmount != chaincodetest.INR(40000) {
+		t.Errorf("disallowances = %+v, total %s", claim.Disallowances, claim.DisallowedAmount)
+	}
+
+	ctx = moveClaim(t, ctx, chaincodetest.Adjudicator, "CLAIM1", approve)
+	if claim := readClaim(t, ctx, "CLAIM1"); claim.ApprovedAmount != chaincodetest.INR(385050) {
+		t.Errorf("approved amount = %s, want the requested amount less disallowances", claim.ApprovedAmount)
+	}
+	if len(n.debits) != 1 || n.debits[0] != "INS123456 INR 3850.50" {
+		t.Errorf("debits = %v", n.debits)
+	}
+}
+
+func TestDisallowLineItemErrors(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	ctx.Client = chaincodetest.Adjudicator
+	err := contract.DisallowLineItem(ctx, "CLAIM1", treatmentServiceCode, "100", "NOT_COVERED")
+	if err == nil || !strings.Contains(errs.From(err).Message, "can only be adjudicated while UnderReview") {
+		t.Errorf("DisallowLineItem of a submitted claim = %v", err)
+	}
+
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+	ctx.Client = chaincodetest.Adjudicator
+	tests := []struct {
+		name, serviceCode, price, reason, message string
+	}{
+		{"an unparsable price", treatmentServiceCode, "free", "NOT_COVERED", "invalid amount"},
+		{"no reason", treatmentServiceCode, "100", "", "a reason code is required"},
+		{"a missing line item", "XRAY", "100", "NOT_COVERED", "has no line item XRAY"},
+		{"a negative price", treatmentServiceCode, "-1", "NOT_COVERED", "must be at least 0 and below its unit price"},
+		{"the full price", treatmentServiceCode, "500.50", "NOT_COVERED", "must be at least 0 and below its unit price"},
+		{"another currency", treatmentServiceCode, "USD 1", "NOT_COVERED", "cannot combine amounts"},
+	}
+	for _, tt := range tests {
+		err := contract.DisallowLineItem(ctx, "CLAIM1", tt.serviceCode, tt.price, tt.reason)
+		if err == nil || !strings.Contains(errs.From(err).Message, tt.message) {
+			t.Errorf("DisallowLineItem with %s = %v, want an error containing %q", tt.name, err, tt.message)
+		}
+	}
+
+	var notFound *errs.NotFoundError
+	if err := contract.DisallowLineItem(ctx, "CLAIM9", treatmentServiceCode, "100", "NOT_COVERED"); !errors.As(err, &notFound) {
+		t.Errorf("DisallowLineItem of a missing claim = %v, want a NotFoundError", err)
+	}
+
+	var denied *errs.PermissionError
+	for _, client := range []*chaincodetest.ClientIdentity{chaincodetest.TPA, chaincodetest.Insurer.WithAttribute("role", "clerk")} {
+		ctx.Client = client
+		if err := contract.DisallowLineItem(ctx, "CLAIM1", treatmentServiceCode, "100", "NOT_COVERED"); !errors.As(err, &denied) {
+			t.Errorf("DisallowLineItem by %s = %v, want a PermissionError", client.MSPID, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"common/claimstatus"
+	"common/errs"
+)
+
+// Claim statuses making up the claim lifecycle
+const (
+	StatusSubmitted   = claimstatus.Submitted
+	StatusUnderReview = claimstatus.UnderReview
+	StatusQueryRaised = claimstatus.QueryRaised
+	StatusApproved    = claimstatus.Approved
+	StatusRejected    = claimstatus.Rejected
+	StatusWithdrawn   = claimstatus.Withdrawn
+	StatusSettled     = claimstatus.Settled
+	StatusClosed      = claimstatus.Closed
+)
+
+// claimTransitions lists the statuses a claim may move to from each status
+var claimTransitions = map[string][]string{
+	StatusSubmitted:   {StatusUnderReview, StatusWithdrawn},
+	StatusUnderReview: {StatusApproved, StatusRejected, StatusQueryRaised, StatusWithdrawn},
+	StatusQueryRaised: {StatusSubmitted, StatusWithdrawn},
+	StatusApproved:    {StatusSettled},
+	StatusRejected:    {StatusClosed},
+	StatusWithdrawn:   {StatusClosed},
+	StatusSettled:     {StatusClosed},
+	StatusClosed:      {},
+}
+
+// TransitionError is returned when a claim is moved to a status its current status does not allow
+type TransitionError struct {
+	ClaimID string
+	From    string
+	To      string
+}
+
+func (e *TransitionError) Coded() *errs.Error {
+	return errs.New(errs.InvalidState, "claim with ID %s cannot move from status %q to %q", e.ClaimID, e.From, e.To).
+		With("claimID", e.ClaimID).With("from", e.From).With("to", e.To)
+}
+
+func (e *TransitionError) Error() string {
+	return e.Coded().Error()
+}
+
+// isKnownStatus reports whether status is part of the claim lifecycle
+func isKnownStatus(status string) bool {
+	_, ok := claimTransitions[status]
+	return ok
+}
+
+// unknownStatus returns the error reported for a status that is not part of the claim lifecycle
+func unknownStatus(status string) error {
+	return errs.New(errs.ValidationFailed, "unknown claim status %q", status).With("status", status)
+}
+
+// checkTransition returns a *TransitionError if a claim may not move from one status to the other
+func checkTransition(claimID string, from string, to string) error {
+	for _, next := range claimTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return &TransitionError{ClaimID: claimID, From: from, To: to}
+}
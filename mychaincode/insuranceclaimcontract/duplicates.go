@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"common/access"
+	"common/errs"
+	"common/invoke"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// treatmentIndex is the object type of the composite keys indexing claims by treatment,
+// treatment~claim with the treatment ID and the claim ID. The keys hold no value of their
+// own, and unlike a CouchDB index they work with any state database.
+const treatmentIndex = "treatment~claim"
+
+// similarAmountPercent is how far apart, in percent of the larger one, the requested
+// amounts of two claims may be for FindPotentialDuplicateClaims to call them similar
+const similarAmountPercent = 10
+
+// holdsTreatment reports whether the claim still stands for its treatment, so that no
+// other claim may be filed for it: it was neither rejected nor withdrawn, nor closed
+// after either, which leaves nothing approved.
+func (c *InsuranceClaim) holdsTreatment() bool {
+	switch c.Status {
+	case StatusRejected, StatusWithdrawn:
+		return false
+	case StatusClosed:
+		return c.ApprovedAmount.Amount > 0
+	}
+	return true
+}
+
+// indexClaim adds a claim to the treatment index
+func indexClaim(ctx contractapi.TransactionContextInterface, treatmentID string, claimID string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(treatmentIndex, []string{treatmentID, claimID})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte{0x00})
+}
+
+// unindexClaim removes a claim from the treatment index
+func unindexClaim(ctx contractapi.TransactionContextInterface, treatmentID string, claimID string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(treatmentIndex, []string{treatmentID, claimID})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+// checkTreatmentUnclaimed fails with ALREADY_EXISTS if a claim other than claimID holds
+// the treatment. Soft deleted claims do not count.
+func checkTreatmentUnclaimed(ctx contractapi.TransactionContextInterface, treatmentID string, claimID string) error {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(treatmentIndex, []string{treatmentID})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		_, keys, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+		otherID := keys[1]
+		if otherID == claimID {
+			continue
+		}
+
+		other, err := claimRepository.Read(ctx, otherID)
+		var notFound *errs.NotFoundError
+		if errors.As(err, &notFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if other.holdsTreatment() {
+			return errs.New(errs.AlreadyExists, "treatment %s is already claimed by claim %s in status %s", treatmentID, otherID, other.Status).
+				With("treatmentID", treatmentID).With("claimID", otherID).With("status", other.Status)
+		}
+	}
+
+	return nil
+}
+
+// MigrateClaimIndex adds the claims filed before the treatment index existed to it,
+// soft deleted ones included, returning how many claims were indexed. Run MigrateKeys first.
+func (s *InsuranceClaimContract) MigrateClaimIndex(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigrateClaimIndex", access.InsuranceMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	claims, err := claimRepository.All(ctx)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := claimRepository.Deleted(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, claim := range append(claims, deleted...) {
+		err = indexClaim(ctx, claim.TreatmentID, claim.ClaimID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(claims) + len(deleted), nil
+}
+
+// PotentialDuplicate is a claim that may duplicate the one FindPotentialDuplicateClaims
+// was asked about, along with the reasons it was flagged
+type PotentialDuplicate struct {
+	Claim   *InsuranceClaim `json:"claim"`
+	Reasons []string        `json:"reasons"`
+}
+
+// Reasons a claim is flagged as a potential duplicate
+const (
+	ReasonSameTreatment        = "same treatment"
+	ReasonOverlappingAdmission = "overlapping admission"
+	ReasonSameHospital         = "same hospital"
+	ReasonSimilarAmount        = "similar amount"
+)
+
+// FindPotentialDuplicateClaims returns the other claims of the same patient that may
+// duplicate the given claim: those for the same treatment, and those for a treatment
+// whose stay overlaps the claim's, either in the same hospital or for a requested amount
+// within 10% of the claim's. Like the queries in queries.go it needs CouchDB.
+func (s *InsuranceClaimContract) FindPotentialDuplicateClaims(ctx contractapi.TransactionContextInterface, claimID string) ([]*PotentialDuplicate, error) {
+	claim, err := claimRepository.Read(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := queryClaims(ctx, map[string]string{"patientID": claim.PatientID}, "indexPatient")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each claim's treatment, nil if it is no longer readable
+	treatments := map[string]*treatmentRecord{}
+	for _, c := range append([]*InsuranceClaim{claim}, candidates...) {
+		if _, ok := treatments[c.TreatmentID]; ok {
+			continue
+		}
+		var treatment treatmentRecord
+		err := invoke.Chaincode(ctx, invoke.TreatmentChaincode, &treatment, "ReadTreatmentRecord", c.TreatmentID)
+		if err != nil && errs.From(err).Code != errs.NotFound {
+			return nil, err
+		}
+		if err == nil {
+			treatments[c.TreatmentID] = &treatment
+		} else {
+			treatments[c.TreatmentID] = nil
+		}
+	}
+
+	var duplicates []*PotentialDuplicate
+	for _, candidate := range candidates {
+		if candidate.ClaimID == claimID {
+			continue
+		}
+		if candidate.TreatmentID == claim.TreatmentID {
+			duplicates = append(duplicates, &PotentialDuplicate{Claim: candidate, Reasons: []string{ReasonSameTreatment}})
+			continue
+		}
+
+		treatment, other := treatments[claim.TreatmentID], treatments[candidate.TreatmentID]
+		if treatment == nil || other == nil || !treatment.overlaps(other) {
+			continue
+		}
+		reasons := []string{ReasonOverlappingAdmission}
+		if treatment.HospitalName == other.HospitalName {
+			reasons = append(reasons, ReasonSameHospital)
+		}
+		if similarAmounts(claim, candidate) {
+			reasons = append(reasons, ReasonSimilarAmount)
+		}
+		if len(reasons) > 1 {
+			duplicates = append(duplicates, &PotentialDuplicate{Claim: candidate, Reasons: reasons})
+		}
+	}
+
+	return duplicates, nil
+}
+
+// stay returns the days the patient was admitted for the treatment. A treatment without
+// a valid release date counts as a stay of its admission date alone.
+func (t *treatmentRecord) stay() (time.Time, time.Time, bool) {
+	admitted, err := time.Parse(validation.DateLayout, t.AdmissionDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	released, err := time.Parse(validation.DateLayout, t.ReleaseDate)
+	if err != nil || released.Before(admitted) {
+		released = admitted
+	}
+	return admitted, released, true
+}
+
+// overlaps reports whether the stays of two treatments have a day in common
+func (t *treatmentRecord) overlaps(other *treatmentRecord) bool {
+	admitted, released, ok := t.stay()
+	otherAdmitted, otherReleased, otherOK := other.stay()
+	return ok && otherOK && !admitted.After(otherReleased) && !otherAdmitted.After(released)
+}
+
+// similarAmounts reports whether two claims request amounts in the same currency within
+// similarAmountPercent of the larger one
+func similarAmounts(a *InsuranceClaim, b *InsuranceClaim) bool {
+	if a.RequestedAmount.Currency != b.RequestedAmount.Currency {
+		return false
+	}
+	larger, smaller := a.RequestedAmount.Amount, b.RequestedAmount.Amount
+	if smaller > larger {
+		larger, smaller = smaller, larger
+	}
+	return (larger-smaller)*100 <= larger*similarAmountPercent
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"common/chaincodetest"
+	"common/errs"
+)
+
+// indexed returns the IDs of the claims the treatment index holds for a treatment
+func indexed(t *testing.T, ctx *chaincodetest.Context, treatmentID string) []string {
+	t.Helper()
+	resultsIterator, err := ctx.Stub.GetStateByPartialCompositeKey(treatmentIndex, []string{treatmentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resultsIterator.Close()
+
+	var claimIDs []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, keys, err := ctx.Stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claimIDs = append(claimIDs, keys[1])
+	}
+	return claimIDs
+}
+
+func TestSecondClaimOnTreatment(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	err := contract.CreateClaim(ctx, "CLAIM2", "TREATMENT1", "PATIENT1", "234567890124", "INS123456")
+	if err == nil || errs.From(err).Code != errs.AlreadyExists || errs.From(err).Details["claimID"] != "CLAIM1" {
+		t.Fatalf("CreateClaim for a claimed treatment = %v, want %s naming CLAIM1", err, errs.AlreadyExists)
+	}
+
+	// Moving another claim onto the treatment is refused as well
+	ctx = createClaimFor(t, ctx, "CLAIM3", "TREATMENT3")
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.PatchClaim(ctx, "CLAIM3", `{"treatmentID": "TREATMENT1"}`, 0); err == nil || errs.From(err).Code != errs.AlreadyExists {
+		t.Errorf("PatchClaim onto a claimed treatment = %v, want %s", err, errs.AlreadyExists)
+	}
+
+	// Once the first claim is withdrawn the treatment may be claimed again
+	ctx = moveClaim(t, ctx, chaincodetest.Hospital, "CLAIM1", withdraw)
+	ctx = createClaim(t, ctx, "CLAIM2")
+	if got := indexed(t, ctx, "TREATMENT1"); strings.Join(got, ",") != "CLAIM1,CLAIM2" {
+		t.Errorf("claims indexed for TREATMENT1 = %v", got)
+	}
+
+	// A deleted claim gives up the treatment, and cannot be restored while another holds it
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.DeleteClaim(ctx, "CLAIM2", "filed twice"); err != nil {
+		t.Fatal(err)
+	}
+	ctx = createClaim(t, ctx, "CLAIM4")
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.RestoreClaim(ctx, "CLAIM2"); err == nil || errs.From(err).Code != errs.AlreadyExists {
+		t.Errorf("RestoreClaim of a claim whose treatment was claimed again = %v, want %s", err, errs.AlreadyExists)
+	}
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM4", review)
+	ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM4", reject)
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.RestoreClaim(ctx, "CLAIM2"); err != nil {
+		t.Errorf("RestoreClaim once the other claim is rejected = %v", err)
+	}
+
+	// Purging a claim drops it from the index
+	if err := contract.DeleteClaim(ctx, "CLAIM1", "withdrawn"); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Client = chaincodetest.InsurerAdmin
+	if err := contract.PurgeClaim(ctx, "CLAIM1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexed(t, ctx, "TREATMENT1"); strings.Join(got, ",") != "CLAIM2,CLAIM4" {
+		t.Errorf("claims indexed for TREATMENT1 after the purge = %v", got)
+	}
+}
+
+func TestReclaimDeletedClaimTreatment(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+	ctx = moveClaim(t, ctx, chaincodetest.Adjudicator, "CLAIM1", approve)
+
+	// An approved claim keeps its treatment: it cannot be deleted to free it for another claim
+	ctx = ctx.Next(chaincodetest.Insurer)
+	err := contract.DeleteClaim(ctx, "CLAIM1", "duplicate")
+	if coded := errs.From(err); err == nil || coded.Code != errs.InvalidState || coded.Details["status"] != StatusApproved {
+		t.Errorf("DeleteClaim of an approved claim = %v, want %s", err, errs.InvalidState)
+	}
+	ctx = ctx.Next(chaincodetest.Hospital)
+	err = contract.CreateClaim(ctx, "CLAIM2", "TREATMENT1", "PATIENT1", "234567890124", "INS123456")
+	if err == nil || errs.From(err).Code != errs.AlreadyExists {
+		t.Errorf("CreateClaim for the treatment of an approved claim = %v, want %s", err, errs.AlreadyExists)
+	}
+	for _, transition := range []func(*InsuranceClaimContract, *chaincodetest.Context, string) error{settle, closeClaim} {
+		ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", transition)
+		if err := contract.DeleteClaim(ctx, "CLAIM1", "duplicate"); err == nil || errs.From(err).Code != errs.InvalidState {
+			t.Errorf("DeleteClaim of a %s claim = %v, want %s", readClaim(t, ctx, "CLAIM1").Status, err, errs.InvalidState)
+		}
+	}
+
+	// A claim not yet decided may be deleted, and its treatment claimed again
+	ctx = createClaimFor(t, ctx, "CLAIM3", "TREATMENT3")
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.DeleteClaim(ctx, "CLAIM3", "filed for the wrong treatment"); err != nil {
+		t.Fatal(err)
+	}
+	ctx = createClaimFor(t, ctx, "CLAIM4", "TREATMENT3")
+	if got := indexed(t, ctx, "TREATMENT3"); strings.Join(got, ",") != "CLAIM3,CLAIM4" {
+		t.Errorf("claims indexed for TREATMENT3 = %v", got)
+	}
+}
+
+func TestHoldsTreatment(t *testing.T) {
+	tests := []struct {
+		status   string
+		approved int64
+		want     bool
+	}{
+		{StatusSubmitted, 0, true},
+		{StatusApproved, 100, true},
+		{StatusRejected, 0, false},
+		{StatusWithdrawn, 0, false},
+		{StatusClosed, 100, true},
+		{StatusClosed, 0, false},
+	}
+	for _, tt := range tests {
+		claim := &InsuranceClaim{Status: tt.status, ApprovedAmount: chaincodetest.INR(tt.approved)}
+		if got := claim.holdsTreatment(); got != tt.want {
+			t.Errorf("holdsTreatment of a %s claim with %d approved = %v, want %v", tt.status, tt.approved, got, tt.want)
+		}
+	}
+}
+
+func TestFindPotentialDuplicateClaims(t *testing.T) {
+	n := newNetwork()
+	n.treatments["TREATMENT1"] = treatmentRecord{PatientID: "PATIENT1", HospitalName: "City Hospital",
+		AdmissionDate: "2023-10-01", ReleaseDate: "2023-10-05", BillingAmount: chaincodetest.INR(50050)}
+	n.treatments["TREATMENT5"] = treatmentRecord{PatientID: "PATIENT1", HospitalName: "City Hospital",
+		AdmissionDate: "2023-10-03", ReleaseDate: "2023-10-04", BillingAmount: chaincodetest.INR(100)}
+	n.treatments["TREATMENT6"] = treatmentRecord{PatientID: "PATIENT1", HospitalName: "Lake Clinic",
+		AdmissionDate: "2023-10-05", BillingAmount: chaincodetest.INR(48000)}
+	n.treatments["TREATMENT7"] = treatmentRecord{PatientID: "PATIENT1", HospitalName: "Lake Clinic",
+		AdmissionDate: "2023-10-02", ReleaseDate: "2023-10-03", BillingAmount: chaincodetest.INR(100)}
+	n.treatments["TREATMENT8"] = treatmentRecord{PatientID: "PATIENT1", HospitalName: "Lake Clinic",
+		AdmissionDate: "2023-10-04", BillingAmount: chaincodetest.INR(50000)}
+	n.treatments["TREATMENT3"] = treatmentRecord{PatientID: "PATIENT1", HospitalName: "City Hospital",
+		AdmissionDate: "2023-11-20", BillingAmount: chaincodetest.INR(50050)}
+
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(n, chaincodetest.Hospital), "CLAIM1")
+	ctx = moveClaim(t, ctx, chaincodetest.Hospital, "CLAIM1", withdraw)
+	ctx = createClaim(t, ctx, "CLAIM2")
+	for _, treatmentID := range []string{"TREATMENT3", "TREATMENT5", "TREATMENT6", "TREATMENT7", "TREATMENT8"} {
+		ctx = createClaimFor(t, ctx, "CLAIM"+strings.TrimPrefix(treatmentID, "TREATMENT"), treatmentID)
+	}
+	// A treatment that can no longer be read is left out
+	delete(n.treatments, "TREATMENT8")
+
+	ctx = ctx.Next(chaincodetest.TPA)
+	duplicates, err := contract.FindPotentialDuplicateClaims(ctx, "CLAIM2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"CLAIM1": ReasonSameTreatment,
+		"CLAIM5": ReasonOverlappingAdmission + "," + ReasonSameHospital,
+		"CLAIM6": ReasonOverlappingAdmission + "," + ReasonSimilarAmount,
+	}
+	if len(duplicates) != len(want) {
+		t.Fatalf("FindPotentialDuplicateClaims = %d claims, want %v", len(duplicates), want)
+	}
+	for _, duplicate := range duplicates {
+		if reasons := strings.Join(duplicate.Reasons, ","); reasons != want[duplicate.Claim.ClaimID] {
+			t.Errorf("%s flagged for %q, want %q", duplicate.Claim.ClaimID, reasons, want[duplicate.Claim.ClaimID])
+		}
+		if duplicate.Claim.AadharNumber != "XXXX-XXXX-0124" {
+			t.Errorf("%s shows Aadhaar number %s to the TPA", duplicate.Claim.ClaimID, duplicate.Claim.AadharNumber)
+		}
+	}
+
+	duplicates, err = contract.FindPotentialDuplicateClaims(ctx, "CLAIM3")
+	if err != nil || len(duplicates) != 0 {
+		t.Errorf("FindPotentialDuplicateClaims of a claim with no overlap = %v, %v", duplicates, err)
+	}
+	var notFound *errs.NotFoundError
+	if _, err := contract.FindPotentialDuplicateClaims(ctx, "CLAIM9"); !errors.As(err, &notFound) {
+		t.Errorf("FindPotentialDuplicateClaims of a missing claim = %v, want a NotFoundError", err)
+	}
+}
+
+func TestMigrateClaimIndex(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+	// As filed before the index existed
+	if err := unindexClaim(ctx, "TREATMENT1", "CLAIM1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx = ctx.Next(chaincodetest.Insurer)
+	migrated, err := contract.MigrateClaimIndex(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateClaimIndex = %d, %v; want 1", migrated, err)
+	}
+	if got := indexed(t, ctx, "TREATMENT1"); len(got) != 1 || got[0] != "CLAIM1" {
+		t.Errorf("claims indexed for TREATMENT1 = %v", got)
+	}
+
+	ctx.Client = chaincodetest.TPA
+	var denied *errs.PermissionError
+	if _, err := contract.MigrateClaimIndex(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigrateClaimIndex by the TPA = %v, want a PermissionError", err)
+	}
+}
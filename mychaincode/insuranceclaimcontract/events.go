@@ -0,0 +1,13 @@
+package main
+
+// Chaincode event names. Every mutating transaction emits exactly one of them, with an
+// events.RecordEvent as payload. InitLedger and the migrations emit none.
+const (
+	EventClaimCreated          = "ClaimCreated"
+	EventClaimUpdated          = "ClaimUpdated"
+	EventClaimStatusChanged    = "ClaimStatusChanged"
+	EventClaimLineItemsChanged = "ClaimLineItemsChanged"
+	EventClaimDeleted          = "ClaimDeleted"
+	EventClaimRestored         = "ClaimRestored"
+	EventClaimPurged           = "ClaimPurged"
+)
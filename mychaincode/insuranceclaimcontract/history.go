@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// InsuranceClaimHistoryEntry is one committed version of a claim record
+type InsuranceClaimHistoryEntry struct {
+	TxID      string          `json:"txID"`
+	Timestamp string          `json:"timestamp"` // RFC 3339, UTC
+	IsDelete  bool            `json:"isDelete"`
+	Record    *InsuranceClaim `json:"record,omitempty" metadata:",optional"` // nil when the version is a deletion
+}
+
+// GetClaimHistory returns every committed version of a claim record
+func (s *InsuranceClaimContract) GetClaimHistory(ctx contractapi.TransactionContextInterface, claimID string) ([]*InsuranceClaimHistoryEntry, error) {
+	versions, err := claimRepository.History(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []*InsuranceClaimHistoryEntry
+	for _, version := range versions {
+		if version.Record != nil {
+			err = maskClaims(ctx, version.Record)
+			if err != nil {
+				return nil, err
+			}
+		}
+		history = append(history, &InsuranceClaimHistoryEntry{
+			TxID:      version.TxID,
+			Timestamp: version.Timestamp,
+			IsDelete:  version.IsDelete,
+			Record:    version.Record,
+		})
+	}
+
+	return history, nil
+}
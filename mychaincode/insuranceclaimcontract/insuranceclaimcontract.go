@@ -4,6 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"common/aadhaar"
+	"common/access"
+	"common/claimstatus"
+	"common/errs"
+	"common/events"
+	"common/invoke"
+	"common/ledger"
+	"common/money"
+	"common/patch"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -14,7 +26,28 @@ type InsuranceClaim struct {
 	PatientID       string `json:"patientID"`
 	AadharNumber    string `json:"aadharNumber"`
 	InsuranceNumber string `json:"insuranceNumber"`
-	Status          string `json:"status"` // e.g., Pending, Approved, Rejected
+	Status          string `json:"status"` // one of the Status* constants, see claimstatus.go
+
+	// Monetary amounts, see amounts.go
+	RequestedAmount  money.Money    `json:"requestedAmount"`
+	ApprovedAmount   money.Money    `json:"approvedAmount"`
+	DisallowedAmount money.Money    `json:"disallowedAmount"`
+	Disallowances    []Disallowance `json:"disallowances,omitempty" metadata:",optional"`
+	LineItems        []LineItem     `json:"lineItems,omitempty" metadata:",optional"`
+
+	ledger.Metadata
+}
+
+// validateClaim checks the identifying fields of a claim, reporting every invalid one.
+// Whether they refer to existing records is checked by validateClaimReferences.
+func validateClaim(claim *InsuranceClaim) error {
+	var v validation.Validator
+	v.Required("claimID", claim.ClaimID)
+	v.Required("treatmentID", claim.TreatmentID)
+	v.Required("patientID", claim.PatientID)
+	v.Aadhaar("aadharNumber", claim.AadharNumber)
+	v.Required("insuranceNumber", claim.InsuranceNumber)
+	return v.Err()
 }
 
 // InsuranceClaimContract provides functions for managing insurance claims
@@ -24,40 +57,57 @@ type InsuranceClaimContract struct {
 
 // InitLedger initializes the ledger with some sample data (optional)
 func (s *InsuranceClaimContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	err := access.Authorize(ctx, "InitLedger", access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
 	claims := []InsuranceClaim{
 		{
 			ClaimID:         "CLAIM1",
 			TreatmentID:     "TREATMENT1",
 			PatientID:       "PATIENT1",
-			AadharNumber:    "123456789012",
+			AadharNumber:    "234567890124",
 			InsuranceNumber: "INS123456",
-			Status:          "Pending",
+			Status:          StatusSubmitted,
+			RequestedAmount: money.Money{Amount: 50050, Currency: money.DefaultCurrency},
+			LineItems:       defaultLineItems(money.Money{Amount: 50050, Currency: money.DefaultCurrency}),
 		},
 		{
 			ClaimID:         "CLAIM2",
 			TreatmentID:     "TREATMENT2",
 			PatientID:       "PATIENT2",
-			AadharNumber:    "987654321098",
+			AadharNumber:    "987654321096",
 			InsuranceNumber: "INS654321",
-			Status:          "Approved",
+			Status:          StatusApproved,
+			RequestedAmount: money.Money{Amount: 120075, Currency: money.DefaultCurrency},
+			ApprovedAmount:  money.Money{Amount: 120075, Currency: money.DefaultCurrency},
+			LineItems:       defaultLineItems(money.Money{Amount: 120075, Currency: money.DefaultCurrency}),
 		},
 	}
 
 	for _, claim := range claims {
-		claimJSON, err := json.Marshal(claim)
+		err = claimRepository.Put(ctx, claim.ClaimID, &claim)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to put claim record: %v", err)
 		}
-		err = ctx.GetStub().PutState(claim.ClaimID, claimJSON)
+		err = indexClaim(ctx, claim.TreatmentID, claim.ClaimID)
 		if err != nil {
-			return fmt.Errorf("failed to put claim record: %v", err)
+			return err
 		}
 	}
 
 	return nil
 }
 
-// CreateClaim adds a new insurance claim to the ledger
+// CreateClaim adds a new insurance claim to the ledger. New claims always start as
+// Submitted and move on through the transition transactions below. The treatment,
+// patient and policy are looked up on their chaincodes and must exist and agree with the
+// claim, and the policy must have been in force on the treatment's admission date. A
+// treatment is claimed once: another claim for it fails with ALREADY_EXISTS unless the
+// earlier one was rejected or withdrawn. The claim is billed for the treatment's full
+// amount until itemized with SetClaimLineItems. Claims are filed by the hospitals, as
+// checking the claimant's Aadhaar number reads the patient's private details.
 func (s *InsuranceClaimContract) CreateClaim(
 	ctx contractapi.TransactionContextInterface,
 	claimID string,
@@ -65,14 +115,18 @@ func (s *InsuranceClaimContract) CreateClaim(
 	patientID string,
 	aadharNumber string,
 	insuranceNumber string,
-	status string,
 ) error {
-	exists, err := s.ClaimExists(ctx, claimID)
+	err := access.Authorize(ctx, "CreateClaim", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	exists, err := claimRepository.Exists(ctx, claimID)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("claim with ID %s already exists", claimID)
+		return claimRepository.AlreadyExists(claimID)
 	}
 
 	claim := InsuranceClaim{
@@ -81,37 +135,60 @@ func (s *InsuranceClaimContract) CreateClaim(
 		PatientID:       patientID,
 		AadharNumber:    aadharNumber,
 		InsuranceNumber: insuranceNumber,
-		Status:          status,
+		Status:          StatusSubmitted,
+	}
+	err = validateClaim(&claim)
+	if err != nil {
+		return err
+	}
+	err = checkTreatmentUnclaimed(ctx, treatmentID, claimID)
+	if err != nil {
+		return err
+	}
+	treatment, err := validateClaimReferences(ctx, &claim)
+	if err != nil {
+		return err
+	}
+	claim.LineItems = defaultLineItems(treatment.BillingAmount)
+	err = recomputeAmounts(&claim)
+	if err != nil {
+		return err
 	}
 
-	claimJSON, err := json.Marshal(claim)
+	err = claimRepository.Put(ctx, claim.ClaimID, &claim)
+	if err != nil {
+		return err
+	}
+	err = indexClaim(ctx, treatmentID, claimID)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(claimID, claimJSON)
+	return events.Emit(ctx, EventClaimCreated, claimID, "", claim.Status)
 }
 
-// ReadClaim retrieves an insurance claim by claimID
+// ReadClaim retrieves an insurance claim by claimID. The Aadhaar number is masked for
+// clients outside the hospitals and the insurer.
 func (s *InsuranceClaimContract) ReadClaim(ctx contractapi.TransactionContextInterface, claimID string) (*InsuranceClaim, error) {
-	claimJSON, err := ctx.GetStub().GetState(claimID)
+	claim, err := claimRepository.Read(ctx, claimID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if claimJSON == nil {
-		return nil, fmt.Errorf("claim with ID %s does not exist", claimID)
+		return nil, err
 	}
 
-	var claim InsuranceClaim
-	err = json.Unmarshal(claimJSON, &claim)
+	err = maskClaims(ctx, claim)
 	if err != nil {
 		return nil, err
 	}
 
-	return &claim, nil
+	return claim, nil
 }
 
-// UpdateClaim updates an existing insurance claim
+// UpdateClaim updates an existing insurance claim. A change of status must be a legal
+// lifecycle transition; prefer the dedicated transition transactions below. Changing the
+// treatment resets the claim's line items to the new treatment's bill. Only the insurer
+// may change the treatment, patient, Aadhaar number or policy, as checking them reads
+// patient details the TPA is not allowed to see. It fails with CONFLICT unless
+// expectedVersion is 0 or the claim's current version.
 func (s *InsuranceClaimContract) UpdateClaim(
 	ctx contractapi.TransactionContextInterface,
 	claimID string,
@@ -120,80 +197,451 @@ func (s *InsuranceClaimContract) UpdateClaim(
 	aadharNumber string,
 	insuranceNumber string,
 	status string,
+	expectedVersion int,
 ) error {
-	exists, err := s.ClaimExists(ctx, claimID)
+	err := access.Authorize(ctx, "UpdateClaim", access.InsuranceMSP, access.TPAMSP)
+	if err != nil {
+		return err
+	}
+
+	existing, err := claimRepository.Read(ctx, claimID)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("claim with ID %s does not exist", claimID)
+	err = claimRepository.CheckVersion(claimID, existing, expectedVersion)
+	if err != nil {
+		return err
 	}
+	claim := *existing
+	claim.TreatmentID = treatmentID
+	claim.PatientID = patientID
+	claim.AadharNumber = aadharNumber
+	claim.InsuranceNumber = insuranceNumber
+	claim.Status = status
+	return s.saveClaimChanges(ctx, "UpdateClaim", existing, &claim)
+}
 
-	claim := InsuranceClaim{
-		ClaimID:         claimID,
-		TreatmentID:     treatmentID,
-		PatientID:       patientID,
-		AadharNumber:    aadharNumber,
-		InsuranceNumber: insuranceNumber,
-		Status:          status,
+// PatchClaim changes only the fields named in patch, a JSON object such as
+// {"status": "UnderReview"}, keeping the others as stored, under the same rules as
+// UpdateClaim, including expectedVersion. The claim ID, the amounts and the metadata
+// cannot be patched; line items are set with SetClaimLineItems and DisallowLineItem.
+func (s *InsuranceClaimContract) PatchClaim(ctx contractapi.TransactionContextInterface, claimID string, patchJSON string, expectedVersion int) error {
+	err := access.Authorize(ctx, "PatchClaim", access.InsuranceMSP, access.TPAMSP)
+	if err != nil {
+		return err
+	}
+
+	existing, err := claimRepository.Read(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	err = claimRepository.CheckVersion(claimID, existing, expectedVersion)
+	if err != nil {
+		return err
+	}
+	claim := *existing
+	fixed := []string{"claimID", "requestedAmount", "approvedAmount", "disallowedAmount", "disallowances", "lineItems"}
+	err = patch.Apply(&claim, []byte(patchJSON), append(fixed, ledger.MetadataFields...)...)
+	if err != nil {
+		return err
+	}
+	return s.saveClaimChanges(ctx, "PatchClaim", existing, &claim)
+}
+
+// saveClaimChanges checks the changes function makes from existing to claim, re-checking
+// the references if any of them changed, and writes the claim back
+func (s *InsuranceClaimContract) saveClaimChanges(ctx contractapi.TransactionContextInterface, function string, existing *InsuranceClaim, claim *InsuranceClaim) error {
+	claimID := existing.ClaimID
+	if !isKnownStatus(claim.Status) {
+		return unknownStatus(claim.Status)
+	}
+	if claim.Status != existing.Status {
+		if err := authorizeTransition(ctx, function, claim.Status); err != nil {
+			return err
+		}
+		if err := checkTransition(claimID, existing.Status, claim.Status); err != nil {
+			return err
+		}
+		if claim.Status == StatusApproved {
+			return errs.New(errs.InvalidState, "claim with ID %s must be approved with ApproveClaim so the policy limit is debited", claimID).
+				With("claimID", claimID)
+		}
+	}
+
+	// Clients that only see masked Aadhaar numbers send the masked value back unchanged
+	if claim.AadharNumber == aadhaar.Mask(existing.AadharNumber) {
+		claim.AadharNumber = existing.AadharNumber
+	}
+	err := validateClaim(claim)
+	if err != nil {
+		return err
+	}
+	if claim.TreatmentID != existing.TreatmentID || claim.PatientID != existing.PatientID ||
+		claim.AadharNumber != existing.AadharNumber || claim.InsuranceNumber != existing.InsuranceNumber {
+		if claimstatus.IsDecided(existing.Status) {
+			return errs.New(errs.InvalidState, "claim with ID %s is %s, its treatment, patient and policy can no longer change", claimID, existing.Status).
+				With("claimID", claimID).With("status", existing.Status)
+		}
+		// The references are checked against the patient's private details, which only
+		// the hospitals and the insurer may read
+		insurer, err := access.ClientInMSP(ctx, access.InsuranceMSP)
+		if err != nil {
+			return err
+		}
+		if !insurer {
+			return errs.New(errs.Forbidden, "permission denied: only the insurer may change the treatment, patient or policy of claim with ID %s", claimID).
+				With("claimID", claimID).With("function", function)
+		}
+		treatment, err := validateClaimReferences(ctx, claim)
+		if err != nil {
+			return err
+		}
+		if claim.TreatmentID != existing.TreatmentID {
+			err = checkTreatmentUnclaimed(ctx, claim.TreatmentID, claimID)
+			if err != nil {
+				return err
+			}
+			err = unindexClaim(ctx, existing.TreatmentID, claimID)
+			if err != nil {
+				return err
+			}
+			err = indexClaim(ctx, claim.TreatmentID, claimID)
+			if err != nil {
+				return err
+			}
+			claim.LineItems = defaultLineItems(treatment.BillingAmount)
+			claim.Disallowances = nil
+			err = recomputeAmounts(claim)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	claimJSON, err := json.Marshal(claim)
+	err = claimRepository.Put(ctx, claimID, claim)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(claimID, claimJSON)
+	eventType := EventClaimUpdated
+	if claim.Status != existing.Status {
+		eventType = EventClaimStatusChanged
+	}
+	return events.Emit(ctx, eventType, claimID, existing.Status, claim.Status)
 }
 
-// DeleteClaim deletes an insurance claim
-func (s *InsuranceClaimContract) DeleteClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
-	exists, err := s.ClaimExists(ctx, claimID)
+// SubmitClaim resubmits a claim after the insurer has raised a query on it
+func (s *InsuranceClaimContract) SubmitClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := authorizeTransition(ctx, "SubmitClaim", StatusSubmitted)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("claim with ID %s does not exist", claimID)
+
+	return s.transitionClaim(ctx, claimID, StatusSubmitted)
+}
+
+// ReviewClaim picks up a submitted claim for review
+func (s *InsuranceClaimContract) ReviewClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := authorizeTransition(ctx, "ReviewClaim", StatusUnderReview)
+	if err != nil {
+		return err
 	}
 
-	return ctx.GetStub().DelState(claimID)
+	return s.transitionClaim(ctx, claimID, StatusUnderReview)
 }
 
-// ClaimExists checks if an insurance claim exists
-func (s *InsuranceClaimContract) ClaimExists(ctx contractapi.TransactionContextInterface, claimID string) (bool, error) {
-	claimJSON, err := ctx.GetStub().GetState(claimID)
+// RaiseQuery sends a claim under review back to the claimant for more information
+func (s *InsuranceClaimContract) RaiseQuery(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := authorizeTransition(ctx, "RaiseQuery", StatusQueryRaised)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return err
 	}
-	return claimJSON != nil, nil
+
+	return s.transitionClaim(ctx, claimID, StatusQueryRaised)
 }
 
-// GetAllClaims returns all insurance claims
-func (s *InsuranceClaimContract) GetAllClaims(ctx contractapi.TransactionContextInterface) ([]*InsuranceClaim, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+// ApproveClaim approves a claim under review for its requested amount less any
+// disallowances, and debits that amount from the policy's claim limit in the same transaction
+func (s *InsuranceClaimContract) ApproveClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := authorizeTransition(ctx, "ApproveClaim", StatusApproved)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	claim, err := claimRepository.Read(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if err := checkTransition(claimID, claim.Status, StatusApproved); err != nil {
+		return err
+	}
+
+	amount, err := claim.RequestedAmount.Sub(claim.DisallowedAmount)
+	if err != nil {
+		return err
+	}
+	if amount.Amount <= 0 {
+		return errs.New(errs.InvalidState, "claim with ID %s has nothing left to approve, reject it instead", claimID).With("claimID", claimID)
+	}
+	err = invoke.Chaincode(ctx, invoke.InsuranceChaincode, nil, "DebitClaimLimit", claim.InsuranceNumber, amount.String())
+	if err != nil {
+		return err
+	}
+
+	oldStatus := claim.Status
+	claim.Status = StatusApproved
+	claim.ApprovedAmount = amount
+
+	err = claimRepository.Put(ctx, claim.ClaimID, claim)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventClaimStatusChanged, claimID, oldStatus, claim.Status)
+}
+
+// RejectClaim rejects a claim under review
+func (s *InsuranceClaimContract) RejectClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := authorizeTransition(ctx, "RejectClaim", StatusRejected)
+	if err != nil {
+		return err
+	}
+
+	return s.transitionClaim(ctx, claimID, StatusRejected)
+}
+
+// WithdrawClaim withdraws a claim the insurer has not decided on yet, at the claimant's
+// request. The treatment may then be claimed again.
+func (s *InsuranceClaimContract) WithdrawClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := authorizeTransition(ctx, "WithdrawClaim", StatusWithdrawn)
+	if err != nil {
+		return err
+	}
+
+	return s.transitionClaim(ctx, claimID, StatusWithdrawn)
+}
+
+// SettleClaim marks an approved claim as paid out
+func (s *InsuranceClaimContract) SettleClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := authorizeTransition(ctx, "SettleClaim", StatusSettled)
+	if err != nil {
+		return err
+	}
+
+	return s.transitionClaim(ctx, claimID, StatusSettled)
+}
+
+// CloseClaim closes a settled, rejected or withdrawn claim
+func (s *InsuranceClaimContract) CloseClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := authorizeTransition(ctx, "CloseClaim", StatusClosed)
+	if err != nil {
+		return err
+	}
+
+	return s.transitionClaim(ctx, claimID, StatusClosed)
+}
+
+// transitionClaim moves a claim to the given status if its lifecycle allows it
+func (s *InsuranceClaimContract) transitionClaim(ctx contractapi.TransactionContextInterface, claimID string, status string) error {
+	claim, err := claimRepository.Read(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if err := checkTransition(claimID, claim.Status, status); err != nil {
+		return err
+	}
+
+	oldStatus := claim.Status
+	claim.Status = status
+
+	err = claimRepository.Put(ctx, claim.ClaimID, claim)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventClaimStatusChanged, claimID, oldStatus, status)
+}
+
+// DeleteClaim soft deletes an insurance claim for the given reason. The claim is kept,
+// marked deleted, but no longer read or listed until RestoreClaim; PurgeClaim removes it.
+// A deleted claim gives up its treatment, so approved, settled and closed claims cannot
+// be deleted.
+func (s *InsuranceClaimContract) DeleteClaim(ctx contractapi.TransactionContextInterface, claimID string, reason string) error {
+	err := access.Authorize(ctx, "DeleteClaim", access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	existing, err := claimRepository.Read(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if claimstatus.IsDecided(existing.Status) {
+		return errs.New(errs.InvalidState, "claim with ID %s is %s and cannot be deleted", claimID, existing.Status).
+			With("claimID", claimID).With("status", existing.Status)
+	}
+	claim, err := claimRepository.SoftDelete(ctx, claimID, reason)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventClaimDeleted, claimID, claim.Status, "")
+}
+
+// RestoreClaim undoes the soft deletion of an insurance claim, unless its treatment has
+// been claimed again since
+func (s *InsuranceClaimContract) RestoreClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := access.Authorize(ctx, "RestoreClaim", access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := claimRepository.ReadIncludingDeleted(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if deleted.holdsTreatment() {
+		err = checkTreatmentUnclaimed(ctx, deleted.TreatmentID, claimID)
+		if err != nil {
+			return err
+		}
+	}
+	claim, err := claimRepository.Restore(ctx, claimID)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventClaimRestored, claimID, "", claim.Status)
+}
+
+// PurgeClaim removes a soft deleted insurance claim from the world state for good. Only
+// the insurer's admins may call it; the claim remains in the ledger's history.
+func (s *InsuranceClaimContract) PurgeClaim(ctx contractapi.TransactionContextInterface, claimID string) error {
+	err := access.RequireRole(ctx, "PurgeClaim", access.AdminRole, access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	claim, err := claimRepository.ReadIncludingDeleted(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	err = claimRepository.Purge(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	err = unindexClaim(ctx, claim.TreatmentID, claimID)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventClaimPurged, claimID, "", "")
+}
+
+// ClaimExists checks if an insurance claim exists, including soft deleted ones, whose IDs
+// cannot be reused
+func (s *InsuranceClaimContract) ClaimExists(ctx contractapi.TransactionContextInterface, claimID string) (bool, error) {
+	return claimRepository.Exists(ctx, claimID)
+}
+
+// MigrateMoney rewrites claim records whose amounts are still stored as floating point
+// numbers into Money, returning how many records were converted.
+// Run MigrateKeys first.
+func (s *InsuranceClaimContract) MigrateMoney(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigrateMoney", access.InsuranceMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(claimRepository.ObjectType, []string{})
+	if err != nil {
+		return 0, err
 	}
 	defer resultsIterator.Close()
 
-	var claims []*InsuranceClaim
+	migrated := 0
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return nil, err
+			return 0, err
+		}
+
+		legacy, err := money.HasLegacyAmount(queryResponse.Value, "requestedAmount", "approvedAmount", "disallowedAmount")
+		if err != nil {
+			return 0, err
+		}
+		if !legacy {
+			continue
 		}
 
 		var claim InsuranceClaim
 		err = json.Unmarshal(queryResponse.Value, &claim)
 		if err != nil {
-			return nil, err
+			return 0, err
+		}
+		err = claimRepository.Put(ctx, claim.ClaimID, &claim)
+		if err != nil {
+			return 0, fmt.Errorf("failed to put claim record: %v", err)
 		}
-		claims = append(claims, &claim)
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// GetAllClaims returns all insurance claims except the soft deleted ones
+func (s *InsuranceClaimContract) GetAllClaims(ctx contractapi.TransactionContextInterface) ([]*InsuranceClaim, error) {
+	claims, err := claimRepository.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = maskClaims(ctx, claims...)
+	if err != nil {
+		return nil, err
 	}
 
 	return claims, nil
 }
 
+// GetDeletedClaims returns the soft deleted insurance claims
+func (s *InsuranceClaimContract) GetDeletedClaims(ctx contractapi.TransactionContextInterface) ([]*InsuranceClaim, error) {
+	claims, err := claimRepository.Deleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = maskClaims(ctx, claims...)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// InsuranceClaimPage is one page of claim records along with the bookmark for the next page
+type InsuranceClaimPage struct {
+	Records             []*InsuranceClaim `json:"records"`
+	FetchedRecordsCount int32             `json:"fetchedRecordsCount"`
+	Bookmark            string            `json:"bookmark"`
+}
+
+// GetAllClaimsWithPagination returns up to pageSize claims starting at bookmark.
+// Pass an empty bookmark for the first page and the returned bookmark for the next.
+func (s *InsuranceClaimContract) GetAllClaimsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*InsuranceClaimPage, error) {
+	page, err := claimRepository.Page(ctx, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	err = maskClaims(ctx, page.Records...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InsuranceClaimPage{Records: page.Records, FetchedRecordsCount: page.FetchedRecordsCount, Bookmark: page.Bookmark}, nil
+}
+
 func main() {
 	chaincode, err := contractapi.NewChaincode(new(InsuranceClaimContract))
 	if err != nil {
@@ -201,7 +649,8 @@ func main() {
 		return
 	}
 
-	if err := chaincode.Start(); err != nil {
+	// Wrapped, every error reaches clients as an errs.Error they can branch on by code
+	if err := shim.Start(errs.WithCodes(chaincode)); err != nil {
 		fmt.Printf("Error starting insurance claim chaincode: %v\n", err)
 	}
-}
\ No newline at end of file
+}
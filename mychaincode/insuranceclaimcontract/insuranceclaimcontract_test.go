@@ -0,0 +1,901 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"common/access"
+	"common/chaincodetest"
+	"common/errs"
+	"common/invoke"
+	"common/money"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// network stands in for the treatment, patient and insurance chaincodes a claim refers to
+type network struct {
+	treatments map[string]treatmentRecord
+	patients   map[string]patientRecord
+	aadhars    map[string]string      // the private Aadhaar number by patient ID
+	policies   map[string]policy      // by insurance number
+	remaining  map[string]money.Money // claim limit left by insurance number
+	debits     []string               // DebitClaimLimit calls as "insuranceNumber amount"
+}
+
+// policy is an insurance policy held by the network
+type policy struct {
+	aadharNumber string
+	period       policyRecord
+}
+
+// newNetwork returns the chaincodes holding TREATMENT1 of PATIENT1, insured under
+// INS123456, and TREATMENT2 of PATIENT2, insured under INS654321
+func newNetwork() *network {
+	n := &network{
+		treatments: map[string]treatmentRecord{
+			"TREATMENT1": {PatientID: "PATIENT1", AdmissionDate: "2023-10-01", BillingAmount: chaincodetest.INR(50050)},
+			"TREATMENT2": {PatientID: "PATIENT2", AdmissionDate: "2023-09-15", BillingAmount: chaincodetest.INR(120075)},
+			"TREATMENT3": {PatientID: "PATIENT1", AdmissionDate: "2023-11-20", BillingAmount: chaincodetest.INR(30000)},
+			"TREATMENT9": {PatientID: "PATIENT9", AdmissionDate: "2023-10-01", BillingAmount: chaincodetest.INR(100)},
+		},
+		patients: map[string]patientRecord{},
+		aadhars:  map[string]string{},
+		policies: map[string]policy{
+			"INS123456": {aadharNumber: "234567890124", period: policyRecord{StartDate: "2023-01-01", EndDate: "2024-01-01"}},
+			"INS654321": {aadharNumber: "987654321096", period: policyRecord{StartDate: "2023-02-15", EndDate: "2024-02-15"}},
+		},
+		remaining: map[string]money.Money{
+			"INS123456": chaincodetest.INR(10000000),
+			"INS654321": chaincodetest.INR(100000),
+		},
+	}
+	n.addPatient("PATIENT1", "INS123456", "234567890124")
+	n.addPatient("PATIENT2", "INS654321", "987654321096")
+	return n
+}
+
+func (n *network) addPatient(patientID string, insuranceNumber string, aadharNumber string) {
+	n.patients[patientID] = patientRecord{InsuranceNumber: insuranceNumber}
+	n.aadhars[patientID] = aadharNumber
+}
+
+// notFound answers a call for a missing record the way the real chaincodes do
+func notFound(kind string, idName string, id string) peer.Response {
+	return shim.Error((&errs.NotFoundError{Kind: kind, IDName: idName, ID: id}).Error())
+}
+
+func (n *network) install(stub *chaincodetest.Stub) {
+	stub.Chaincodes[invoke.TreatmentChaincode] = func(function string, args []string) peer.Response {
+		treatment, ok := n.treatments[args[0]]
+		if function != "ReadTreatmentRecord" || !ok {
+			return notFound("treatment", "ID", args[0])
+		}
+		return chaincodetest.Success(treatment)
+	}
+	stub.Chaincodes[invoke.PatientChaincode] = func(function string, args []string) peer.Response {
+		patient, ok := n.patients[args[0]]
+		if !ok {
+			return notFound("patient", "ID", args[0])
+		}
+		switch function {
+		case "ReadPatientRecord":
+			return chaincodetest.Success(patient)
+		case "VerifyPatientAadhar":
+			return chaincodetest.Success(n.aadhars[args[0]] == args[1])
+		}
+		return shim.Error("unknown function " + function)
+	}
+	stub.Chaincodes[invoke.InsuranceChaincode] = func(function string, args []string) peer.Response {
+		policy, ok := n.policies[args[0]]
+		if !ok {
+			return notFound("insurance", "number", args[0])
+		}
+		switch function {
+		case "VerifyInsuranceAadhar":
+			return chaincodetest.Success(policy.aadharNumber == args[1])
+		case "ReadInsurance":
+			return chaincodetest.Success(policy.period)
+		case "DebitClaimLimit":
+			debit, err := money.Parse(args[1])
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			left, _ := n.remaining[args[0]].Sub(debit)
+			if left.Amount < 0 {
+				return shim.Error(errs.New(errs.LimitExceeded, "claim amount %s exceeds remaining limit %s on insurance %s", debit, n.remaining[args[0]], args[0]).Error())
+			}
+			n.remaining[args[0]] = left
+			n.debits = append(n.debits, args[0]+" "+args[1])
+			return shim.Success(nil)
+		}
+		return shim.Error("unknown function " + function)
+	}
+}
+
+// newContext returns the context of a first transaction submitted by client, on a
+// channel where the chaincodes of n are installed
+func newContext(n *network, client *chaincodetest.ClientIdentity) *chaincodetest.Context {
+	ctx := chaincodetest.NewContext(client.MSPID)
+	ctx.Client = client
+	n.install(ctx.Stub)
+	return ctx
+}
+
+// createClaim files a claim for TREATMENT1 in a transaction of its own submitted by the hospital
+func createClaim(t *testing.T, ctx *chaincodetest.Context, claimID string) *chaincodetest.Context {
+	t.Helper()
+	return createClaimFor(t, ctx, claimID, "TREATMENT1")
+}
+
+// createClaimFor is like createClaim for another treatment of PATIENT1
+func createClaimFor(t *testing.T, ctx *chaincodetest.Context, claimID string, treatmentID string) *chaincodetest.Context {
+	t.Helper()
+	ctx = ctx.Next(chaincodetest.Hospital)
+	err := new(InsuranceClaimContract).CreateClaim(ctx, claimID, treatmentID, "PATIENT1", "234567890124", "INS123456")
+	if err != nil {
+		t.Fatalf("CreateClaim(%s) = %v", claimID, err)
+	}
+	return ctx
+}
+
+// moveClaim runs a transition transaction on a claim in a transaction of its own
+func moveClaim(t *testing.T, ctx *chaincodetest.Context, client *chaincodetest.ClientIdentity, claimID string,
+	transition func(*InsuranceClaimContract, *chaincodetest.Context, string) error) *chaincodetest.Context {
+	t.Helper()
+	ctx = ctx.Next(client)
+	if err := transition(new(InsuranceClaimContract), ctx, claimID); err != nil {
+		t.Fatalf("transition of %s = %v", claimID, err)
+	}
+	return ctx
+}
+
+// transitions of InsuranceClaimContract, usable with moveClaim
+var (
+	submit = func(c *InsuranceClaimContract, ctx *chaincodetest.Context, id string) error {
+		return c.SubmitClaim(ctx, id)
+	}
+	review = func(c *InsuranceClaimContract, ctx *chaincodetest.Context, id string) error {
+		return c.ReviewClaim(ctx, id)
+	}
+	query = func(c *InsuranceClaimContract, ctx *chaincodetest.Context, id string) error {
+		return c.RaiseQuery(ctx, id)
+	}
+	approve = func(c *InsuranceClaimContract, ctx *chaincodetest.Context, id string) error {
+		return c.ApproveClaim(ctx, id)
+	}
+	reject = func(c *InsuranceClaimContract, ctx *chaincodetest.Context, id string) error {
+		return c.RejectClaim(ctx, id)
+	}
+	withdraw = func(c *InsuranceClaimContract, ctx *chaincodetest.Context, id string) error {
+		return c.WithdrawClaim(ctx, id)
+	}
+	settle = func(c *InsuranceClaimContract, ctx *chaincodetest.Context, id string) error {
+		return c.SettleClaim(ctx, id)
+	}
+	closeClaim = func(c *InsuranceClaimContract, ctx *chaincodetest.Context, id string) error {
+		return c.CloseClaim(ctx, id)
+	}
+)
+
+// readClaim reads a claim straight from the world state, unmasked
+func readClaim(t *testing.T, ctx *chaincodetest.Context, claimID string) *InsuranceClaim {
+	t.Helper()
+	claim, err := claimRepository.Read(ctx, claimID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claim
+}
+
+func TestCreateClaim(t *testing.T) {
+	n := newNetwork()
+	ctx := createClaim(t, newContext(n, chaincodetest.Hospital), "CLAIM1")
+
+	claim := readClaim(t, ctx, "CLAIM1")
+	if claim.Status != StatusSubmitted || claim.RequestedAmount != chaincodetest.INR(50050) || claim.ApprovedAmount.Amount != 0 {
+		t.Errorf("claim = %+v", claim)
+	}
+	if len(claim.LineItems) != 1 || claim.LineItems[0].ServiceCode != treatmentServiceCode || claim.LineItems[0].UnitPrice != chaincodetest.INR(50050) {
+		t.Errorf("line items = %+v, want the whole treatment bill", claim.LineItems)
+	}
+
+	event := chaincodetest.LastEvent(t, ctx)
+	if event.EventType != EventClaimCreated || event.RecordID != "CLAIM1" || event.OldStatus != "" || event.NewStatus != StatusSubmitted {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+// TestClaimRolesByMSPID uses the MSP IDs of configtx.yaml rather than the access constants
+func TestClaimRolesByMSPID(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := newContext(newNetwork(), chaincodetest.NewClient("HealthcareMSP"))
+	if err := contract.CreateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "234567890124", "INS123456"); err != nil {
+		t.Errorf("CreateClaim by HealthcareMSP = %v", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.NewClient("TPAMSP"))
+	if err := contract.ReviewClaim(ctx, "CLAIM1"); err != nil {
+		t.Errorf("ReviewClaim by TPAMSP = %v", err)
+	}
+	var denied *errs.PermissionError
+	if err := contract.CreateClaim(ctx, "CLAIM2", "TREATMENT2", "PATIENT2", "987654321096", "INS654321"); !errors.As(err, &denied) {
+		t.Errorf("CreateClaim by TPAMSP = %v, want a PermissionError", err)
+	}
+}
+
+func TestCreateClaimErrors(t *testing.T) {
+	n := newNetwork()
+	n.addPatient("PATIENT3", "INS123456", "987654321096")
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(n, chaincodetest.Hospital), "CLAIM1")
+
+	var exists *errs.AlreadyExistsError
+	err := contract.CreateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "234567890124", "INS123456")
+	if !errors.As(err, &exists) {
+		t.Errorf("CreateClaim of an existing ID = %v, want an AlreadyExistsError", err)
+	}
+
+	tests := []struct {
+		name                                                  string
+		treatmentID, patientID, aadharNumber, insuranceNumber string
+		code                                                  errs.Code
+		message                                               string
+	}{
+		{"invalid Aadhaar", "TREATMENT1", "PATIENT1", "234567890123", "INS123456", errs.ValidationFailed, "aadharNumber has an invalid check digit"},
+		{"no treatment", "", "PATIENT1", "234567890124", "INS123456", errs.ValidationFailed, "treatmentID must not be empty"},
+		{"missing treatment", "TREATMENT0", "PATIENT1", "234567890124", "INS123456", errs.NotFound, "treatment with ID TREATMENT0 does not exist"},
+		{"another patient's treatment", "TREATMENT2", "PATIENT1", "234567890124", "INS123456", errs.ValidationFailed, "belongs to patient PATIENT2"},
+		{"missing patient", "TREATMENT9", "PATIENT9", "234567890124", "INS123456", errs.NotFound, "patient with ID PATIENT9 does not exist"},
+		{"another policy", "TREATMENT3", "PATIENT1", "234567890124", "INS654321", errs.ValidationFailed, "is insured under INS123456"},
+		{"another Aadhaar", "TREATMENT3", "PATIENT1", "987654321096", "INS123456", errs.ValidationFailed, "does not match patient PATIENT1"},
+	}
+	for _, tt := range tests {
+		err := contract.CreateClaim(ctx, "CLAIM2", tt.treatmentID, tt.patientID, tt.aadharNumber, tt.insuranceNumber)
+		if coded := errs.From(err); err == nil || coded.Code != tt.code || !strings.Contains(coded.Message, tt.message) {
+			t.Errorf("CreateClaim with %s = %v, want %s containing %q", tt.name, err, tt.code, tt.message)
+		}
+	}
+
+	// PATIENT3's Aadhaar number matches the patient record but not the policy
+	n.treatments["TREATMENT4"] = treatmentRecord{PatientID: "PATIENT3", AdmissionDate: "2023-10-01", BillingAmount: chaincodetest.INR(100)}
+	err = contract.CreateClaim(ctx, "CLAIM2", "TREATMENT4", "PATIENT3", "987654321096", "INS123456")
+	if err == nil || !strings.Contains(errs.From(err).Message, "not held by the claimant") {
+		t.Errorf("CreateClaim against someone else's policy = %v", err)
+	}
+
+	// A missing policy is reported by the insurance chaincode
+	n.patients["PATIENT3"] = patientRecord{InsuranceNumber: "INS000000"}
+	err = contract.CreateClaim(ctx, "CLAIM2", "TREATMENT4", "PATIENT3", "987654321096", "INS000000")
+	if err == nil || !strings.Contains(errs.From(err).Message, "insurance with number INS000000 does not exist") {
+		t.Errorf("CreateClaim against a missing policy = %v", err)
+	}
+
+	// The policy must have been in force on the day of admission, both ends included
+	for admissionDate, covered := range map[string]bool{
+		"2022-12-31": false, "2023-01-01": true, "2024-01-01": true, "2024-01-02": false,
+	} {
+		n.treatments["TREATMENT-"+admissionDate] = treatmentRecord{PatientID: "PATIENT1", AdmissionDate: admissionDate, BillingAmount: chaincodetest.INR(100)}
+		err = contract.CreateClaim(ctx, "CLAIM-"+admissionDate, "TREATMENT-"+admissionDate, "PATIENT1", "234567890124", "INS123456")
+		if covered && err != nil {
+			t.Errorf("CreateClaim for an admission on %s = %v", admissionDate, err)
+		}
+		if !covered && (err == nil || !strings.Contains(errs.From(err).Message, "outside the period of insurance INS123456 from 2023-01-01 to 2024-01-01")) {
+			t.Errorf("CreateClaim for an admission on %s = %v, want a policy period error", admissionDate, err)
+		}
+	}
+
+	ctx.Client = chaincodetest.Insurer
+	var denied *errs.PermissionError
+	err = contract.CreateClaim(ctx, "CLAIM2", "TREATMENT1", "PATIENT1", "234567890124", "INS123456")
+	if !errors.As(err, &denied) {
+		t.Errorf("CreateClaim by the insurer = %v, want a PermissionError", err)
+	}
+
+	if exists, _ := contract.ClaimExists(ctx, "CLAIM2"); exists {
+		t.Error("a failed CreateClaim wrote CLAIM2")
+	}
+}
+
+func TestCreateClaimWithoutReferencedChaincodes(t *testing.T) {
+	ctx := chaincodetest.NewContext(access.HealthcareMSP)
+	err := new(InsuranceClaimContract).CreateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "234567890124", "INS123456")
+	if coded := errs.From(err); err == nil || coded.Code != errs.Internal || !strings.Contains(coded.Message, "failed to invoke ReadTreatmentRecord on treatmentcc") {
+		t.Errorf("CreateClaim = %v", err)
+	}
+}
+
+func TestReadClaimMasksAadhaar(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	tests := map[*chaincodetest.ClientIdentity]string{
+		chaincodetest.Hospital: "234567890124",
+		chaincodetest.Insurer:  "234567890124",
+		chaincodetest.TPA:      "XXXX-XXXX-0124",
+	}
+	for client, want := range tests {
+		ctx.Client = client
+		claim, err := contract.ReadClaim(ctx, "CLAIM1")
+		if err != nil || claim.AadharNumber != want {
+			t.Errorf("ReadClaim by %s = %+v, %v; want Aadhaar number %s", client.MSPID, claim, err, want)
+		}
+		claims, err := contract.GetAllClaims(ctx)
+		if err != nil || len(claims) != 1 || claims[0].AadharNumber != want {
+			t.Errorf("GetAllClaims by %s = %+v, %v; want Aadhaar number %s", client.MSPID, claims, err, want)
+		}
+	}
+
+	var notFound *errs.NotFoundError
+	_, err := contract.ReadClaim(ctx, "CLAIM9")
+	if !errors.As(err, &notFound) || errs.From(err).Message != "claim with ID CLAIM9 does not exist" {
+		t.Errorf("ReadClaim of a missing claim = %v, want a NotFoundError", err)
+	}
+}
+
+func TestUpdateClaim(t *testing.T) {
+	n := newNetwork()
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(n, chaincodetest.Hospital), "CLAIM1")
+
+	// The TPA sends back the masked Aadhaar number it was shown, leaving it unchanged,
+	// and picks the claim up for review
+	ctx = ctx.Next(chaincodetest.TPA)
+	err := contract.UpdateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "XXXX-XXXX-0124", "INS123456", StatusUnderReview, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim := readClaim(t, ctx, "CLAIM1")
+	if claim.AadharNumber != "234567890124" || claim.Status != StatusUnderReview {
+		t.Errorf("claim = %+v", claim)
+	}
+	event := chaincodetest.LastEvent(t, ctx)
+	if event.EventType != EventClaimStatusChanged || event.OldStatus != StatusSubmitted || event.NewStatus != StatusUnderReview {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Changing the treatment bills the new one
+	ctx = ctx.Next(chaincodetest.Insurer)
+	err = contract.UpdateClaim(ctx, "CLAIM1", "TREATMENT3", "PATIENT1", "234567890124", "INS123456", StatusUnderReview, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim = readClaim(t, ctx, "CLAIM1")
+	if claim.TreatmentID != "TREATMENT3" || claim.RequestedAmount != chaincodetest.INR(30000) || claim.LineItems[0].UnitPrice != chaincodetest.INR(30000) {
+		t.Errorf("claim after changing the treatment = %+v", claim)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventClaimUpdated {
+		t.Errorf("event = %+v", event)
+	}
+	if claim.Version != 3 || claim.LastModifiedTxID != ctx.Stub.TxID || claim.LastModifiedByMSP != access.InsuranceMSP {
+		t.Errorf("metadata = %+v, want version 3 by the insurer", claim.Metadata)
+	}
+
+	// The TPA still holds version 2, so its change would overwrite the insurer's
+	ctx = ctx.Next(chaincodetest.TPA)
+	err = contract.UpdateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "234567890124", "INS123456", StatusQueryRaised, 2)
+	var conflict *errs.ConflictError
+	if !errors.As(err, &conflict) || errs.From(err).Code != errs.Conflict || conflict.Expected != 2 || conflict.Actual != 3 {
+		t.Errorf("UpdateClaim of version 2 = %v, want a ConflictError", err)
+	}
+	if err := contract.PatchClaim(ctx, "CLAIM1", `{"status": "QueryRaised"}`, 2); !errors.As(err, &conflict) {
+		t.Errorf("PatchClaim of version 2 = %v, want a ConflictError", err)
+	}
+	if err := contract.PatchClaim(ctx, "CLAIM1", `{"status": "QueryRaised"}`, 3); err != nil {
+		t.Errorf("PatchClaim of the current version = %v", err)
+	}
+}
+
+func TestUpdateClaimReferencesByTPA(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	// patientcc would refuse the TPA the Aadhaar check, so the claim chaincode does first
+	ctx = ctx.Next(chaincodetest.TPA)
+	err := contract.UpdateClaim(ctx, "CLAIM1", "TREATMENT3", "PATIENT1", "XXXX-XXXX-0124", "INS123456", StatusSubmitted, 0)
+	if coded := errs.From(err); err == nil || coded.Code != errs.Forbidden || coded.Details["claimID"] != "CLAIM1" {
+		t.Errorf("UpdateClaim of the treatment by the TPA = %v, want FORBIDDEN", err)
+	}
+	if err := contract.PatchClaim(ctx, "CLAIM1", `{"insuranceNumber": "INS654321"}`, 0); errs.From(err).Code != errs.Forbidden {
+		t.Errorf("PatchClaim of the policy by the TPA = %v, want FORBIDDEN", err)
+	}
+	if claim := readClaim(t, ctx, "CLAIM1"); claim.TreatmentID != "TREATMENT1" || claim.Version != 1 {
+		t.Errorf("claim after refused updates = %+v", claim)
+	}
+
+	// Sending the references back unchanged, masked Aadhaar number included, is fine
+	err = contract.UpdateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "XXXX-XXXX-0124", "INS123456", StatusUnderReview, 1)
+	if err != nil {
+		t.Errorf("UpdateClaim of the status by the TPA = %v", err)
+	}
+}
+
+func TestUpdateClaimErrors(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+	ctx = ctx.Next(chaincodetest.Insurer)
+
+	tests := []struct {
+		name    string
+		client  *chaincodetest.ClientIdentity
+		claimID string
+		patient string
+		status  string
+		message string
+	}{
+		{"missing claim", chaincodetest.Insurer, "CLAIM9", "PATIENT1", StatusSubmitted, "claim with ID CLAIM9 does not exist"},
+		{"unknown status", chaincodetest.Insurer, "CLAIM1", "PATIENT1", "Pending", `unknown claim status "Pending"`},
+		{"illegal transition", chaincodetest.Insurer, "CLAIM1", "PATIENT1", StatusSettled, `cannot move from status "Submitted" to "Settled"`},
+		{"invalid reference", chaincodetest.Insurer, "CLAIM1", "PATIENT2", StatusSubmitted, "belongs to patient PATIENT1"},
+		{"missing field", chaincodetest.Insurer, "CLAIM1", "", StatusSubmitted, "patientID must not be empty"},
+		{"by a hospital", chaincodetest.Hospital, "CLAIM1", "PATIENT1", StatusSubmitted, "permission denied"},
+	}
+	for _, tt := range tests {
+		ctx.Client = tt.client
+		err := contract.UpdateClaim(ctx, tt.claimID, "TREATMENT1", tt.patient, "234567890124", "INS123456", tt.status, 0)
+		if err == nil || !strings.Contains(errs.From(err).Message, tt.message) {
+			t.Errorf("UpdateClaim with %s = %v, want an error containing %q", tt.name, err, tt.message)
+		}
+	}
+
+	// Approval must go through ApproveClaim so the policy is debited
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+	ctx.Client = chaincodetest.Adjudicator
+	err := contract.UpdateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "234567890124", "INS123456", StatusApproved, 0)
+	if err == nil || !strings.Contains(errs.From(err).Message, "must be approved with ApproveClaim") {
+		t.Errorf("UpdateClaim to Approved = %v", err)
+	}
+
+	// Rejecting needs the adjudicator role when the certificate carries a role
+	ctx.Client = chaincodetest.Insurer.WithAttribute(access.RoleAttribute, "clerk")
+	var denied *errs.PermissionError
+	err = contract.UpdateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "234567890124", "INS123456", StatusRejected, 0)
+	if !errors.As(err, &denied) {
+		t.Errorf("UpdateClaim to Rejected by a clerk = %v, want a PermissionError", err)
+	}
+}
+
+func TestPatchClaim(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	ctx = ctx.Next(chaincodetest.TPA)
+	if err := contract.PatchClaim(ctx, "CLAIM1", `{"status": "UnderReview"}`, 0); err != nil {
+		t.Fatal(err)
+	}
+	claim := readClaim(t, ctx, "CLAIM1")
+	if claim.Status != StatusUnderReview || claim.TreatmentID != "TREATMENT1" || claim.AadharNumber != "234567890124" {
+		t.Errorf("claim = %+v", claim)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventClaimStatusChanged || event.NewStatus != StatusUnderReview {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Changing the treatment bills the new one
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.PatchClaim(ctx, "CLAIM1", `{"treatmentID": "TREATMENT3"}`, 0); err != nil {
+		t.Fatal(err)
+	}
+	claim = readClaim(t, ctx, "CLAIM1")
+	if claim.TreatmentID != "TREATMENT3" || claim.RequestedAmount != chaincodetest.INR(30000) || claim.Status != StatusUnderReview {
+		t.Errorf("claim after changing the treatment = %+v", claim)
+	}
+
+	tests := []struct {
+		name    string
+		claimID string
+		patch   string
+		code    errs.Code
+	}{
+		{"missing claim", "CLAIM9", `{"status": "QueryRaised"}`, errs.NotFound},
+		{"illegal transition", "CLAIM1", `{"status": "Settled"}`, errs.InvalidState},
+		{"approval", "CLAIM1", `{"status": "Approved"}`, errs.InvalidState},
+		{"invalid reference", "CLAIM1", `{"patientID": "PATIENT2"}`, errs.ValidationFailed},
+		{"fixed field", "CLAIM1", `{"approvedAmount": {"amount": 1, "currency": "INR"}}`, errs.ValidationFailed},
+		{"renamed claim", "CLAIM1", `{"claimID": "CLAIM2"}`, errs.ValidationFailed},
+		{"metadata", "CLAIM1", `{"lastModifiedByMSP": "HealthcareMSP"}`, errs.ValidationFailed},
+	}
+	for _, tt := range tests {
+		ctx.Client = chaincodetest.Adjudicator
+		if err := contract.PatchClaim(ctx, tt.claimID, tt.patch, 0); errs.From(err).Code != tt.code {
+			t.Errorf("PatchClaim with %s = %v, want %s", tt.name, err, tt.code)
+		}
+	}
+
+	ctx.Client = chaincodetest.Hospital
+	var denied *errs.PermissionError
+	if err := contract.PatchClaim(ctx, "CLAIM1", `{"status": "QueryRaised"}`, 0); !errors.As(err, &denied) {
+		t.Errorf("PatchClaim by a hospital = %v, want a PermissionError", err)
+	}
+}
+
+func TestDecidedClaimReferences(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+	ctx = moveClaim(t, ctx, chaincodetest.Adjudicator, "CLAIM1", approve)
+
+	steps := []struct {
+		status string
+		next   func(*InsuranceClaimContract, *chaincodetest.Context, string) error
+	}{
+		{StatusApproved, settle},
+		{StatusSettled, closeClaim},
+		{StatusClosed, nil},
+	}
+	for _, step := range steps {
+		ctx.Client = chaincodetest.Insurer
+		err := contract.PatchClaim(ctx, "CLAIM1", `{"treatmentID": "TREATMENT3"}`, 0)
+		if coded := errs.From(err); err == nil || coded.Code != errs.InvalidState || coded.Details["status"] != step.status {
+			t.Errorf("PatchClaim of the treatment of a claim in status %s = %v, want INVALID_STATE", step.status, err)
+		}
+		err = contract.UpdateClaim(ctx, "CLAIM1", "TREATMENT1", "PATIENT1", "234567890124", "INS654321", step.status, 0)
+		if coded := errs.From(err); err == nil || coded.Code != errs.InvalidState {
+			t.Errorf("UpdateClaim of the policy of a claim in status %s = %v, want INVALID_STATE", step.status, err)
+		}
+		if step.next != nil {
+			ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", step.next)
+		}
+	}
+	if claim := readClaim(t, ctx, "CLAIM1"); claim.TreatmentID != "TREATMENT1" || claim.InsuranceNumber != "INS123456" {
+		t.Errorf("claim = %+v, want its references unchanged", claim)
+	}
+}
+
+func TestClaimLifecycle(t *testing.T) {
+	n := newNetwork()
+	ctx := createClaim(t, newContext(n, chaincodetest.Hospital), "CLAIM1")
+
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+	ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", query)
+	ctx = moveClaim(t, ctx, chaincodetest.Hospital, "CLAIM1", submit)
+	ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", review)
+	ctx = moveClaim(t, ctx, chaincodetest.Adjudicator, "CLAIM1", approve)
+
+	claim := readClaim(t, ctx, "CLAIM1")
+	if claim.Status != StatusApproved || claim.ApprovedAmount != chaincodetest.INR(50050) {
+		t.Errorf("approved claim = %+v", claim)
+	}
+	if len(n.debits) != 1 || n.debits[0] != "INS123456 INR 500.50" {
+		t.Errorf("debits = %v, want the approved amount debited once", n.debits)
+	}
+	event := chaincodetest.LastEvent(t, ctx)
+	if event.EventType != EventClaimStatusChanged || event.OldStatus != StatusUnderReview || event.NewStatus != StatusApproved {
+		t.Errorf("event = %+v", event)
+	}
+
+	ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", settle)
+	ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", closeClaim)
+	if claim := readClaim(t, ctx, "CLAIM1"); claim.Status != StatusClosed {
+		t.Errorf("status = %s, want %s", claim.Status, StatusClosed)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.OldStatus != StatusSettled || event.NewStatus != StatusClosed {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Closed is final
+	var transitionErr *TransitionError
+	ctx.Client = chaincodetest.Insurer
+	for _, transition := range []func(*InsuranceClaimContract, *chaincodetest.Context, string) error{settle, closeClaim} {
+		if err := transition(new(InsuranceClaimContract), ctx, "CLAIM1"); !errors.As(err, &transitionErr) {
+			t.Errorf("transition of a closed claim = %v, want a TransitionError", err)
+		}
+	}
+}
+
+func TestRejectedClaimLifecycle(t *testing.T) {
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+	ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", reject)
+	ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", closeClaim)
+	if claim := readClaim(t, ctx, "CLAIM1"); claim.Status != StatusClosed || claim.ApprovedAmount.Amount != 0 {
+		t.Errorf("claim = %+v", claim)
+	}
+}
+
+func TestWithdrawnClaimLifecycle(t *testing.T) {
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+	ctx = moveClaim(t, ctx, chaincodetest.Hospital, "CLAIM1", withdraw)
+	if event := chaincodetest.LastEvent(t, ctx); event.OldStatus != StatusUnderReview || event.NewStatus != StatusWithdrawn {
+		t.Errorf("event = %+v", event)
+	}
+
+	// A withdrawn claim can only be closed
+	var transitionErr *TransitionError
+	ctx.Client = chaincodetest.Hospital
+	if err := new(InsuranceClaimContract).SubmitClaim(ctx, "CLAIM1"); !errors.As(err, &transitionErr) {
+		t.Errorf("SubmitClaim of a withdrawn claim = %v, want a TransitionError", err)
+	}
+	ctx = moveClaim(t, ctx, chaincodetest.Insurer, "CLAIM1", closeClaim)
+	if claim := readClaim(t, ctx, "CLAIM1"); claim.Status != StatusClosed {
+		t.Errorf("status = %s, want %s", claim.Status, StatusClosed)
+	}
+}
+
+func TestTransitionErrors(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	var transitionErr *TransitionError
+	ctx.Client = chaincodetest.Adjudicator
+	err := contract.ApproveClaim(ctx, "CLAIM1")
+	if !errors.As(err, &transitionErr) || transitionErr.From != StatusSubmitted || transitionErr.To != StatusApproved {
+		t.Errorf("ApproveClaim of a submitted claim = %v, want a TransitionError", err)
+	}
+	if coded := errs.From(err); coded.Code != errs.InvalidState || coded.Details["from"] != StatusSubmitted {
+		t.Errorf("TransitionError is sent as %+v", coded)
+	}
+	ctx.Client = chaincodetest.Insurer
+	if err := contract.SettleClaim(ctx, "CLAIM1"); !errors.As(err, &transitionErr) {
+		t.Errorf("SettleClaim of a submitted claim = %v, want a TransitionError", err)
+	}
+
+	var notFound *errs.NotFoundError
+	if err := contract.ReviewClaim(ctx, "CLAIM9"); !errors.As(err, &notFound) {
+		t.Errorf("ReviewClaim of a missing claim = %v, want a NotFoundError", err)
+	}
+	ctx.Client = chaincodetest.Adjudicator
+	if err := contract.ApproveClaim(ctx, "CLAIM9"); !errors.As(err, &notFound) {
+		t.Errorf("ApproveClaim of a missing claim = %v, want a NotFoundError", err)
+	}
+
+	tests := []struct {
+		name       string
+		client     *chaincodetest.ClientIdentity
+		transition func(*InsuranceClaimContract, *chaincodetest.Context, string) error
+	}{
+		{"SubmitClaim by the insurer", chaincodetest.Insurer, submit},
+		{"ReviewClaim by a hospital", chaincodetest.Hospital, review},
+		{"RaiseQuery by a hospital", chaincodetest.Hospital, query},
+		{"ApproveClaim by the TPA", chaincodetest.TPA, approve},
+		{"ApproveClaim by a clerk", chaincodetest.Insurer.WithAttribute(access.RoleAttribute, "clerk"), approve},
+		{"RejectClaim by a hospital", chaincodetest.Hospital, reject},
+		{"WithdrawClaim by the insurer", chaincodetest.Insurer, withdraw},
+		{"SettleClaim by the TPA", chaincodetest.TPA, settle},
+		{"CloseClaim by a hospital", chaincodetest.Hospital, closeClaim},
+	}
+	var denied *errs.PermissionError
+	for _, tt := range tests {
+		ctx.Client = tt.client
+		if err := tt.transition(contract, ctx, "CLAIM1"); !errors.As(err, &denied) {
+			t.Errorf("%s = %v, want a PermissionError", tt.name, err)
+		}
+	}
+}
+
+func TestApproveClaimErrors(t *testing.T) {
+	n := newNetwork()
+	contract := new(InsuranceClaimContract)
+	ctx := newContext(n, chaincodetest.Hospital)
+	err := contract.CreateClaim(ctx, "CLAIM2", "TREATMENT2", "PATIENT2", "987654321096", "INS654321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM2", review)
+
+	// INS654321 has INR 1000.00 left, less than the bill of INR 1200.75
+	ctx = ctx.Next(chaincodetest.Adjudicator)
+	err = contract.ApproveClaim(ctx, "CLAIM2")
+	if err == nil || errs.From(err).Code != errs.LimitExceeded || !strings.Contains(errs.From(err).Message, "exceeds remaining limit") {
+		t.Errorf("ApproveClaim beyond the policy limit = %v", err)
+	}
+	if claim := readClaim(t, ctx, "CLAIM2"); claim.Status != StatusUnderReview {
+		t.Errorf("status after a failed approval = %s", claim.Status)
+	}
+
+	// Nothing is left to approve once the whole bill is disallowed
+	err = contract.DisallowLineItem(ctx, "CLAIM2", treatmentServiceCode, "0", "NOT_COVERED")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = contract.ApproveClaim(ctx, "CLAIM2")
+	if err == nil || !strings.Contains(errs.From(err).Message, "nothing left to approve") {
+		t.Errorf("ApproveClaim of a fully disallowed claim = %v", err)
+	}
+	if len(n.debits) != 0 {
+		t.Errorf("debits = %v, want none", n.debits)
+	}
+}
+
+func TestDeleteClaim(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	var denied *errs.PermissionError
+	if err := contract.DeleteClaim(ctx, "CLAIM1", "duplicate"); !errors.As(err, &denied) {
+		t.Errorf("DeleteClaim by a hospital = %v, want a PermissionError", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.DeleteClaim(ctx, "CLAIM1", ""); err == nil || errs.From(err).Code != errs.ValidationFailed {
+		t.Errorf("DeleteClaim without a reason = %v, want %s", err, errs.ValidationFailed)
+	}
+	if err := contract.DeleteClaim(ctx, "CLAIM1", "duplicate"); err != nil {
+		t.Fatal(err)
+	}
+	event := chaincodetest.LastEvent(t, ctx)
+	if event.EventType != EventClaimDeleted || event.OldStatus != StatusSubmitted || event.NewStatus != "" {
+		t.Errorf("event = %+v", event)
+	}
+
+	// The claim is hidden, but kept and its ID stays taken
+	var notFound *errs.NotFoundError
+	if _, err := contract.ReadClaim(ctx, "CLAIM1"); !errors.As(err, &notFound) {
+		t.Errorf("ReadClaim of a deleted claim = %v, want a NotFoundError", err)
+	}
+	if exists, _ := contract.ClaimExists(ctx, "CLAIM1"); !exists {
+		t.Error("deleted CLAIM1 no longer exists")
+	}
+	if claims, err := contract.GetAllClaims(ctx); err != nil || len(claims) != 0 {
+		t.Errorf("GetAllClaims = %v, %v; want no claims", claims, err)
+	}
+	deleted, err := contract.GetDeletedClaims(ctx)
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("GetDeletedClaims = %v, %v", deleted, err)
+	}
+	if d := deleted[0]; !d.Deleted || d.DeletedReason != "duplicate" || d.DeletedBy != chaincodetest.Insurer.ID || d.DeletedAt == "" {
+		t.Errorf("deleted claim = %+v", d.Metadata)
+	}
+	if err := contract.DeleteClaim(ctx, "CLAIM1", "duplicate"); !errors.As(err, &notFound) {
+		t.Errorf("DeleteClaim of a deleted claim = %v, want a NotFoundError", err)
+	}
+}
+
+func TestRestoreClaim(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.RestoreClaim(ctx, "CLAIM1"); err == nil || errs.From(err).Code != errs.InvalidState {
+		t.Errorf("RestoreClaim of a claim that is not deleted = %v, want %s", err, errs.InvalidState)
+	}
+	if err := contract.DeleteClaim(ctx, "CLAIM1", "entered by mistake"); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.RestoreClaim(ctx, "CLAIM1"); err != nil {
+		t.Fatal(err)
+	}
+	event := chaincodetest.LastEvent(t, ctx)
+	if event.EventType != EventClaimRestored || event.NewStatus != StatusSubmitted {
+		t.Errorf("event = %+v", event)
+	}
+
+	claim, err := contract.ReadClaim(ctx, "CLAIM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Deleted || claim.DeletedReason != "" || claim.Version != 3 {
+		t.Errorf("restored claim = %+v", claim.Metadata)
+	}
+}
+
+func TestPurgeClaim(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+
+	ctx = ctx.Next(chaincodetest.InsurerAdmin)
+	if err := contract.PurgeClaim(ctx, "CLAIM1"); err == nil || errs.From(err).Code != errs.InvalidState {
+		t.Errorf("PurgeClaim of a claim that is not deleted = %v, want %s", err, errs.InvalidState)
+	}
+	if err := contract.DeleteClaim(ctx, "CLAIM1", "test data"); err != nil {
+		t.Fatal(err)
+	}
+
+	var denied *errs.PermissionError
+	ctx.Client = chaincodetest.Insurer
+	if err := contract.PurgeClaim(ctx, "CLAIM1"); !errors.As(err, &denied) {
+		t.Errorf("PurgeClaim by an insurer without the admin role = %v, want a PermissionError", err)
+	}
+
+	ctx.Client = chaincodetest.InsurerAdmin
+	if err := contract.PurgeClaim(ctx, "CLAIM1"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := contract.ClaimExists(ctx, "CLAIM1"); exists {
+		t.Error("CLAIM1 still exists")
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventClaimPurged {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestGetAllClaimsWithPagination(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := newContext(newNetwork(), chaincodetest.Insurer)
+	if err := contract.InitLedger(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx = createClaimFor(t, ctx, "CLAIM3", "TREATMENT3")
+
+	ctx.Client = chaincodetest.TPA
+	page, err := contract.GetAllClaimsWithPagination(ctx, 2, "")
+	if err != nil || page.FetchedRecordsCount != 2 || page.Records[0].AadharNumber != "XXXX-XXXX-0124" {
+		t.Fatalf("first page = %+v, %v", page, err)
+	}
+	page, err = contract.GetAllClaimsWithPagination(ctx, 2, page.Bookmark)
+	if err != nil || page.FetchedRecordsCount != 1 || page.Records[0].ClaimID != "CLAIM3" || page.Bookmark != "" {
+		t.Fatalf("second page = %+v, %v", page, err)
+	}
+	if _, err := contract.GetAllClaimsWithPagination(ctx, 0, ""); err == nil {
+		t.Error("GetAllClaimsWithPagination with page size 0 succeeded")
+	}
+
+	var denied *errs.PermissionError
+	if err := contract.InitLedger(ctx); !errors.As(err, &denied) {
+		t.Errorf("InitLedger by the TPA = %v, want a PermissionError", err)
+	}
+	for _, claim := range []string{"CLAIM1", "CLAIM2"} {
+		if err := validateClaim(readClaim(t, ctx, claim)); err != nil {
+			t.Errorf("sample %s is invalid: %v", claim, err)
+		}
+	}
+}
+
+func TestGetClaimHistory(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := createClaim(t, newContext(newNetwork(), chaincodetest.Hospital), "CLAIM1")
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM1", review)
+
+	history, err := contract.GetClaimHistory(ctx, "CLAIM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Record.Status != StatusUnderReview || history[1].Record.Status != StatusSubmitted {
+		t.Fatalf("history = %+v", history)
+	}
+	for _, entry := range history {
+		if entry.Record.AadharNumber != "XXXX-XXXX-0124" {
+			t.Errorf("history entry %s shows Aadhaar number %s to the TPA", entry.TxID, entry.Record.AadharNumber)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := newContext(newNetwork(), chaincodetest.Insurer)
+
+	// A claim as stored before composite keys and Money
+	legacy := `{"claimID":"CLAIM1","treatmentID":"TREATMENT1","patientID":"PATIENT1","aadharNumber":"234567890124",` +
+		`"insuranceNumber":"INS123456","status":"Approved","requestedAmount":500.5,"approvedAmount":500.5,"disallowedAmount":0}`
+	if err := ctx.Stub.PutState("CLAIM1", []byte(legacy)); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := contract.MigrateKeys(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateKeys = %d, %v; want 1", migrated, err)
+	}
+	migrated, err = contract.MigrateMoney(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateMoney = %d, %v; want 1", migrated, err)
+	}
+	migrated, err = contract.MigrateMoney(ctx)
+	if err != nil || migrated != 0 {
+		t.Errorf("second MigrateMoney = %d, %v; want 0", migrated, err)
+	}
+	if claim := readClaim(t, ctx, "CLAIM1"); claim.ApprovedAmount != chaincodetest.INR(50050) {
+		t.Errorf("claim after migration = %+v", claim)
+	}
+
+	ctx.Client = chaincodetest.TPA
+	var denied *errs.PermissionError
+	if _, err := contract.MigrateKeys(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigrateKeys by the TPA = %v, want a PermissionError", err)
+	}
+	if _, err := contract.MigrateMoney(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigrateMoney by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestValidateClaim(t *testing.T) {
+	var fieldErrors validation.Errors
+	err := validateClaim(&InsuranceClaim{AadharNumber: "1234"})
+	if !errors.As(err, &fieldErrors) || len(fieldErrors) != 5 {
+		t.Errorf("validateClaim of an empty claim = %v, want 5 field errors", err)
+	}
+}
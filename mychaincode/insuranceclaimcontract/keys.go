@@ -0,0 +1,22 @@
+package main
+
+import (
+	"common/access"
+	"common/ledger"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// claimRepository stores insurance claims under composite keys of object type "claim~id"
+var claimRepository = ledger.Repository[InsuranceClaim]{ObjectType: "claim~id", Kind: "claim", IDName: "ID"}
+
+// MigrateKeys moves claim records stored under bare keys such as CLAIM1 to their
+// composite keys, returning how many records were moved
+func (s *InsuranceClaimContract) MigrateKeys(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigrateKeys", access.InsuranceMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	return claimRepository.MigrateKeys(ctx)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"common/aadhaar"
+	"common/access"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// aadharOwnerMSPs are the organizations that see the Aadhaar numbers on claims in full.
+// Everyone else gets them masked as XXXX-XXXX-1234.
+var aadharOwnerMSPs = []string{access.HealthcareMSP, access.InsuranceMSP}
+
+// maskClaims masks the Aadhaar numbers of the given claims in place unless the
+// submitting client belongs to one of aadharOwnerMSPs
+func maskClaims(ctx contractapi.TransactionContextInterface, claims ...*InsuranceClaim) error {
+	owner, err := access.ClientInMSP(ctx, aadharOwnerMSPs...)
+	if err != nil || owner {
+		return err
+	}
+
+	for _, claim := range claims {
+		claim.AadharNumber = aadhaar.Mask(claim.AadharNumber)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The rich queries below need CouchDB as the state database. Each names the index it
+// relies on; the index definitions ship in META-INF/statedb/couchdb/indexes.
+
+// QueryClaimsByStatus returns all claims in the given status
+func (s *InsuranceClaimContract) QueryClaimsByStatus(ctx contractapi.TransactionContextInterface, status string) ([]*InsuranceClaim, error) {
+	if !isKnownStatus(status) {
+		return nil, unknownStatus(status)
+	}
+
+	return queryClaims(ctx, map[string]string{"status": status}, "indexStatus")
+}
+
+// QueryClaimsByPatient returns all claims filed for a patient
+func (s *InsuranceClaimContract) QueryClaimsByPatient(ctx contractapi.TransactionContextInterface, patientID string) ([]*InsuranceClaim, error) {
+	return queryClaims(ctx, map[string]string{"patientID": patientID}, "indexPatient")
+}
+
+// QueryClaimsByInsurance returns all claims filed against a policy
+func (s *InsuranceClaimContract) QueryClaimsByInsurance(ctx contractapi.TransactionContextInterface, insuranceNumber string) ([]*InsuranceClaim, error) {
+	return queryClaims(ctx, map[string]string{"insuranceNumber": insuranceNumber}, "indexInsurance")
+}
+
+// QueryClaimsByTreatment returns all claims filed for a treatment
+func (s *InsuranceClaimContract) QueryClaimsByTreatment(ctx contractapi.TransactionContextInterface, treatmentID string) ([]*InsuranceClaim, error) {
+	return queryClaims(ctx, map[string]string{"treatmentID": treatmentID}, "indexTreatment")
+}
+
+// QueryClaimsByInsuranceAndStatus returns the claims against a policy that are in the given
+// status, e.g. all Submitted claims for INS123456
+func (s *InsuranceClaimContract) QueryClaimsByInsuranceAndStatus(
+	ctx contractapi.TransactionContextInterface,
+	insuranceNumber string,
+	status string,
+) ([]*InsuranceClaim, error) {
+	if !isKnownStatus(status) {
+		return nil, unknownStatus(status)
+	}
+
+	return queryClaims(ctx, map[string]string{"insuranceNumber": insuranceNumber, "status": status}, "indexInsuranceStatus")
+}
+
+// queryClaims runs a CouchDB query matching claims whose fields equal the given values,
+// hinting the named index
+func queryClaims(ctx contractapi.TransactionContextInterface, selector map[string]string, index string) ([]*InsuranceClaim, error) {
+	query := map[string]interface{}{
+		"selector":  selector,
+		"use_index": []string{"_design/" + index + "Doc", index},
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := claimRepository.Query(ctx, string(queryJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	err = maskClaims(ctx, claims...)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
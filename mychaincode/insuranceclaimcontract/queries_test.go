@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"common/chaincodetest"
+)
+
+func TestQueryClaims(t *testing.T) {
+	contract := new(InsuranceClaimContract)
+	ctx := newContext(newNetwork(), chaincodetest.Insurer)
+	if err := contract.InitLedger(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx = createClaimFor(t, ctx, "CLAIM3", "TREATMENT3")
+	ctx = moveClaim(t, ctx, chaincodetest.TPA, "CLAIM3", review)
+
+	// ids returns the IDs of the claims a query found
+	ids := func(claims []*InsuranceClaim, err error) []string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var claimIDs []string
+		for _, claim := range claims {
+			claimIDs = append(claimIDs, claim.ClaimID)
+		}
+		return claimIDs
+	}
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"by status", ids(contract.QueryClaimsByStatus(ctx, StatusApproved)), []string{"CLAIM2"}},
+		{"by patient", ids(contract.QueryClaimsByPatient(ctx, "PATIENT1")), []string{"CLAIM1", "CLAIM3"}},
+		{"by insurance", ids(contract.QueryClaimsByInsurance(ctx, "INS654321")), []string{"CLAIM2"}},
+		{"by treatment", ids(contract.QueryClaimsByTreatment(ctx, "TREATMENT3")), []string{"CLAIM3"}},
+		{"by insurance and status", ids(contract.QueryClaimsByInsuranceAndStatus(ctx, "INS123456", StatusUnderReview)), []string{"CLAIM3"}},
+		{"with no match", ids(contract.QueryClaimsByPatient(ctx, "PATIENT9")), nil},
+	}
+	for _, tt := range tests {
+		if len(tt.got) != len(tt.want) {
+			t.Errorf("query %s = %v, want %v", tt.name, tt.got, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if tt.got[i] != tt.want[i] {
+				t.Errorf("query %s = %v, want %v", tt.name, tt.got, tt.want)
+			}
+		}
+	}
+
+	ctx.Client = chaincodetest.TPA
+	claims, err := contract.QueryClaimsByPatient(ctx, "PATIENT1")
+	if err != nil || claims[0].AadharNumber != "XXXX-XXXX-0124" {
+		t.Errorf("QueryClaimsByPatient by the TPA = %+v, %v; want the Aadhaar number masked", claims, err)
+	}
+
+	if _, err := contract.QueryClaimsByStatus(ctx, "Pending"); err == nil {
+		t.Error("QueryClaimsByStatus of an unknown status succeeded")
+	}
+	if _, err := contract.QueryClaimsByInsuranceAndStatus(ctx, "INS123456", "Pending"); err == nil {
+		t.Error("QueryClaimsByInsuranceAndStatus of an unknown status succeeded")
+	}
+}
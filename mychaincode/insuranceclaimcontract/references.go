@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"common/errs"
+	"common/invoke"
+	"common/money"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// treatmentRecord holds the fields of a treatmentcc TreatmentRecord that claims rely on
+type treatmentRecord struct {
+	PatientID     string      `json:"patientID"`
+	HospitalName  string      `json:"hospitalName"`
+	AdmissionDate string      `json:"admissionDate"`
+	ReleaseDate   string      `json:"releaseDate"`
+	BillingAmount money.Money `json:"billingAmount"`
+}
+
+// patientRecord holds the fields of a patientcc PatientRecord that claims rely on. The
+// patient's details are private, so patientcc compares the Aadhaar number itself.
+type patientRecord struct {
+	InsuranceNumber string `json:"insuranceNumber"`
+}
+
+// policyRecord holds the fields of an insurancecc Insurance that claims rely on
+type policyRecord struct {
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+}
+
+// covers reports whether date falls within the policy period, both ends included
+func (p *policyRecord) covers(date time.Time) (bool, error) {
+	start, err := time.Parse(validation.DateLayout, p.StartDate)
+	if err != nil {
+		return false, fmt.Errorf("policy has an invalid start date %q", p.StartDate)
+	}
+	end, err := time.Parse(validation.DateLayout, p.EndDate)
+	if err != nil {
+		return false, fmt.Errorf("policy has an invalid end date %q", p.EndDate)
+	}
+	return !date.Before(start) && !date.After(end), nil
+}
+
+// validateClaimReferences checks that the treatment, patient and policy a claim refers
+// to exist and agree with each other and with the claim, and that the policy was in force
+// when the patient was admitted. It returns the claim's treatment.
+func validateClaimReferences(ctx contractapi.TransactionContextInterface, claim *InsuranceClaim) (*treatmentRecord, error) {
+	var treatment treatmentRecord
+	err := invoke.Chaincode(ctx, invoke.TreatmentChaincode, &treatment, "ReadTreatmentRecord", claim.TreatmentID)
+	if err != nil {
+		return nil, err
+	}
+	if treatment.PatientID != claim.PatientID {
+		return nil, errs.New(errs.ValidationFailed, "treatment %s belongs to patient %s, not %s", claim.TreatmentID, treatment.PatientID, claim.PatientID).
+			With("treatmentID", claim.TreatmentID).With("patientID", claim.PatientID)
+	}
+
+	var patient patientRecord
+	err = invoke.Chaincode(ctx, invoke.PatientChaincode, &patient, "ReadPatientRecord", claim.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	if patient.InsuranceNumber != claim.InsuranceNumber {
+		return nil, errs.New(errs.ValidationFailed, "patient %s is insured under %s, not %s", claim.PatientID, patient.InsuranceNumber, claim.InsuranceNumber).
+			With("patientID", claim.PatientID).With("insuranceNumber", claim.InsuranceNumber)
+	}
+	var patientsAadhar bool
+	err = invoke.Chaincode(ctx, invoke.PatientChaincode, &patientsAadhar, "VerifyPatientAadhar", claim.PatientID, claim.AadharNumber)
+	if err != nil {
+		return nil, err
+	}
+	if !patientsAadhar {
+		return nil, errs.New(errs.ValidationFailed, "aadhar number on claim does not match patient %s", claim.PatientID).
+			With("patientID", claim.PatientID)
+	}
+
+	// insurancecc masks Aadhaar numbers for hospitals and TPAs, so ask it to compare
+	var heldByClaimant bool
+	err = invoke.Chaincode(ctx, invoke.InsuranceChaincode, &heldByClaimant, "VerifyInsuranceAadhar", claim.InsuranceNumber, claim.AadharNumber)
+	if err != nil {
+		return nil, err
+	}
+	if !heldByClaimant {
+		return nil, errs.New(errs.ValidationFailed, "insurance %s is not held by the claimant's aadhar number", claim.InsuranceNumber).
+			With("insuranceNumber", claim.InsuranceNumber)
+	}
+
+	var policy policyRecord
+	err = invoke.Chaincode(ctx, invoke.InsuranceChaincode, &policy, "ReadInsurance", claim.InsuranceNumber)
+	if err != nil {
+		return nil, err
+	}
+	admitted, err := time.Parse(validation.DateLayout, treatment.AdmissionDate)
+	if err != nil {
+		return nil, fmt.Errorf("treatment %s has an invalid admission date %q", claim.TreatmentID, treatment.AdmissionDate)
+	}
+	covered, err := policy.covers(admitted)
+	if err != nil {
+		return nil, fmt.Errorf("insurance %s: %v", claim.InsuranceNumber, err)
+	}
+	if !covered {
+		return nil, errs.New(errs.ValidationFailed, "treatment %s was admitted on %s, outside the period of insurance %s from %s to %s",
+			claim.TreatmentID, treatment.AdmissionDate, claim.InsuranceNumber, policy.StartDate, policy.EndDate).
+			With("treatmentID", claim.TreatmentID).With("admissionDate", treatment.AdmissionDate).
+			With("insuranceNumber", claim.InsuranceNumber).With("startDate", policy.StartDate).With("endDate", policy.EndDate)
+	}
+
+	return &treatment, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+
+	"common/ledger"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// deriveAges sets the ages of the given policy holders from their dates of birth as of
+// the transaction timestamp. Ages are not stored for policies with a date of birth, so
+// they cannot go stale; older policies without one keep their stored age.
+func deriveAges(ctx contractapi.TransactionContextInterface, insurances ...*Insurance) error {
+	today, err := ledger.TxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, insurance := range insurances {
+		dob, err := time.Parse(validation.DateLayout, insurance.DOB)
+		if err != nil {
+			continue
+		}
+		insurance.Age = validation.AgeOn(dob, today)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package main
+
+// Chaincode event names. Every mutating transaction emits exactly one of them, with an
+// events.RecordEvent as payload. InitLedger and the migrations emit none.
+const (
+	EventInsuranceCreated  = "InsuranceCreated"
+	EventInsuranceUpdated  = "InsuranceUpdated"
+	EventClaimLimitDebited = "ClaimLimitDebited"
+	EventInsuranceDeleted  = "InsuranceDeleted"
+	EventInsuranceRestored = "InsuranceRestored"
+	EventInsurancePurged   = "InsurancePurged"
+)
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// InsuranceHistoryEntry is one committed version of an insurance record
+type InsuranceHistoryEntry struct {
+	TxID      string     `json:"txID"`
+	Timestamp string     `json:"timestamp"` // RFC 3339, UTC
+	IsDelete  bool       `json:"isDelete"`
+	Record    *Insurance `json:"record,omitempty" metadata:",optional"` // nil when the version is a deletion
+}
+
+// GetInsuranceHistory returns every committed version of an insurance record
+func (s *InsuranceContract) GetInsuranceHistory(ctx contractapi.TransactionContextInterface, insuranceNumber string) ([]*InsuranceHistoryEntry, error) {
+	versions, err := insuranceRepository.History(ctx, insuranceNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []*InsuranceHistoryEntry
+	for _, version := range versions {
+		if version.Record != nil {
+			err = deriveAges(ctx, version.Record)
+			if err != nil {
+				return nil, err
+			}
+			err = maskInsurances(ctx, version.Record)
+			if err != nil {
+				return nil, err
+			}
+		}
+		history = append(history, &InsuranceHistoryEntry{
+			TxID:      version.TxID,
+			Timestamp: version.Timestamp,
+			IsDelete:  version.IsDelete,
+			Record:    version.Record,
+		})
+	}
+
+	return history, nil
+}
@@ -3,20 +3,33 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"common/access"
+	"common/errs"
+	"common/events"
+	"common/invoke"
+	"common/ledger"
+	"common/money"
+	"common/patch"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
 // Insurance represents the structure of an insurance record
 type Insurance struct {
-	Name            string  `json:"name"`
-	AadharNumber    string  `json:"aadharNumber"`
-	StartDate       string  `json:"startDate"`
-	EndDate         string  `json:"endDate"`
-	Age             int     `json:"age"`
-	InsuranceNumber string  `json:"insuranceNumber"` // Unique key (also used as the ledger key)
-	ClaimLimit      float64 `json:"claimLimit"`
-	AlreadyClaimed  float64 `json:"alreadyClaimed"`
+	Name            string      `json:"name"`
+	AadharNumber    string      `json:"aadharNumber"`
+	DOB             string      `json:"dob"`
+	StartDate       string      `json:"startDate"`
+	EndDate         string      `json:"endDate"`
+	Age             int         `json:"age,omitempty" metadata:",optional"` // derived from DOB, see deriveAges
+	InsuranceNumber string      `json:"insuranceNumber"`                    // Unique key (also used as the ledger key)
+	ClaimLimit      money.Money `json:"claimLimit"`
+	AlreadyClaimed  money.Money `json:"alreadyClaimed"`
+	ledger.Metadata
 }
 
 // InsuranceContract provides functions for managing insurance records
@@ -26,35 +39,36 @@ type InsuranceContract struct {
 
 // InitLedger initializes the ledger with sample insurance data (optional)
 func (s *InsuranceContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	err := access.Authorize(ctx, "InitLedger", access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
 	insurances := []Insurance{
 		{
 			Name:            "John Doe",
-			AadharNumber:    "123456789012",
+			AadharNumber:    "234567890124",
+			DOB:             "1990-01-01",
 			StartDate:       "2023-01-01",
 			EndDate:         "2024-01-01",
-			Age:             35,
 			InsuranceNumber: "INS123456",
-			ClaimLimit:      100000.00,
-			AlreadyClaimed:  25000.00,
+			ClaimLimit:      money.Money{Amount: 10000000, Currency: money.DefaultCurrency},
+			AlreadyClaimed:  money.Money{Amount: 2500000, Currency: money.DefaultCurrency},
 		},
 		{
 			Name:            "Jane Smith",
-			AadharNumber:    "987654321098",
+			AadharNumber:    "987654321096",
+			DOB:             "1995-05-05",
 			StartDate:       "2023-02-15",
 			EndDate:         "2024-02-15",
-			Age:             28,
 			InsuranceNumber: "INS654321",
-			ClaimLimit:      150000.00,
-			AlreadyClaimed:  50000.00,
+			ClaimLimit:      money.Money{Amount: 15000000, Currency: money.DefaultCurrency},
+			AlreadyClaimed:  money.Money{Amount: 5000000, Currency: money.DefaultCurrency},
 		},
 	}
 
 	for _, insurance := range insurances {
-		insuranceJSON, err := json.Marshal(insurance)
-		if err != nil {
-			return err
-		}
-		err = ctx.GetStub().PutState(insurance.InsuranceNumber, insuranceJSON)
+		err = insuranceRepository.Put(ctx, insurance.InsuranceNumber, &insurance)
 		if err != nil {
 			return fmt.Errorf("failed to put insurance record: %v", err)
 		}
@@ -63,151 +77,470 @@ func (s *InsuranceContract) InitLedger(ctx contractapi.TransactionContextInterfa
 	return nil
 }
 
-// CreateInsurance adds a new insurance record to the ledger
+// CreateInsurance adds a new insurance record to the ledger. Amounts are parsed with
+// money.Parse, e.g. "100000" or "INR 100000.00". The policy holder's age is derived from
+// dob; pass 0 for age, or the age as of the transaction to have it checked.
 func (s *InsuranceContract) CreateInsurance(
 	ctx contractapi.TransactionContextInterface,
 	insuranceNumber string,
 	name string,
 	aadharNumber string,
+	dob string,
 	startDate string,
 	endDate string,
 	age int,
-	claimLimit float64,
-	alreadyClaimed float64,
+	claimLimit string,
+	alreadyClaimed string,
 ) error {
-	exists, err := s.InsuranceExists(ctx, insuranceNumber)
+	err := access.Authorize(ctx, "CreateInsurance", access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	exists, err := insuranceRepository.Exists(ctx, insuranceNumber)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("insurance with number %s already exists", insuranceNumber)
+		return insuranceRepository.AlreadyExists(insuranceNumber)
 	}
+	today, err := ledger.TxTime(ctx)
+	if err != nil {
+		return err
+	}
+	var v validation.Validator
+	limit, err := money.Parse(claimLimit)
+	v.AddError("claimLimit", err)
+	claimed, err := money.Parse(alreadyClaimed)
+	v.AddError("alreadyClaimed", err)
 
 	insurance := Insurance{
 		Name:            name,
 		AadharNumber:    aadharNumber,
+		DOB:             dob,
 		StartDate:       startDate,
 		EndDate:         endDate,
-		Age:             age,
 		InsuranceNumber: insuranceNumber,
-		ClaimLimit:      claimLimit,
-		AlreadyClaimed:  alreadyClaimed,
+		ClaimLimit:      limit,
+		AlreadyClaimed:  claimed,
+	}
+	validateInsurance(&v, &insurance, age, today)
+	err = v.Err()
+	if err != nil {
+		return err
 	}
 
-	insuranceJSON, err := json.Marshal(insurance)
+	err = insuranceRepository.Put(ctx, insuranceNumber, &insurance)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(insuranceNumber, insuranceJSON)
+	return events.Emit(ctx, EventInsuranceCreated, insuranceNumber, "", "")
 }
 
-// ReadInsurance retrieves an insurance record by insuranceNumber
+// ReadInsurance retrieves an insurance record by insuranceNumber. The age is as of the
+// transaction timestamp, and the Aadhaar number is masked for clients outside the insurer.
 func (s *InsuranceContract) ReadInsurance(ctx contractapi.TransactionContextInterface, insuranceNumber string) (*Insurance, error) {
-	insuranceJSON, err := ctx.GetStub().GetState(insuranceNumber)
+	insurance, err := insuranceRepository.Read(ctx, insuranceNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if insuranceJSON == nil {
-		return nil, fmt.Errorf("insurance with number %s does not exist", insuranceNumber)
+		return nil, err
 	}
 
-	var insurance Insurance
-	err = json.Unmarshal(insuranceJSON, &insurance)
+	err = deriveAges(ctx, insurance)
+	if err != nil {
+		return nil, err
+	}
+	err = maskInsurances(ctx, insurance)
 	if err != nil {
 		return nil, err
 	}
 
-	return &insurance, nil
+	return insurance, nil
 }
 
-// UpdateInsurance updates an existing insurance record
+// UpdateInsurance updates an existing insurance record, taking the same arguments as
+// CreateInsurance but alreadyClaimed, which only DebitClaimLimit changes once a policy
+// exists. It fails with CONFLICT unless expectedVersion is 0 or the record's current version.
 func (s *InsuranceContract) UpdateInsurance(
 	ctx contractapi.TransactionContextInterface,
 	insuranceNumber string,
 	name string,
 	aadharNumber string,
+	dob string,
 	startDate string,
 	endDate string,
 	age int,
-	claimLimit float64,
-	alreadyClaimed float64,
+	claimLimit string,
+	expectedVersion int,
 ) error {
-	exists, err := s.InsuranceExists(ctx, insuranceNumber)
+	err := access.Authorize(ctx, "UpdateInsurance", access.InsuranceMSP)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("insurance with number %s does not exist", insuranceNumber)
+
+	existing, err := insuranceRepository.Read(ctx, insuranceNumber)
+	if err != nil {
+		return err
 	}
+	err = insuranceRepository.CheckVersion(insuranceNumber, existing, expectedVersion)
+	if err != nil {
+		return err
+	}
+	today, err := ledger.TxTime(ctx)
+	if err != nil {
+		return err
+	}
+	var v validation.Validator
+	limit, err := money.Parse(claimLimit)
+	v.AddError("claimLimit", err)
 
 	insurance := Insurance{
 		Name:            name,
 		AadharNumber:    aadharNumber,
+		DOB:             dob,
 		StartDate:       startDate,
 		EndDate:         endDate,
-		Age:             age,
 		InsuranceNumber: insuranceNumber,
-		ClaimLimit:      claimLimit,
-		AlreadyClaimed:  alreadyClaimed,
+		ClaimLimit:      limit,
+		AlreadyClaimed:  existing.AlreadyClaimed,
+	}
+	validateInsurance(&v, &insurance, age, today)
+	err = v.Err()
+	if err != nil {
+		return err
 	}
 
-	insuranceJSON, err := json.Marshal(insurance)
+	err = insuranceRepository.Put(ctx, insuranceNumber, &insurance)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(insuranceNumber, insuranceJSON)
+	return events.Emit(ctx, EventInsuranceUpdated, insuranceNumber, "", "")
 }
 
-// DeleteInsurance deletes an insurance record
-func (s *InsuranceContract) DeleteInsurance(ctx contractapi.TransactionContextInterface, insuranceNumber string) error {
-	exists, err := s.InsuranceExists(ctx, insuranceNumber)
+// PatchInsurance changes only the fields named in patch, a JSON object such as
+// {"endDate": "2025-12-31"}, keeping the others as stored. Amounts are given as
+// {"amount": 5000000, "currency": "INR"} in paise, or as a plain number of rupees. The
+// insurance number and, as in UpdateInsurance, alreadyClaimed cannot be patched. Like
+// UpdateInsurance, it checks expectedVersion unless it is 0.
+func (s *InsuranceContract) PatchInsurance(ctx contractapi.TransactionContextInterface, insuranceNumber string, patchJSON string, expectedVersion int) error {
+	err := access.Authorize(ctx, "PatchInsurance", access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	insurance, err := insuranceRepository.Read(ctx, insuranceNumber)
+	if err != nil {
+		return err
+	}
+	err = insuranceRepository.CheckVersion(insuranceNumber, insurance, expectedVersion)
+	if err != nil {
+		return err
+	}
+	// A patched age is checked against the date of birth like a submitted one
+	insurance.Age = 0
+	err = patch.Apply(insurance, []byte(patchJSON), append([]string{"insuranceNumber", "alreadyClaimed"}, ledger.MetadataFields...)...)
+	if err != nil {
+		return err
+	}
+	today, err := ledger.TxTime(ctx)
+	if err != nil {
+		return err
+	}
+	var v validation.Validator
+	validateInsurance(&v, insurance, insurance.Age, today)
+	err = v.Err()
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("insurance with number %s does not exist", insuranceNumber)
+
+	insurance.Age = 0
+	err = insuranceRepository.Put(ctx, insuranceNumber, insurance)
+	if err != nil {
+		return err
 	}
 
-	return ctx.GetStub().DelState(insuranceNumber)
+	return events.Emit(ctx, EventInsuranceUpdated, insuranceNumber, "", "")
 }
 
-// InsuranceExists checks if an insurance record exists
-func (s *InsuranceContract) InsuranceExists(ctx contractapi.TransactionContextInterface, insuranceNumber string) (bool, error) {
-	insuranceJSON, err := ctx.GetStub().GetState(insuranceNumber)
+// DebitClaimLimit records an approved claim payout against a policy, failing with
+// LIMIT_EXCEEDED if the amount exceeds the policy's remaining headroom
+// (ClaimLimit - AlreadyClaimed). It is only called by ApproveClaim on the claim
+// chaincode, so that every debit belongs to a claim being approved.
+func (s *InsuranceContract) DebitClaimLimit(ctx contractapi.TransactionContextInterface, insuranceNumber string, amount string) error {
+	err := access.AuthorizeRole(ctx, "DebitClaimLimit", access.AdjudicatorRole, access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+	err = invoke.AuthorizeCaller(ctx, "DebitClaimLimit", invoke.ClaimChaincode)
+	if err != nil {
+		return err
+	}
+
+	var v validation.Validator
+	debit, err := money.Parse(amount)
+	v.AddError("amount", err)
+	if err == nil && debit.Amount <= 0 {
+		v.Fail("amount", "must be positive, got %s", debit)
+	}
+	err = v.Err()
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return err
+	}
+
+	insurance, err := insuranceRepository.Read(ctx, insuranceNumber)
+	if err != nil {
+		return err
+	}
+
+	remaining, err := insurance.ClaimLimit.Sub(insurance.AlreadyClaimed)
+	if err != nil {
+		return err
+	}
+	left, err := remaining.Sub(debit)
+	v.AddError("amount", err)
+	err = v.Err()
+	if err != nil {
+		return err
 	}
-	return insuranceJSON != nil, nil
+	if left.Amount < 0 {
+		return errs.New(errs.LimitExceeded, "claim amount %s exceeds remaining limit %s on insurance %s", debit, remaining, insuranceNumber).
+			With("insuranceNumber", insuranceNumber).With("amount", debit.String()).With("remaining", remaining.String())
+	}
+	insurance.AlreadyClaimed, err = insurance.AlreadyClaimed.Add(debit)
+	if err != nil {
+		return err
+	}
+
+	err = insuranceRepository.Put(ctx, insuranceNumber, insurance)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventClaimLimitDebited, insuranceNumber, "", "")
 }
 
-// GetAllInsurances returns all insurance records
-func (s *InsuranceContract) GetAllInsurances(ctx contractapi.TransactionContextInterface) ([]*Insurance, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+// GetRemainingClaimLimit returns how much can still be claimed on a policy
+func (s *InsuranceContract) GetRemainingClaimLimit(ctx contractapi.TransactionContextInterface, insuranceNumber string) (*money.Money, error) {
+	insurance, err := insuranceRepository.Read(ctx, insuranceNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := insurance.ClaimLimit.Sub(insurance.AlreadyClaimed)
 	if err != nil {
 		return nil, err
 	}
+
+	return &remaining, nil
+}
+
+// validateInsurance checks the fields of an insurance policy, adding every invalid one to
+// v. A submitted age must match the one derived from the date of birth as of today.
+func validateInsurance(v *validation.Validator, insurance *Insurance, age int, today time.Time) {
+	v.Required("insuranceNumber", insurance.InsuranceNumber)
+	v.Required("name", insurance.Name)
+	v.Aadhaar("aadharNumber", insurance.AadharNumber)
+	v.DateOrder("startDate", insurance.StartDate, "endDate", insurance.EndDate)
+	if derived, ok := v.DateOfBirth("dob", insurance.DOB, today); ok {
+		v.Age("age", age, derived)
+	}
+	if insurance.ClaimLimit.Amount < 0 {
+		v.Fail("claimLimit", "must not be negative")
+	}
+	if insurance.AlreadyClaimed.Amount < 0 {
+		v.Fail("alreadyClaimed", "must not be negative")
+	}
+	if headroom, err := insurance.ClaimLimit.Sub(insurance.AlreadyClaimed); err != nil {
+		v.AddError("alreadyClaimed", err)
+	} else if headroom.Amount < 0 {
+		v.Fail("alreadyClaimed", "must not exceed claimLimit")
+	}
+}
+
+// DeleteInsurance soft deletes an insurance record for the given reason. The record is
+// kept, marked deleted, but no longer read or listed until RestoreInsurance. A policy
+// with open claims cannot be deleted.
+func (s *InsuranceContract) DeleteInsurance(ctx contractapi.TransactionContextInterface, insuranceNumber string, reason string) error {
+	err := access.Authorize(ctx, "DeleteInsurance", access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	_, err = insuranceRepository.Read(ctx, insuranceNumber)
+	if err != nil {
+		return err
+	}
+	claimIDs, err := invoke.OpenClaimIDs(ctx, "QueryClaimsByInsurance", insuranceNumber)
+	if err != nil {
+		return err
+	}
+	if len(claimIDs) > 0 {
+		return insuranceRepository.InUse(insuranceNumber, "open claims", claimIDs)
+	}
+	_, err = insuranceRepository.SoftDelete(ctx, insuranceNumber, reason)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventInsuranceDeleted, insuranceNumber, "", "")
+}
+
+// RestoreInsurance undoes the soft deletion of an insurance record
+func (s *InsuranceContract) RestoreInsurance(ctx contractapi.TransactionContextInterface, insuranceNumber string) error {
+	err := access.Authorize(ctx, "RestoreInsurance", access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	_, err = insuranceRepository.Restore(ctx, insuranceNumber)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventInsuranceRestored, insuranceNumber, "", "")
+}
+
+// PurgeInsurance removes a soft deleted insurance record from the world state for good,
+// unless claims were filed against it. Only the insurer's admins may call it.
+func (s *InsuranceContract) PurgeInsurance(ctx contractapi.TransactionContextInterface, insuranceNumber string) error {
+	err := access.RequireRole(ctx, "PurgeInsurance", access.AdminRole, access.InsuranceMSP)
+	if err != nil {
+		return err
+	}
+
+	// Closed claims keep referring to a deleted policy, but must not lose it
+	claimIDs, err := invoke.ClaimIDs(ctx, "QueryClaimsByInsurance", insuranceNumber)
+	if err != nil {
+		return err
+	}
+	if len(claimIDs) > 0 {
+		return insuranceRepository.InUse(insuranceNumber, "claims", claimIDs)
+	}
+	err = insuranceRepository.Purge(ctx, insuranceNumber)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventInsurancePurged, insuranceNumber, "", "")
+}
+
+// InsuranceExists checks if an insurance record exists, including soft deleted ones,
+// whose numbers cannot be reused
+func (s *InsuranceContract) InsuranceExists(ctx contractapi.TransactionContextInterface, insuranceNumber string) (bool, error) {
+	return insuranceRepository.Exists(ctx, insuranceNumber)
+}
+
+// MigrateMoney rewrites insurance records whose claim amounts are still stored as
+// floating point numbers into Money, returning how many records were converted.
+// Run MigrateKeys first.
+func (s *InsuranceContract) MigrateMoney(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigrateMoney", access.InsuranceMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(insuranceRepository.ObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
 	defer resultsIterator.Close()
 
-	var insurances []*Insurance
+	migrated := 0
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return nil, err
+			return 0, err
+		}
+
+		legacy, err := money.HasLegacyAmount(queryResponse.Value, "claimLimit", "alreadyClaimed")
+		if err != nil {
+			return 0, err
+		}
+		if !legacy {
+			continue
 		}
 
 		var insurance Insurance
 		err = json.Unmarshal(queryResponse.Value, &insurance)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		insurances = append(insurances, &insurance)
+		err = insuranceRepository.Put(ctx, insurance.InsuranceNumber, &insurance)
+		if err != nil {
+			return 0, fmt.Errorf("failed to put insurance record: %v", err)
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// GetAllInsurances returns all insurance records except the soft deleted ones
+func (s *InsuranceContract) GetAllInsurances(ctx contractapi.TransactionContextInterface) ([]*Insurance, error) {
+	insurances, err := insuranceRepository.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = deriveAges(ctx, insurances...)
+	if err != nil {
+		return nil, err
+	}
+	err = maskInsurances(ctx, insurances...)
+	if err != nil {
+		return nil, err
 	}
 
 	return insurances, nil
 }
 
+// GetDeletedInsurances returns the soft deleted insurance records
+func (s *InsuranceContract) GetDeletedInsurances(ctx contractapi.TransactionContextInterface) ([]*Insurance, error) {
+	insurances, err := insuranceRepository.Deleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = deriveAges(ctx, insurances...)
+	if err != nil {
+		return nil, err
+	}
+	err = maskInsurances(ctx, insurances...)
+	if err != nil {
+		return nil, err
+	}
+
+	return insurances, nil
+}
+
+// InsurancePage is one page of insurance records along with the bookmark for the next page
+type InsurancePage struct {
+	Records             []*Insurance `json:"records"`
+	FetchedRecordsCount int32        `json:"fetchedRecordsCount"`
+	Bookmark            string       `json:"bookmark"`
+}
+
+// GetAllInsurancesWithPagination returns up to pageSize insurances starting at bookmark.
+// Pass an empty bookmark for the first page and the returned bookmark for the next.
+func (s *InsuranceContract) GetAllInsurancesWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*InsurancePage, error) {
+	page, err := insuranceRepository.Page(ctx, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	err = deriveAges(ctx, page.Records...)
+	if err != nil {
+		return nil, err
+	}
+	err = maskInsurances(ctx, page.Records...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InsurancePage{Records: page.Records, FetchedRecordsCount: page.FetchedRecordsCount, Bookmark: page.Bookmark}, nil
+}
+
 func main() {
 	chaincode, err := contractapi.NewChaincode(new(InsuranceContract))
 	if err != nil {
@@ -215,7 +548,8 @@ func main() {
 		return
 	}
 
-	if err := chaincode.Start(); err != nil {
+	// Wrapped, every error reaches clients as an errs.Error they can branch on by code
+	if err := shim.Start(errs.WithCodes(chaincode)); err != nil {
 		fmt.Printf("Error starting insurance chaincode: %v\n", err)
 	}
-}
\ No newline at end of file
+}
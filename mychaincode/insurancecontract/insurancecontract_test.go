@@ -0,0 +1,664 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"common/access"
+	"common/chaincodetest"
+	"common/claimstatus"
+	"common/errs"
+	"common/invoke"
+	"common/ledger"
+	"common/validation"
+)
+
+// policyArgs are the arguments of CreateInsurance and UpdateInsurance after the insurance
+// number. UpdateInsurance takes no alreadyClaimed.
+type policyArgs struct {
+	name, aadharNumber, dob, startDate, endDate string
+	age                                         int
+	claimLimit, alreadyClaimed                  string
+	version                                     int // expected by update, 0 for any
+}
+
+// sampleArgs returns the arguments of a valid policy, aged as of chaincodetest.Epoch
+func sampleArgs() policyArgs {
+	return policyArgs{
+		name:           "John Doe",
+		aadharNumber:   "234567890124",
+		dob:            "1990-01-01",
+		startDate:      "2023-01-01",
+		endDate:        "2024-01-01",
+		age:            34,
+		claimLimit:     "100000",
+		alreadyClaimed: "25000",
+	}
+}
+
+func create(ctx *chaincodetest.Context, insuranceNumber string, a policyArgs) error {
+	return new(InsuranceContract).CreateInsurance(ctx, insuranceNumber, a.name, a.aadharNumber, a.dob, a.startDate, a.endDate,
+		a.age, a.claimLimit, a.alreadyClaimed)
+}
+
+func update(ctx *chaincodetest.Context, insuranceNumber string, a policyArgs) error {
+	return new(InsuranceContract).UpdateInsurance(ctx, insuranceNumber, a.name, a.aadharNumber, a.dob, a.startDate, a.endDate,
+		a.age, a.claimLimit, a.version)
+}
+
+// createPolicy creates a policy in a transaction of its own submitted by the insurer
+func createPolicy(t *testing.T, ctx *chaincodetest.Context, insuranceNumber string, a policyArgs) *chaincodetest.Context {
+	t.Helper()
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := create(ctx, insuranceNumber, a); err != nil {
+		t.Fatalf("CreateInsurance(%s) = %v", insuranceNumber, err)
+	}
+	return ctx
+}
+
+func TestCreateInsurance(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+
+	insurance, err := contract.ReadInsurance(ctx, "INS123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Insurance{
+		Name:            "John Doe",
+		AadharNumber:    "234567890124",
+		DOB:             "1990-01-01",
+		StartDate:       "2023-01-01",
+		EndDate:         "2024-01-01",
+		Age:             34,
+		InsuranceNumber: "INS123456",
+		ClaimLimit:      chaincodetest.INR(10000000),
+		AlreadyClaimed:  chaincodetest.INR(2500000),
+		Metadata: ledger.Metadata{
+			Version:           1,
+			LastModifiedTxID:  ctx.Stub.TxID,
+			LastModifiedAt:    "2024-01-01T00:01:00Z",
+			LastModifiedBy:    chaincodetest.Insurer.ID,
+			LastModifiedByMSP: access.InsuranceMSP,
+		},
+	}
+	if *insurance != want {
+		t.Errorf("ReadInsurance = %+v, want %+v", insurance, want)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventInsuranceCreated || event.RecordID != "INS123456" {
+		t.Errorf("event = %+v", event)
+	}
+	if exists, err := contract.InsuranceExists(ctx, "INS123456"); err != nil || !exists {
+		t.Errorf("InsuranceExists = %v, %v", exists, err)
+	}
+}
+
+// TestCreateInsuranceByMSPID uses the MSP IDs of configtx.yaml rather than the access constants
+func TestCreateInsuranceByMSPID(t *testing.T) {
+	ctx := chaincodetest.NewContext("InsuranceMSP")
+	if err := create(ctx, "INS123456", sampleArgs()); err != nil {
+		t.Errorf("CreateInsurance by InsuranceMSP = %v", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.NewClient("TPAMSP"))
+	var denied *errs.PermissionError
+	if err := create(ctx, "INS654321", sampleArgs()); !errors.As(err, &denied) {
+		t.Errorf("CreateInsurance by TPAMSP = %v, want a PermissionError", err)
+	}
+}
+
+func TestCreateInsuranceErrors(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+
+	var exists *errs.AlreadyExistsError
+	if err := create(ctx, "INS123456", sampleArgs()); !errors.As(err, &exists) {
+		t.Errorf("CreateInsurance of an existing number = %v, want an AlreadyExistsError", err)
+	}
+
+	tests := map[string]func(a *policyArgs){
+		"name":           func(a *policyArgs) { a.name = "" },
+		"aadharNumber":   func(a *policyArgs) { a.aadharNumber = "123456789012" },
+		"startDate":      func(a *policyArgs) { a.startDate = "2023-13-01" },
+		"endDate":        func(a *policyArgs) { a.endDate = "2022-12-31" },
+		"dob":            func(a *policyArgs) { a.dob = "2024-01-02" },
+		"age":            func(a *policyArgs) { a.age = 35 },
+		"claimLimit":     func(a *policyArgs) { a.claimLimit, a.alreadyClaimed = "-5", "0" },
+		"alreadyClaimed": func(a *policyArgs) { a.alreadyClaimed = "100000.01" },
+	}
+	for field, change := range tests {
+		a := sampleArgs()
+		change(&a)
+		var fieldErrors validation.Errors
+		err := create(ctx, "INS000001", a)
+		if !errors.As(err, &fieldErrors) || fieldErrors[0].Field != field {
+			t.Errorf("CreateInsurance with invalid %s = %v", field, err)
+		}
+	}
+
+	a := sampleArgs()
+	a.claimLimit = "lots"
+	a.alreadyClaimed = "USD 10"
+	var fieldErrors validation.Errors
+	if err := create(ctx, "INS000001", a); !errors.As(err, &fieldErrors) || fieldErrors[0].Field != "claimLimit" {
+		t.Errorf("CreateInsurance with unparsable amounts = %v", err)
+	}
+
+	var notAllowed *errs.PermissionError
+	ctx.Client = chaincodetest.NewClient(access.HealthcareMSP)
+	if err := create(ctx, "INS000001", sampleArgs()); !errors.As(err, &notAllowed) {
+		t.Errorf("CreateInsurance by a hospital = %v, want a PermissionError", err)
+	}
+
+	if exists, _ := contract.InsuranceExists(ctx, "INS000001"); exists {
+		t.Error("a failed CreateInsurance wrote INS000001")
+	}
+}
+
+func TestReadInsuranceMasksAadhaar(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+
+	for _, mspID := range []string{access.HealthcareMSP, access.TPAMSP} {
+		ctx.Client = chaincodetest.NewClient(mspID)
+		insurance, err := contract.ReadInsurance(ctx, "INS123456")
+		if err != nil || insurance.AadharNumber != "XXXX-XXXX-0124" {
+			t.Errorf("ReadInsurance by %s = %+v, %v; want the Aadhaar number masked", mspID, insurance, err)
+		}
+
+		insurances, err := contract.GetAllInsurances(ctx)
+		if err != nil || insurances[0].AadharNumber != "XXXX-XXXX-0124" {
+			t.Errorf("GetAllInsurances by %s = %+v, %v; want the Aadhaar number masked", mspID, insurances, err)
+		}
+
+		// Asked directly, the policy would give the masked number away to guesses
+		ctx.Stub.Invoked = invoke.InsuranceChaincode
+		_, err = contract.VerifyInsuranceAadhar(ctx, "INS123456", "234567890124")
+		if coded := errs.From(err); err == nil || coded.Code != errs.Forbidden {
+			t.Errorf("VerifyInsuranceAadhar called directly by %s = %v, want FORBIDDEN", mspID, err)
+		}
+
+		// The claim chaincode can still check the full number against the policy
+		ctx.Stub.Invoked = invoke.ClaimChaincode
+		match, err := contract.VerifyInsuranceAadhar(ctx, "INS123456", "234567890124")
+		if err != nil || !match {
+			t.Errorf("VerifyInsuranceAadhar by %s = %v, %v; want true", mspID, match, err)
+		}
+		match, err = contract.VerifyInsuranceAadhar(ctx, "INS123456", "987654321096")
+		if err != nil || match {
+			t.Errorf("VerifyInsuranceAadhar of another number by %s = %v, %v; want false", mspID, match, err)
+		}
+	}
+
+	var notFound *errs.NotFoundError
+	_, err := contract.ReadInsurance(ctx, "INS000000")
+	if !errors.As(err, &notFound) || errs.From(err).Message != "insurance with number INS000000 does not exist" {
+		t.Errorf("ReadInsurance of a missing policy = %v, want a NotFoundError", err)
+	}
+	if _, err := contract.VerifyInsuranceAadhar(ctx, "INS000000", "234567890124"); !errors.As(err, &notFound) {
+		t.Errorf("VerifyInsuranceAadhar of a missing policy = %v, want a NotFoundError", err)
+	}
+
+	// Organizations outside the claim process cannot probe policies for Aadhaar numbers
+	ctx.Client = chaincodetest.NewClient("OtherMSP")
+	var denied *errs.PermissionError
+	if _, err := contract.VerifyInsuranceAadhar(ctx, "INS123456", "234567890124"); !errors.As(err, &denied) {
+		t.Errorf("VerifyInsuranceAadhar by another organization = %v, want a PermissionError", err)
+	}
+}
+
+func TestUpdateInsurance(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+
+	a := sampleArgs()
+	a.endDate = "2025-01-01"
+	a.claimLimit = "200000"
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := update(ctx, "INS123456", a); err != nil {
+		t.Fatal(err)
+	}
+	insurance, err := contract.ReadInsurance(ctx, "INS123456")
+	if err != nil || insurance.EndDate != "2025-01-01" || insurance.ClaimLimit != chaincodetest.INR(20000000) {
+		t.Errorf("ReadInsurance after update = %+v, %v", insurance, err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventInsuranceUpdated {
+		t.Errorf("event = %+v", event)
+	}
+
+	var notFound *errs.NotFoundError
+	if err := update(ctx, "INS000000", sampleArgs()); !errors.As(err, &notFound) {
+		t.Errorf("UpdateInsurance of a missing policy = %v, want a NotFoundError", err)
+	}
+
+	// Debiting the limit is a change too, so a client still holding version 2 conflicts
+	ctx = ctx.Next(chaincodetest.Insurer)
+	ctx.Stub.Invoked = invoke.ClaimChaincode
+	if err := contract.DebitClaimLimit(ctx, "INS123456", "100"); err != nil {
+		t.Fatal(err)
+	}
+	a.version = 2
+	var conflict *errs.ConflictError
+	if err := update(ctx, "INS123456", a); !errors.As(err, &conflict) || conflict.Actual != 3 {
+		t.Errorf("UpdateInsurance of version 2 = %v, want a ConflictError", err)
+	}
+
+	// Only DebitClaimLimit changes the claimed amount; an update keeps it
+	a.version = 3
+	if err := update(ctx, "INS123456", a); err != nil {
+		t.Fatal(err)
+	}
+	if insurance, _ := insuranceRepository.Read(ctx, "INS123456"); insurance.AlreadyClaimed != chaincodetest.INR(2510000) {
+		t.Errorf("claimed after update = %s, want the debited INR 25100.00", insurance.AlreadyClaimed)
+	}
+	a.version = 0
+
+	a.claimLimit = "25000"
+	var fieldErrors validation.Errors
+	if err := update(ctx, "INS123456", a); !errors.As(err, &fieldErrors) {
+		t.Errorf("UpdateInsurance with a limit below the claimed amount = %v, want field errors", err)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.TPAMSP)
+	var denied *errs.PermissionError
+	if err := update(ctx, "INS123456", sampleArgs()); !errors.As(err, &denied) {
+		t.Errorf("UpdateInsurance by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestPatchInsurance(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+	before, _ := insuranceRepository.Read(ctx, "INS123456")
+
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.PatchInsurance(ctx, "INS123456", `{"endDate": "2025-01-01", "claimLimit": 200000}`, 1); err != nil {
+		t.Fatal(err)
+	}
+	want := *before
+	want.EndDate = "2025-01-01"
+	want.ClaimLimit = chaincodetest.INR(20000000)
+	insurance, err := insuranceRepository.Read(ctx, "INS123456")
+	if err != nil || insurance.Version != 2 {
+		t.Fatalf("policy after patch = %+v, %v, want version 2", insurance, err)
+	}
+	want.Metadata = insurance.Metadata
+	if *insurance != want {
+		t.Errorf("policy after patch = %+v, %v", insurance, err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventInsuranceUpdated {
+		t.Errorf("event = %+v", event)
+	}
+
+	tests := []struct {
+		insuranceNumber string
+		patch           string
+		code            errs.Code
+	}{
+		{"INS000000", `{"endDate": "2025-01-01"}`, errs.NotFound},
+		{"INS123456", `{"insuranceNumber": "INS654321"}`, errs.ValidationFailed},
+		{"INS123456", `{"alreadyClaimed": {"amount": 30000000, "currency": "INR"}}`, errs.ValidationFailed},
+		{"INS123456", `{"alreadyClaimed": 0}`, errs.ValidationFailed},
+		{"INS123456", `{"age": 20}`, errs.ValidationFailed},
+		{"INS123456", `{"startDate": "2026-01-01"}`, errs.ValidationFailed},
+		{"INS123456", `{"version": 1}`, errs.ValidationFailed},
+	}
+	for _, tt := range tests {
+		if err := contract.PatchInsurance(ctx, tt.insuranceNumber, tt.patch, 0); errs.From(err).Code != tt.code {
+			t.Errorf("PatchInsurance(%s, %s) = %v, want %s", tt.insuranceNumber, tt.patch, err, tt.code)
+		}
+	}
+	if err := contract.PatchInsurance(ctx, "INS123456", `{"endDate": "2025-06-01"}`, 1); errs.From(err).Code != errs.Conflict {
+		t.Errorf("PatchInsurance of version 1 = %v, want CONFLICT", err)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.TPAMSP)
+	var denied *errs.PermissionError
+	if err := contract.PatchInsurance(ctx, "INS123456", `{"endDate": "2025-02-01"}`, 0); !errors.As(err, &denied) {
+		t.Errorf("PatchInsurance by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestInsuranceAge(t *testing.T) {
+	contract := new(InsuranceContract)
+	a := sampleArgs()
+	a.age = 0
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", a)
+
+	key, _ := insuranceRepository.Key(ctx, "INS123456")
+	if policyJSON, _ := ctx.Stub.GetState(key); strings.Contains(string(policyJSON), `"age"`) {
+		t.Errorf("the world state stores the age: %s", policyJSON)
+	}
+
+	ctx = ctx.Next(chaincodetest.Insurer)
+	ctx.Stub.SetTxTime(time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC))
+	insurance, err := contract.ReadInsurance(ctx, "INS123456")
+	if err != nil || insurance.Age != 35 {
+		t.Errorf("ReadInsurance a year later = %+v, %v; want age 35", insurance, err)
+	}
+
+	// Submitted ages are checked against the date of birth as of the transaction
+	var fieldErrors validation.Errors
+	if err := update(ctx, "INS123456", sampleArgs()); !errors.As(err, &fieldErrors) || fieldErrors[0].Field != "age" {
+		t.Errorf("UpdateInsurance with last year's age = %v, want an age error", err)
+	}
+	a.age = 35
+	if err := update(ctx, "INS123456", a); err != nil {
+		t.Errorf("UpdateInsurance with this year's age = %v", err)
+	}
+}
+
+func TestDebitClaimLimit(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+
+	ctx = ctx.Next(chaincodetest.Adjudicator)
+	err := contract.DebitClaimLimit(ctx, "INS123456", "INR 500.50")
+	if coded := errs.From(err); err == nil || coded.Code != errs.Forbidden {
+		t.Errorf("DebitClaimLimit called directly by the adjudicator = %v, want FORBIDDEN", err)
+	}
+
+	// Debits come from approving a claim on the claim chaincode
+	ctx.Stub.Invoked = invoke.ClaimChaincode
+	if err := contract.DebitClaimLimit(ctx, "INS123456", "INR 500.50"); err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := contract.GetRemainingClaimLimit(ctx, "INS123456")
+	if err != nil || *remaining != chaincodetest.INR(7500000-50050) {
+		t.Errorf("GetRemainingClaimLimit = %v, %v", remaining, err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventClaimLimitDebited || event.RecordID != "INS123456" {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Exactly the remaining limit may be debited, but nothing more
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.DebitClaimLimit(ctx, "INS123456", remaining.String()); err != nil {
+		t.Errorf("DebitClaimLimit of the remaining limit = %v", err)
+	}
+	err = contract.DebitClaimLimit(ctx, "INS123456", "0.01")
+	if coded := errs.From(err); err == nil || coded.Code != errs.LimitExceeded || coded.Details["remaining"] != "INR 0.00" {
+		t.Errorf("DebitClaimLimit beyond the limit = %v, want LIMIT_EXCEEDED", err)
+	}
+
+	tests := []struct {
+		name, insuranceNumber, amount string
+		code                          errs.Code
+	}{
+		{"zero", "INS123456", "0", errs.ValidationFailed},
+		{"negative", "INS123456", "-10", errs.ValidationFailed},
+		{"unparsable", "INS123456", "ten", errs.ValidationFailed},
+		{"in another currency", "INS123456", "USD 10", errs.ValidationFailed},
+		{"on a missing policy", "INS000000", "10", errs.NotFound},
+	}
+	for _, tt := range tests {
+		if err := contract.DebitClaimLimit(ctx, tt.insuranceNumber, tt.amount); err == nil || errs.From(err).Code != tt.code {
+			t.Errorf("DebitClaimLimit %s = %v, want %s", tt.name, err, tt.code)
+		}
+	}
+
+	var denied *errs.PermissionError
+	ctx.Client = chaincodetest.Insurer.WithAttribute(access.RoleAttribute, "clerk")
+	if err := contract.DebitClaimLimit(ctx, "INS123456", "1"); !errors.As(err, &denied) {
+		t.Errorf("DebitClaimLimit by a clerk = %v, want a PermissionError", err)
+	}
+	ctx.Client = chaincodetest.NewClient(access.TPAMSP)
+	if err := contract.DebitClaimLimit(ctx, "INS123456", "1"); !errors.As(err, &denied) {
+		t.Errorf("DebitClaimLimit by the TPA = %v, want a PermissionError", err)
+	}
+
+	var notFound *errs.NotFoundError
+	if _, err := contract.GetRemainingClaimLimit(ctx, "INS000000"); !errors.As(err, &notFound) {
+		t.Errorf("GetRemainingClaimLimit of a missing policy = %v, want a NotFoundError", err)
+	}
+}
+
+func TestDeleteInsurance(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+	chaincodetest.WithClaims(ctx, nil)
+
+	ctx = ctx.Next(chaincodetest.NewClient(access.HealthcareMSP))
+	var denied *errs.PermissionError
+	if err := contract.DeleteInsurance(ctx, "INS123456", "lapsed"); !errors.As(err, &denied) {
+		t.Errorf("DeleteInsurance by a hospital = %v, want a PermissionError", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.DeleteInsurance(ctx, "INS123456", ""); err == nil || errs.From(err).Code != errs.ValidationFailed {
+		t.Errorf("DeleteInsurance without a reason = %v, want %s", err, errs.ValidationFailed)
+	}
+	if err := contract.DeleteInsurance(ctx, "INS123456", "lapsed"); err != nil {
+		t.Fatal(err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventInsuranceDeleted {
+		t.Errorf("event = %+v", event)
+	}
+
+	// The policy is hidden, and can no longer be claimed against, but is kept
+	var notFound *errs.NotFoundError
+	if _, err := contract.ReadInsurance(ctx, "INS123456"); !errors.As(err, &notFound) {
+		t.Errorf("ReadInsurance of a deleted policy = %v, want a NotFoundError", err)
+	}
+	if _, err := contract.GetRemainingClaimLimit(ctx, "INS123456"); !errors.As(err, &notFound) {
+		t.Errorf("GetRemainingClaimLimit of a deleted policy = %v, want a NotFoundError", err)
+	}
+	if exists, _ := contract.InsuranceExists(ctx, "INS123456"); !exists {
+		t.Error("deleted INS123456 no longer exists")
+	}
+	if insurances, err := contract.GetAllInsurances(ctx); err != nil || len(insurances) != 0 {
+		t.Errorf("GetAllInsurances = %v, %v; want no policies", insurances, err)
+	}
+	deleted, err := contract.GetDeletedInsurances(ctx)
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("GetDeletedInsurances = %v, %v", deleted, err)
+	}
+	if d := deleted[0]; !d.Deleted || d.DeletedReason != "lapsed" || d.DeletedBy != chaincodetest.Insurer.ID || d.Age == 0 {
+		t.Errorf("deleted policy = %+v", d)
+	}
+
+	if err := contract.DeleteInsurance(ctx, "INS123456", "lapsed"); !errors.As(err, &notFound) {
+		t.Errorf("DeleteInsurance of a deleted policy = %v, want a NotFoundError", err)
+	}
+}
+
+func TestDeleteInsuranceWithClaims(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+	claims := map[string]string{"CLAIM1": "Closed", "CLAIM2": "Approved"}
+	chaincodetest.WithClaims(ctx, claims)
+
+	ctx = ctx.Next(chaincodetest.Insurer)
+	var inUse *errs.InUseError
+	err := contract.DeleteInsurance(ctx, "INS123456", "lapsed")
+	if !errors.As(err, &inUse) || len(inUse.DependentIDs) != 1 || inUse.DependentIDs[0] != "CLAIM2" {
+		t.Errorf("DeleteInsurance with an open claim = %v, want an InUseError naming CLAIM2", err)
+	}
+	if _, err := contract.ReadInsurance(ctx, "INS123456"); err != nil {
+		t.Errorf("ReadInsurance after a refused delete = %v", err)
+	}
+
+	claims["CLAIM2"] = "Closed"
+	if err := contract.DeleteInsurance(ctx, "INS123456", "lapsed"); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(chaincodetest.InsurerAdmin)
+	if err := contract.PurgeInsurance(ctx, "INS123456"); !errors.As(err, &inUse) || len(inUse.DependentIDs) != 2 {
+		t.Errorf("PurgeInsurance with closed claims = %v, want an InUseError naming both", err)
+	}
+}
+
+func TestDeleteInsuranceWithFinishedClaims(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := chaincodetest.NewContext(access.InsuranceMSP)
+	for _, status := range claimstatus.Terminal {
+		insuranceNumber := "INS-" + status
+		ctx = createPolicy(t, ctx, insuranceNumber, sampleArgs())
+		chaincodetest.WithClaims(ctx, map[string]string{"CLAIM1": status})
+
+		ctx = ctx.Next(chaincodetest.Insurer)
+		if err := contract.DeleteInsurance(ctx, insuranceNumber, "lapsed"); err != nil {
+			t.Errorf("DeleteInsurance of a policy whose only claim is %s = %v", status, err)
+		}
+	}
+}
+
+func TestRestoreInsurance(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+	chaincodetest.WithClaims(ctx, nil)
+
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.RestoreInsurance(ctx, "INS123456"); err == nil || errs.From(err).Code != errs.InvalidState {
+		t.Errorf("RestoreInsurance of a policy that is not deleted = %v, want %s", err, errs.InvalidState)
+	}
+	if err := contract.DeleteInsurance(ctx, "INS123456", "lapsed"); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(chaincodetest.Insurer)
+	if err := contract.RestoreInsurance(ctx, "INS123456"); err != nil {
+		t.Fatal(err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventInsuranceRestored {
+		t.Errorf("event = %+v", event)
+	}
+
+	insurance, err := contract.ReadInsurance(ctx, "INS123456")
+	if err != nil || insurance.Deleted || insurance.Version != 3 {
+		t.Errorf("ReadInsurance of the restored policy = %+v, %v", insurance, err)
+	}
+}
+
+func TestPurgeInsurance(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+	chaincodetest.WithClaims(ctx, nil)
+
+	ctx = ctx.Next(chaincodetest.InsurerAdmin)
+	if err := contract.PurgeInsurance(ctx, "INS123456"); err == nil || errs.From(err).Code != errs.InvalidState {
+		t.Errorf("PurgeInsurance of a policy that is not deleted = %v, want %s", err, errs.InvalidState)
+	}
+	if err := contract.DeleteInsurance(ctx, "INS123456", "test data"); err != nil {
+		t.Fatal(err)
+	}
+
+	var denied *errs.PermissionError
+	ctx.Client = chaincodetest.Insurer
+	if err := contract.PurgeInsurance(ctx, "INS123456"); !errors.As(err, &denied) {
+		t.Errorf("PurgeInsurance by an insurer without the admin role = %v, want a PermissionError", err)
+	}
+
+	ctx.Client = chaincodetest.InsurerAdmin
+	if err := contract.PurgeInsurance(ctx, "INS123456"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := contract.InsuranceExists(ctx, "INS123456"); exists {
+		t.Error("INS123456 still exists")
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventInsurancePurged {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestGetAllInsurances(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := chaincodetest.NewContext(access.InsuranceMSP)
+	if err := contract.InitLedger(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx = createPolicy(t, ctx, "INS999999", sampleArgs())
+
+	insurances, err := contract.GetAllInsurances(ctx)
+	if err != nil || len(insurances) != 3 {
+		t.Fatalf("GetAllInsurances = %d policies, %v; want 3", len(insurances), err)
+	}
+	for _, insurance := range insurances {
+		var v validation.Validator
+		validateInsurance(&v, insurance, insurance.Age, chaincodetest.Epoch)
+		if err := v.Err(); err != nil {
+			t.Errorf("policy %s is invalid: %v", insurance.InsuranceNumber, err)
+		}
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.TPAMSP)
+	page, err := contract.GetAllInsurancesWithPagination(ctx, 2, "")
+	if err != nil || page.FetchedRecordsCount != 2 || page.Records[0].AadharNumber != "XXXX-XXXX-0124" {
+		t.Fatalf("first page = %+v, %v", page, err)
+	}
+	page, err = contract.GetAllInsurancesWithPagination(ctx, 2, page.Bookmark)
+	if err != nil || page.FetchedRecordsCount != 1 || page.Records[0].InsuranceNumber != "INS999999" || page.Bookmark != "" {
+		t.Fatalf("second page = %+v, %v", page, err)
+	}
+	if _, err := contract.GetAllInsurancesWithPagination(ctx, 0, ""); err == nil {
+		t.Error("GetAllInsurancesWithPagination with page size 0 succeeded")
+	}
+
+	var denied *errs.PermissionError
+	if err := contract.InitLedger(ctx); !errors.As(err, &denied) {
+		t.Errorf("InitLedger by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestGetInsuranceHistory(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := createPolicy(t, chaincodetest.NewContext(access.InsuranceMSP), "INS123456", sampleArgs())
+	ctx = ctx.Next(chaincodetest.Adjudicator)
+	ctx.Stub.Invoked = invoke.ClaimChaincode
+	if err := contract.DebitClaimLimit(ctx, "INS123456", "1000"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.HealthcareMSP)
+	history, err := contract.GetInsuranceHistory(ctx, "INS123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Record.AlreadyClaimed != chaincodetest.INR(2600000) || history[1].Record.AlreadyClaimed != chaincodetest.INR(2500000) {
+		t.Fatalf("history = %+v", history)
+	}
+	for _, entry := range history {
+		if entry.Record.AadharNumber != "XXXX-XXXX-0124" {
+			t.Errorf("history entry %s shows Aadhaar number %s to a hospital", entry.TxID, entry.Record.AadharNumber)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	contract := new(InsuranceContract)
+	ctx := chaincodetest.NewContext(access.InsuranceMSP)
+
+	// A policy as stored before composite keys and Money
+	legacy := `{"name":"John Doe","aadharNumber":"234567890124","startDate":"2023-01-01","endDate":"2024-01-01",` +
+		`"age":35,"insuranceNumber":"INS123456","claimLimit":100000,"alreadyClaimed":25000.5}`
+	if err := ctx.Stub.PutState("INS123456", []byte(legacy)); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := contract.MigrateKeys(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateKeys = %d, %v; want 1", migrated, err)
+	}
+	migrated, err = contract.MigrateMoney(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateMoney = %d, %v; want 1", migrated, err)
+	}
+	migrated, err = contract.MigrateMoney(ctx)
+	if err != nil || migrated != 0 {
+		t.Errorf("second MigrateMoney = %d, %v; want 0", migrated, err)
+	}
+	insurance, err := contract.ReadInsurance(ctx, "INS123456")
+	if err != nil || insurance.ClaimLimit != chaincodetest.INR(10000000) || insurance.AlreadyClaimed != chaincodetest.INR(2500050) || insurance.Age != 35 {
+		t.Errorf("ReadInsurance after migration = %+v, %v", insurance, err)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.HealthcareMSP)
+	var denied *errs.PermissionError
+	if _, err := contract.MigrateKeys(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigrateKeys by a hospital = %v, want a PermissionError", err)
+	}
+	if _, err := contract.MigrateMoney(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigrateMoney by a hospital = %v, want a PermissionError", err)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"common/access"
+	"common/ledger"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// insuranceRepository stores insurance policies under composite keys of object type "insurance~id"
+var insuranceRepository = ledger.Repository[Insurance]{ObjectType: "insurance~id", Kind: "insurance", IDName: "number"}
+
+// MigrateKeys moves insurance records stored under bare keys such as INS123456 to their
+// composite keys, returning how many records were moved
+func (s *InsuranceContract) MigrateKeys(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigrateKeys", access.InsuranceMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	return insuranceRepository.MigrateKeys(ctx)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"common/aadhaar"
+	"common/access"
+	"common/invoke"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// aadharOwnerMSPs are the organizations that see the Aadhaar numbers on policies in full.
+// Everyone else gets them masked as XXXX-XXXX-1234.
+var aadharOwnerMSPs = []string{access.InsuranceMSP}
+
+// maskInsurances masks the Aadhaar numbers of the given policies in place unless the
+// submitting client belongs to one of aadharOwnerMSPs
+func maskInsurances(ctx contractapi.TransactionContextInterface, insurances ...*Insurance) error {
+	owner, err := access.ClientInMSP(ctx, aadharOwnerMSPs...)
+	if err != nil || owner {
+		return err
+	}
+
+	for _, insurance := range insurances {
+		insurance.AadharNumber = aadhaar.Mask(insurance.AadharNumber)
+	}
+	return nil
+}
+
+// VerifyInsuranceAadhar reports whether aadharNumber is the one on the given policy, for
+// insuranceclaimcc to match the policy on a claim to its claimant. Only that chaincode may
+// call it: hospitals and TPAs see masked numbers and could otherwise recover them by
+// guessing.
+func (s *InsuranceContract) VerifyInsuranceAadhar(ctx contractapi.TransactionContextInterface, insuranceNumber string, aadharNumber string) (bool, error) {
+	err := access.Authorize(ctx, "VerifyInsuranceAadhar", access.HealthcareMSP, access.TPAMSP, access.InsuranceMSP)
+	if err != nil {
+		return false, err
+	}
+	err = invoke.AuthorizeCaller(ctx, "VerifyInsuranceAadhar", invoke.ClaimChaincode)
+	if err != nil {
+		return false, err
+	}
+
+	insurance, err := insuranceRepository.Read(ctx, insuranceNumber)
+	if err != nil {
+		return false, err
+	}
+
+	return insurance.AadharNumber == aadharNumber, nil
+}
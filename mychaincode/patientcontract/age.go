@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"common/errs"
+	"common/ledger"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// deriveAges sets the ages of the given patients from their dates of birth as of the
+// transaction timestamp. Ages are never stored, so they cannot go stale; records written
+// before that keep their stored age if their date of birth does not parse.
+func deriveAges(ctx contractapi.TransactionContextInterface, patients ...*Patient) error {
+	today, err := ledger.TxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, patient := range patients {
+		dob, err := time.Parse(validation.DateLayout, patient.DOB)
+		if err != nil {
+			continue
+		}
+		patient.Age = validation.AgeOn(dob, today)
+	}
+	return nil
+}
+
+// readPatientDetails reads a patient's details, unmasked and with the stored age, from
+// the private collection
+func readPatientDetails(ctx contractapi.TransactionContextInterface, patientID string) (*Patient, error) {
+	key, err := patientRepository.Key(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+	patientJSON, err := ctx.GetStub().GetPrivateData(patientCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from private collection: %v", err)
+	}
+	if patientJSON == nil {
+		return nil, patientRepository.NotFound(patientID)
+	}
+
+	var patient Patient
+	err = json.Unmarshal(patientJSON, &patient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &patient, nil
+}
+
+// GetPatientAgeAt returns how old a patient was, in completed years, on the given date,
+// e.g. the admission date of a claim. Only members of the private collection can call it.
+func (s *PatientContract) GetPatientAgeAt(ctx contractapi.TransactionContextInterface, patientID string, date string) (int, error) {
+	// Soft deleted patients keep their details, but are not to be claimed for
+	_, err := patientRepository.Read(ctx, patientID)
+	if err != nil {
+		return 0, err
+	}
+	patient, err := readPatientDetails(ctx, patientID)
+	if err != nil {
+		return 0, err
+	}
+
+	var v validation.Validator
+	on, ok := v.Date("date", date)
+	if !ok {
+		return 0, v.Err()
+	}
+	dob, err := time.Parse(validation.DateLayout, patient.DOB)
+	if err != nil {
+		return 0, errs.New(errs.InvalidState, "the patient with ID %s has no valid date of birth", patientID).With("id", patientID)
+	}
+	if on.Before(dob) {
+		v.Fail("date", "must not be before the patient's date of birth")
+		return 0, v.Err()
+	}
+
+	return validation.AgeOn(dob, on), nil
+}
@@ -0,0 +1,11 @@
+package main
+
+// Chaincode event names. Every mutating transaction emits exactly one of them, with an
+// events.RecordEvent as payload. InitLedger and the migrations emit none.
+const (
+	EventPatientCreated  = "PatientCreated"
+	EventPatientUpdated  = "PatientUpdated"
+	EventPatientDeleted  = "PatientDeleted"
+	EventPatientRestored = "PatientRestored"
+	EventPatientPurged   = "PatientPurged"
+)
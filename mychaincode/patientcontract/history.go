@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PatientHistoryEntry is one committed version of a patient's public record
+type PatientHistoryEntry struct {
+	TxID      string         `json:"txID"`
+	Timestamp string         `json:"timestamp"` // RFC 3339, UTC
+	IsDelete  bool           `json:"isDelete"`
+	Record    *PatientRecord `json:"record,omitempty" metadata:",optional"` // nil when the version is a deletion
+}
+
+// GetPatientHistory returns every committed version of a patient's public record
+func (s *PatientContract) GetPatientHistory(ctx contractapi.TransactionContextInterface, patientID string) ([]*PatientHistoryEntry, error) {
+	versions, err := patientRepository.History(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []*PatientHistoryEntry
+	for _, version := range versions {
+		history = append(history, &PatientHistoryEntry{
+			TxID:      version.TxID,
+			Timestamp: version.Timestamp,
+			IsDelete:  version.IsDelete,
+			Record:    version.Record,
+		})
+	}
+
+	return history, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"common/access"
+	"common/ledger"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// patientRepository stores the public PatientRecords of patients under composite keys of
+// object type "patient~id". Their details live in patientCollection.
+var patientRepository = ledger.Repository[PatientRecord]{ObjectType: "patient~id", Kind: "patient", IDName: "ID"}
+
+// MigrateKeys moves patient records stored under bare keys such as PATIENT1 to their
+// composite keys, returning how many records were moved
+func (s *PatientContract) MigrateKeys(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigrateKeys", access.HealthcareMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	return patientRepository.MigrateKeys(ctx)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"common/aadhaar"
+	"common/access"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// aadharOwnerMSPs are the organizations that see patients' Aadhaar numbers in full.
+// Everyone else gets them masked as XXXX-XXXX-1234.
+var aadharOwnerMSPs = []string{access.HealthcareMSP}
+
+// maskPatients masks the Aadhaar numbers of the given patients in place unless the
+// submitting client belongs to one of aadharOwnerMSPs
+func maskPatients(ctx contractapi.TransactionContextInterface, patients ...*Patient) error {
+	owner, err := access.ClientInMSP(ctx, aadharOwnerMSPs...)
+	if err != nil || owner {
+		return err
+	}
+
+	for _, patient := range patients {
+		patient.AadharNumber = aadhaar.Mask(patient.AadharNumber)
+	}
+	return nil
+}
@@ -1,27 +1,59 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"time"
 
+	"common/access"
+	"common/errs"
+	"common/events"
+	"common/invoke"
+	"common/ledger"
+	"common/patch"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
 // Patient represents the structure of a patient record
 type Patient struct {
-	Name           string `json:"name"`
-	Age            int    `json:"age"`
-	Gender         string `json:"gender"`
-	BloodType      string `json:"bloodType"`
-	Height         int    `json:"height"`
-	Weight         int    `json:"weight"`
-	Address        string `json:"address"`
-	DOB            string `json:"dob"`
-	AadharNumber   string `json:"aadharNumber"`
+	Name            string `json:"name"`
+	Age             int    `json:"age,omitempty" metadata:",optional"` // derived from DOB, see deriveAges
+	Gender          string `json:"gender"`
+	BloodType       string `json:"bloodType"`
+	Height          int    `json:"height"`
+	Weight          int    `json:"weight"`
+	Address         string `json:"address"`
+	DOB             string `json:"dob"`
+	AadharNumber    string `json:"aadharNumber"`
 	InsuranceNumber string `json:"insuranceNumber"`
-	PhoneNumber    string `json:"phoneNumber"`
-	EmailID        string `json:"emailID"`
-	SmokerStatus   string   `json:"smokerStatus"`
+	PhoneNumber     string `json:"phoneNumber"`
+	EmailID         string `json:"emailID"`
+	SmokerStatus    string `json:"smokerStatus"`
+
+	ledger.Metadata // of the patient's PatientRecord, never stored with the details
+}
+
+// validatePatient checks the details of a patient, reporting every invalid field. A
+// submitted age must match the one derived from the date of birth as of today.
+func validatePatient(patient *Patient, today time.Time) error {
+	var v validation.Validator
+	v.Required("name", patient.Name)
+	if age, ok := v.DateOfBirth("dob", patient.DOB, today); ok {
+		v.Age("age", patient.Age, age)
+	}
+	v.OneOf("gender", patient.Gender, "Male", "Female", "Other")
+	v.OneOf("bloodType", patient.BloodType, "A+", "A-", "B+", "B-", "AB+", "AB-", "O+", "O-")
+	v.Between("height", patient.Height, 0, 300)
+	v.Between("weight", patient.Weight, 0, 700)
+	v.Required("address", patient.Address)
+	v.Aadhaar("aadharNumber", patient.AadharNumber)
+	v.Required("insuranceNumber", patient.InsuranceNumber)
+	v.Digits("phoneNumber", patient.PhoneNumber, 10)
+	v.Email("emailID", patient.EmailID)
+	v.OneOf("smokerStatus", patient.SmokerStatus, "0", "1")
+	return v.Err()
 }
 
 // PatientContract provides functions for managing patients
@@ -31,46 +63,45 @@ type PatientContract struct {
 
 // InitLedger initializes the ledger with some sample data (optional)
 func (s *PatientContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	err := access.Authorize(ctx, "InitLedger", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
 	patients := []Patient{
 		{
-			Name:           "John Doe",
-			Age:            30,
-			Gender:         "Male",
-			BloodType:      "O+",
-			Height:         180,
-			Weight:         75,
-			Address:        "123 Main St",
-			DOB:            "1990-01-01",
-			AadharNumber:   "123456789012",
+			Name:            "John Doe",
+			Gender:          "Male",
+			BloodType:       "O+",
+			Height:          180,
+			Weight:          75,
+			Address:         "123 Main St",
+			DOB:             "1990-01-01",
+			AadharNumber:    "234567890124",
 			InsuranceNumber: "INS123456",
-			PhoneNumber:    "1234567890",
-			EmailID:        "john.doe@example.com",
-			SmokerStatus:	"1",
+			PhoneNumber:     "1234567890",
+			EmailID:         "john.doe@example.com",
+			SmokerStatus:    "1",
 		},
 		{
-			Name:           "Jane Doe",
-			Age:            25,
-			Gender:         "Female",
-			BloodType:      "A+",
-			Height:         165,
-			Weight:         60,
-			Address:        "456 Elm St",
-			DOB:            "1995-05-05",
-			AadharNumber:   "987654321098",
+			Name:            "Jane Doe",
+			Gender:          "Female",
+			BloodType:       "A+",
+			Height:          165,
+			Weight:          60,
+			Address:         "456 Elm St",
+			DOB:             "1995-05-05",
+			AadharNumber:    "987654321096",
 			InsuranceNumber: "INS654321",
-			PhoneNumber:    "0987654321",
-			EmailID:        "jane.doe@example.com",
-			SmokerStatus:	"0",
+			PhoneNumber:     "0987654321",
+			EmailID:         "jane.doe@example.com",
+			SmokerStatus:    "0",
 		},
 	}
 
 	for i, patient := range patients {
 		patientID := fmt.Sprintf("PATIENT%d", i+1)
-		patientJSON, err := json.Marshal(patient)
-		if err != nil {
-			return err
-		}
-		err = ctx.GetStub().PutState(patientID, patientJSON)
+		err = putPatient(ctx, patientID, &patient)
 		if err != nil {
 			return fmt.Errorf("failed to put to world state: %v", err)
 		}
@@ -79,172 +110,305 @@ func (s *PatientContract) InitLedger(ctx contractapi.TransactionContextInterface
 	return nil
 }
 
-// CreatePatient adds a new patient to the ledger
-func (s *PatientContract) CreatePatient(
-	ctx contractapi.TransactionContextInterface,
-	patientID string,
-	name string,
-	age int,
-	gender string,
-	bloodType string,
-	height int,
-	weight int,
-	address string,
-	dob string,
-	aadharNumber string,
-	insuranceNumber string,
-	phoneNumber string,
-	emailID string,
-	smokerStatus string,
-) error {
-	exists, err := s.PatientExists(ctx, patientID)
+// CreatePatient adds a new patient to the ledger. The patient's details are passed as
+// JSON in the transient map under "patient" and stored in the private collection; the
+// world state only gets the patient's PatientRecord.
+func (s *PatientContract) CreatePatient(ctx contractapi.TransactionContextInterface, patientID string) error {
+	err := access.Authorize(ctx, "CreatePatient", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	exists, err := patientRepository.Exists(ctx, patientID)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("patient with ID %s already exists", patientID)
+		return patientRepository.AlreadyExists(patientID)
 	}
 
-	patient := Patient{
-		Name:           name,
-		Age:            age,
-		Gender:         gender,
-		BloodType:      bloodType,
-		Height:         height,
-		Weight:         weight,
-		Address:        address,
-		DOB:            dob,
-		AadharNumber:   aadharNumber,
-		InsuranceNumber: insuranceNumber,
-		PhoneNumber:    phoneNumber,
-		EmailID:        emailID,
-		SmokerStatus: 	smokerStatus,
+	patient, err := readTransientPatient(ctx)
+	if err != nil {
+		return err
+	}
+	today, err := ledger.TxTime(ctx)
+	if err != nil {
+		return err
+	}
+	err = validatePatient(patient, today)
+	if err != nil {
+		return err
 	}
 
-	patientJSON, err := json.Marshal(patient)
+	err = putPatient(ctx, patientID, patient)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(patientID, patientJSON)
+	return events.Emit(ctx, EventPatientCreated, patientID, "", "")
 }
 
-// ReadPatient retrieves a patient from the ledger using patientID
+// ReadPatient retrieves a patient's details from the private collection. Only members
+// of the collection can read them; others should use ReadPatientRecord. The age is as of
+// the transaction timestamp, the version is that of the patient's PatientRecord, and the
+// Aadhaar number is masked for clients outside the hospitals.
 func (s *PatientContract) ReadPatient(ctx contractapi.TransactionContextInterface, patientID string) (*Patient, error) {
-	patientJSON, err := ctx.GetStub().GetState(patientID)
+	record, err := patientRepository.Read(ctx, patientID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, err
 	}
-	if patientJSON == nil {
-		return nil, fmt.Errorf("patient with ID %s does not exist", patientID)
+	patient, err := readPatientDetails(ctx, patientID)
+	if err != nil {
+		return nil, err
 	}
+	patient.Metadata = record.Metadata
 
-	var patient Patient
-	err = json.Unmarshal(patientJSON, &patient)
+	err = deriveAges(ctx, patient)
 	if err != nil {
 		return nil, err
 	}
+	err = maskPatients(ctx, patient)
+	if err != nil {
+		return nil, err
+	}
+
+	return patient, nil
+}
 
-	return &patient, nil
+// ReadPatientRecord retrieves the public record of a patient from the world state
+func (s *PatientContract) ReadPatientRecord(ctx contractapi.TransactionContextInterface, patientID string) (*PatientRecord, error) {
+	return patientRepository.Read(ctx, patientID)
 }
 
-// UpdatePatient updates an existing patient in the ledger
-func (s *PatientContract) UpdatePatient(
-	ctx contractapi.TransactionContextInterface,
-	patientID string,
-	name string,
-	age int,
-	gender string,
-	bloodType string,
-	height int,
-	weight int,
-	address string,
-	dob string,
-	aadharNumber string,
-	insuranceNumber string,
-	phoneNumber string,
-	emailID string,
-	smokerStatus string,
-) error {
-	exists, err := s.PatientExists(ctx, patientID)
+// UpdatePatient replaces an existing patient's details with those passed in the
+// transient map under "patient". It fails with CONFLICT unless expectedVersion is 0 or
+// the patient's current version.
+func (s *PatientContract) UpdatePatient(ctx contractapi.TransactionContextInterface, patientID string, expectedVersion int) error {
+	err := access.Authorize(ctx, "UpdatePatient", access.HealthcareMSP)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("patient with ID %s does not exist", patientID)
+
+	record, err := patientRepository.Read(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	err = patientRepository.CheckVersion(patientID, record, expectedVersion)
+	if err != nil {
+		return err
 	}
 
-	patient := Patient{
-		Name:           name,
-		Age:            age,
-		Gender:         gender,
-		BloodType:      bloodType,
-		Height:         height,
-		Weight:         weight,
-		Address:        address,
-		DOB:            dob,
-		AadharNumber:   aadharNumber,
-		InsuranceNumber: insuranceNumber,
-		PhoneNumber:    phoneNumber,
-		EmailID:        emailID,
-		SmokerStatus: 	smokerStatus,
+	patient, err := readTransientPatient(ctx)
+	if err != nil {
+		return err
+	}
+	today, err := ledger.TxTime(ctx)
+	if err != nil {
+		return err
+	}
+	err = validatePatient(patient, today)
+	if err != nil {
+		return err
 	}
 
-	patientJSON, err := json.Marshal(patient)
+	err = putPatient(ctx, patientID, patient)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(patientID, patientJSON)
+	return events.Emit(ctx, EventPatientUpdated, patientID, "", "")
 }
 
-// DeletePatient deletes a patient from the ledger
-func (s *PatientContract) DeletePatient(ctx contractapi.TransactionContextInterface, patientID string) error {
-	exists, err := s.PatientExists(ctx, patientID)
+// PatchPatient changes only the details named in the JSON object passed in the transient
+// map under "patient", e.g. {"phoneNumber": "9876543210"}, keeping the others as stored.
+// Like UpdatePatient, it checks expectedVersion unless it is 0.
+func (s *PatientContract) PatchPatient(ctx contractapi.TransactionContextInterface, patientID string, expectedVersion int) error {
+	err := access.Authorize(ctx, "PatchPatient", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	record, err := patientRepository.Read(ctx, patientID)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("patient with ID %s does not exist", patientID)
+	err = patientRepository.CheckVersion(patientID, record, expectedVersion)
+	if err != nil {
+		return err
+	}
+	patient, err := readPatientDetails(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	patchJSON, err := readTransientJSON(ctx)
+	if err != nil {
+		return err
+	}
+	// A patched age is checked against the date of birth like a submitted one
+	patient.Age = 0
+	err = patch.Apply(patient, patchJSON, ledger.MetadataFields...)
+	if err != nil {
+		return err
+	}
+	today, err := ledger.TxTime(ctx)
+	if err != nil {
+		return err
+	}
+	err = validatePatient(patient, today)
+	if err != nil {
+		return err
+	}
+
+	err = putPatient(ctx, patientID, patient)
+	if err != nil {
+		return err
 	}
 
-	return ctx.GetStub().DelState(patientID)
+	return events.Emit(ctx, EventPatientUpdated, patientID, "", "")
 }
 
-// PatientExists checks if a patient exists in the ledger
-func (s *PatientContract) PatientExists(ctx contractapi.TransactionContextInterface, patientID string) (bool, error) {
-	patientJSON, err := ctx.GetStub().GetState(patientID)
+// DeletePatient soft deletes a patient for the given reason. The patient's record and
+// details are kept, the record marked deleted, but no longer read or listed until
+// RestorePatient. A patient with open claims cannot be deleted, nor can one with
+// treatments unless cascade is set, which archives the treatments along with the patient
+// by soft deleting them too. Claims are the insurer's and never archived this way.
+func (s *PatientContract) DeletePatient(ctx contractapi.TransactionContextInterface, patientID string, reason string, cascade bool) error {
+	err := access.Authorize(ctx, "DeletePatient", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	_, err = patientRepository.Read(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	claimIDs, err := invoke.OpenClaimIDs(ctx, "QueryClaimsByPatient", patientID)
+	if err != nil {
+		return err
+	}
+	if len(claimIDs) > 0 {
+		return patientRepository.InUse(patientID, "open claims", claimIDs)
+	}
+	treatmentIDs, err := queryTreatmentIDs(ctx, patientID)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return err
+	}
+	if len(treatmentIDs) > 0 && !cascade {
+		return patientRepository.InUse(patientID, "treatments", treatmentIDs)
+	}
+
+	_, err = patientRepository.SoftDelete(ctx, patientID, reason)
+	if err != nil {
+		return err
+	}
+	for _, treatmentID := range treatmentIDs {
+		err = invoke.Chaincode(ctx, invoke.TreatmentChaincode, nil, "DeleteTreatment", treatmentID, reason)
+		if err != nil {
+			return err
+		}
 	}
 
-	return patientJSON != nil, nil
+	return events.Emit(ctx, EventPatientDeleted, patientID, "", "")
 }
 
-// GetAllPatients returns all patients in the ledger
-func (s *PatientContract) GetAllPatients(ctx contractapi.TransactionContextInterface) ([]*Patient, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+// queryTreatmentIDs returns the IDs of the patient's treatments that are not deleted
+func queryTreatmentIDs(ctx contractapi.TransactionContextInterface, patientID string) ([]string, error) {
+	var treatmentIDs []string
+	err := invoke.Chaincode(ctx, invoke.TreatmentChaincode, &treatmentIDs, "QueryTreatmentIDsByPatient", patientID)
 	if err != nil {
 		return nil, err
 	}
-	defer resultsIterator.Close()
+	return treatmentIDs, nil
+}
 
-	var patients []*Patient
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+// RestorePatient undoes the soft deletion of a patient
+func (s *PatientContract) RestorePatient(ctx contractapi.TransactionContextInterface, patientID string) error {
+	err := access.Authorize(ctx, "RestorePatient", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
 
-		var patient Patient
-		err = json.Unmarshal(queryResponse.Value, &patient)
-		if err != nil {
-			return nil, err
-		}
-		patients = append(patients, &patient)
+	_, err = patientRepository.Restore(ctx, patientID)
+	if err != nil {
+		return err
 	}
 
-	return patients, nil
+	return events.Emit(ctx, EventPatientRestored, patientID, "", "")
+}
+
+// PurgePatient removes a soft deleted patient's record from the world state and details
+// from the private collection for good, unless claims or treatments still refer to the
+// patient. Only the hospitals' admins may call it.
+func (s *PatientContract) PurgePatient(ctx contractapi.TransactionContextInterface, patientID string) error {
+	err := access.RequireRole(ctx, "PurgePatient", access.AdminRole, access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	// Closed claims, and treatments restored since the patient was deleted, still refer to it
+	claimIDs, err := invoke.ClaimIDs(ctx, "QueryClaimsByPatient", patientID)
+	if err != nil {
+		return err
+	}
+	if len(claimIDs) > 0 {
+		return patientRepository.InUse(patientID, "claims", claimIDs)
+	}
+	treatmentIDs, err := queryTreatmentIDs(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	if len(treatmentIDs) > 0 {
+		return patientRepository.InUse(patientID, "treatments", treatmentIDs)
+	}
+	err = patientRepository.Purge(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	key, err := patientRepository.Key(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelPrivateData(patientCollection, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete private patient details: %v", err)
+	}
+
+	return events.Emit(ctx, EventPatientPurged, patientID, "", "")
+}
+
+// PatientExists checks if a patient exists in the ledger, including soft deleted ones,
+// whose IDs cannot be reused
+func (s *PatientContract) PatientExists(ctx contractapi.TransactionContextInterface, patientID string) (bool, error) {
+	return patientRepository.Exists(ctx, patientID)
+}
+
+// GetAllPatients returns the public records of all patients in the ledger except the
+// soft deleted ones
+func (s *PatientContract) GetAllPatients(ctx contractapi.TransactionContextInterface) ([]*PatientRecord, error) {
+	return patientRepository.All(ctx)
+}
+
+// GetDeletedPatients returns the public records of the soft deleted patients
+func (s *PatientContract) GetDeletedPatients(ctx contractapi.TransactionContextInterface) ([]*PatientRecord, error) {
+	return patientRepository.Deleted(ctx)
+}
+
+// PatientPage is one page of public patient records along with the bookmark for the next page
+type PatientPage struct {
+	Records             []*PatientRecord `json:"records"`
+	FetchedRecordsCount int32            `json:"fetchedRecordsCount"`
+	Bookmark            string           `json:"bookmark"`
+}
+
+// GetAllPatientsWithPagination returns up to pageSize patients starting at bookmark.
+// Pass an empty bookmark for the first page and the returned bookmark for the next.
+func (s *PatientContract) GetAllPatientsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PatientPage, error) {
+	page, err := patientRepository.Page(ctx, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PatientPage{Records: page.Records, FetchedRecordsCount: page.FetchedRecordsCount, Bookmark: page.Bookmark}, nil
 }
 
 func main() {
@@ -254,7 +418,8 @@ func main() {
 		return
 	}
 
-	if err := chaincode.Start(); err != nil {
+	// Wrapped, every error reaches clients as an errs.Error they can branch on by code
+	if err := shim.Start(errs.WithCodes(chaincode)); err != nil {
 		fmt.Printf("Error starting patient chaincode: %v\n", err)
 	}
-}
\ No newline at end of file
+}
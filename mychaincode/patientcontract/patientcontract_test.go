@@ -0,0 +1,733 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"common/access"
+	"common/chaincodetest"
+	"common/errs"
+	"common/invoke"
+	"common/ledger"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// samplePatient returns valid details of a patient, aged as of chaincodetest.Epoch
+func samplePatient() Patient {
+	return Patient{
+		Name:            "John Doe",
+		Age:             34,
+		Gender:          "Male",
+		BloodType:       "O+",
+		Height:          180,
+		Weight:          75,
+		Address:         "123 Main St",
+		DOB:             "1990-01-01",
+		AadharNumber:    "234567890124",
+		InsuranceNumber: "INS123456",
+		PhoneNumber:     "1234567890",
+		EmailID:         "john.doe@example.com",
+		SmokerStatus:    "1",
+	}
+}
+
+// withoutMetadata returns a patient's details alone, e.g. for comparison with samplePatient
+func withoutMetadata(patient *Patient) Patient {
+	details := *patient
+	details.Metadata = ledger.Metadata{}
+	return details
+}
+
+// setTransientPatient passes patient in the transient map of the current transaction
+func setTransientPatient(t *testing.T, ctx *chaincodetest.Context, patient Patient) {
+	t.Helper()
+	patientJSON, err := json.Marshal(patient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Stub.TransientMap = map[string][]byte{transientPatientKey: patientJSON}
+}
+
+// createPatient creates a patient in a transaction of its own submitted by the hospital
+func createPatient(t *testing.T, ctx *chaincodetest.Context, patientID string, patient Patient) *chaincodetest.Context {
+	t.Helper()
+	ctx = ctx.Next(chaincodetest.Hospital)
+	setTransientPatient(t, ctx, patient)
+	err := new(PatientContract).CreatePatient(ctx, patientID)
+	if err != nil {
+		t.Fatalf("CreatePatient(%s) = %v", patientID, err)
+	}
+	return ctx
+}
+
+// dependents stands in for the claim and treatment chaincodes, answering their queries
+// for a patient with the given claims, by claim ID and status, and treatments
+type dependents struct {
+	claims     map[string]string
+	treatments []string
+	deleted    []string // the treatments deleted through the treatment chaincode
+}
+
+func (d *dependents) install(ctx *chaincodetest.Context) {
+	chaincodetest.WithClaims(ctx, d.claims)
+	ctx.Stub.Chaincodes[invoke.TreatmentChaincode] = func(function string, args []string) peer.Response {
+		if function == "DeleteTreatment" {
+			d.deleted = append(d.deleted, args[0])
+			return shim.Success(nil)
+		}
+		return chaincodetest.Success(d.treatments)
+	}
+}
+
+func TestCreatePatient(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+
+	record, err := contract.ReadPatientRecord(ctx, "PATIENT1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.PatientID != "PATIENT1" || record.InsuranceNumber != "INS123456" || record.Version != 1 {
+		t.Errorf("record = %+v", record)
+	}
+
+	patient, err := contract.ReadPatient(ctx, "PATIENT1")
+	if err != nil || withoutMetadata(patient) != samplePatient() {
+		t.Fatalf("ReadPatient = %+v, %v", patient, err)
+	}
+	if patient.Version != 1 || patient.LastModifiedTxID != ctx.Stub.TxID || patient.LastModifiedByMSP != access.HealthcareMSP {
+		t.Errorf("metadata = %+v, want version 1 by the hospital", patient.Metadata)
+	}
+
+	event := chaincodetest.LastEvent(t, ctx)
+	if event.EventType != EventPatientCreated || event.RecordID != "PATIENT1" || event.TxID != ctx.Stub.TxID {
+		t.Errorf("event = %+v", event)
+	}
+
+	exists, err := contract.PatientExists(ctx, "PATIENT1")
+	if err != nil || !exists {
+		t.Errorf("PatientExists = %v, %v", exists, err)
+	}
+}
+
+// TestCreatePatientByMSPID uses the MSP IDs of configtx.yaml rather than the access constants
+func TestCreatePatientByMSPID(t *testing.T) {
+	ctx := chaincodetest.NewContext("HealthcareMSP")
+	setTransientPatient(t, ctx, samplePatient())
+	if err := new(PatientContract).CreatePatient(ctx, "PATIENT1"); err != nil {
+		t.Errorf("CreatePatient by HealthcareMSP = %v", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.NewClient("InsuranceMSP"))
+	setTransientPatient(t, ctx, samplePatient())
+	var denied *errs.PermissionError
+	if err := new(PatientContract).CreatePatient(ctx, "PATIENT2"); !errors.As(err, &denied) {
+		t.Errorf("CreatePatient by InsuranceMSP = %v, want a PermissionError", err)
+	}
+}
+
+func TestCreatePatientKeepsDetailsOffTheWorldState(t *testing.T) {
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+
+	for key, value := range ctx.Stub.State {
+		for _, secret := range []string{"John Doe", "234567890124", "1234567890", "john.doe@example.com"} {
+			if strings.Contains(string(value), secret) {
+				t.Errorf("world state key %q holds %s", key, secret)
+			}
+		}
+	}
+}
+
+func TestCreatePatientErrors(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	setTransientPatient(t, ctx, samplePatient())
+	var exists *errs.AlreadyExistsError
+	if err := contract.CreatePatient(ctx, "PATIENT1"); !errors.As(err, &exists) {
+		t.Errorf("CreatePatient of an existing ID = %v, want an AlreadyExistsError", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.CreatePatient(ctx, "PATIENT2"); err == nil || !strings.Contains(err.Error(), "transient map") {
+		t.Errorf("CreatePatient without transient data = %v", err)
+	}
+
+	ctx.Stub.TransientMap = map[string][]byte{transientPatientKey: []byte("{")}
+	if err := contract.CreatePatient(ctx, "PATIENT2"); err == nil || !strings.Contains(err.Error(), "decode") {
+		t.Errorf("CreatePatient with malformed transient data = %v", err)
+	}
+
+	invalid := samplePatient()
+	invalid.Age = 30
+	invalid.BloodType = "C+"
+	invalid.AadharNumber = "234567890123"
+	invalid.PhoneNumber = "12345"
+	invalid.EmailID = "john"
+	setTransientPatient(t, ctx, invalid)
+	var fieldErrors validation.Errors
+	if err := contract.CreatePatient(ctx, "PATIENT2"); !errors.As(err, &fieldErrors) || len(fieldErrors) != 5 {
+		t.Errorf("CreatePatient with invalid details = %v, want 5 field errors", err)
+	}
+
+	invalid = samplePatient()
+	invalid.DOB = "01/01/1990"
+	setTransientPatient(t, ctx, invalid)
+	if err := contract.CreatePatient(ctx, "PATIENT2"); !errors.As(err, &fieldErrors) || fieldErrors[0].Field != "dob" {
+		t.Errorf("CreatePatient with a malformed date of birth = %v, want a dob error", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.NewClient(access.InsuranceMSP))
+	setTransientPatient(t, ctx, samplePatient())
+	var denied *errs.PermissionError
+	if err := contract.CreatePatient(ctx, "PATIENT2"); !errors.As(err, &denied) {
+		t.Errorf("CreatePatient by the insurer = %v, want a PermissionError", err)
+	}
+
+	if exists, _ := contract.PatientExists(ctx, "PATIENT2"); exists {
+		t.Error("a failed CreatePatient wrote PATIENT2")
+	}
+}
+
+func TestReadPatient(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+
+	insurerCtx := ctx.Next(chaincodetest.NewClient(access.InsuranceMSP))
+	patient, err := contract.ReadPatient(insurerCtx, "PATIENT1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patient.AadharNumber != "XXXX-XXXX-0124" || patient.Name != "John Doe" {
+		t.Errorf("ReadPatient by the insurer = %+v, want the Aadhaar number masked", patient)
+	}
+
+	var notFound *errs.NotFoundError
+	if _, err := contract.ReadPatient(ctx, "PATIENT9"); !errors.As(err, &notFound) {
+		t.Errorf("ReadPatient of a missing patient = %v, want a NotFoundError", err)
+	}
+	if _, err := contract.ReadPatientRecord(ctx, "PATIENT9"); !errors.As(err, &notFound) {
+		t.Errorf("ReadPatientRecord of a missing patient = %v, want a NotFoundError", err)
+	}
+}
+
+func TestUpdatePatient(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+
+	updated := samplePatient()
+	updated.Address = "789 Oak St"
+	updated.InsuranceNumber = "INS999999"
+	ctx = ctx.Next(chaincodetest.Hospital)
+	setTransientPatient(t, ctx, updated)
+	if err := contract.UpdatePatient(ctx, "PATIENT1", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	patient, err := contract.ReadPatient(ctx, "PATIENT1")
+	if err != nil || withoutMetadata(patient) != updated || patient.Version != 2 {
+		t.Errorf("ReadPatient after update = %+v, %v", patient, err)
+	}
+	record, _ := contract.ReadPatientRecord(ctx, "PATIENT1")
+	if record.InsuranceNumber != "INS999999" || record.Version != 2 {
+		t.Errorf("record after update = %+v, want version 2 with the new insurance number", record)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventPatientUpdated {
+		t.Errorf("event = %+v", event)
+	}
+
+	var notFound *errs.NotFoundError
+	if err := contract.UpdatePatient(ctx, "PATIENT9", 0); !errors.As(err, &notFound) {
+		t.Errorf("UpdatePatient of a missing patient = %v, want a NotFoundError", err)
+	}
+
+	// A client still holding version 1 lost the race against the update above
+	var conflict *errs.ConflictError
+	if err := contract.UpdatePatient(ctx, "PATIENT1", 1); !errors.As(err, &conflict) || errs.From(err).Code != errs.Conflict {
+		t.Errorf("UpdatePatient of version 1 = %v, want a ConflictError", err)
+	}
+	if err := contract.UpdatePatient(ctx, "PATIENT1", 2); err != nil {
+		t.Errorf("UpdatePatient of the current version = %v", err)
+	}
+
+	invalid := samplePatient()
+	invalid.Name = ""
+	setTransientPatient(t, ctx, invalid)
+	var fieldErrors validation.Errors
+	if err := contract.UpdatePatient(ctx, "PATIENT1", 0); !errors.As(err, &fieldErrors) {
+		t.Errorf("UpdatePatient with invalid details = %v, want field errors", err)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.TPAMSP)
+	var denied *errs.PermissionError
+	if err := contract.UpdatePatient(ctx, "PATIENT1", 0); !errors.As(err, &denied) {
+		t.Errorf("UpdatePatient by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestPatchPatient(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	ctx.Stub.TransientMap = map[string][]byte{transientPatientKey: []byte(`{"phoneNumber": "9876543210"}`)}
+	if err := contract.PatchPatient(ctx, "PATIENT1", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := samplePatient()
+	want.PhoneNumber = "9876543210"
+	patient, err := contract.ReadPatient(ctx, "PATIENT1")
+	if err != nil || withoutMetadata(patient) != want || patient.Version != 2 {
+		t.Errorf("ReadPatient after patch = %+v, %v", patient, err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventPatientUpdated {
+		t.Errorf("event = %+v", event)
+	}
+
+	tests := []struct {
+		patientID string
+		patch     string
+		code      errs.Code
+	}{
+		{"PATIENT9", `{"phoneNumber": "9876543210"}`, errs.NotFound},
+		{"PATIENT1", `{"phoneNumber": "98765"}`, errs.ValidationFailed},
+		{"PATIENT1", `{"age": 40}`, errs.ValidationFailed},
+		{"PATIENT1", `{"height": "tall"}`, errs.ValidationFailed},
+		{"PATIENT1", `{"nickname": "Johnny"}`, errs.ValidationFailed},
+		{"PATIENT1", `{}`, errs.ValidationFailed},
+		{"PATIENT1", `{"version": 5}`, errs.ValidationFailed},
+	}
+	for _, tt := range tests {
+		ctx.Stub.TransientMap = map[string][]byte{transientPatientKey: []byte(tt.patch)}
+		if err := contract.PatchPatient(ctx, tt.patientID, 0); errs.From(err).Code != tt.code {
+			t.Errorf("PatchPatient(%s, %s) = %v, want %s", tt.patientID, tt.patch, err, tt.code)
+		}
+	}
+
+	ctx.Stub.TransientMap = map[string][]byte{transientPatientKey: []byte(`{"weight": 80}`)}
+	if err := contract.PatchPatient(ctx, "PATIENT1", 1); errs.From(err).Code != errs.Conflict {
+		t.Errorf("PatchPatient of version 1 = %v, want CONFLICT", err)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.TPAMSP)
+	var denied *errs.PermissionError
+	if err := contract.PatchPatient(ctx, "PATIENT1", 0); !errors.As(err, &denied) {
+		t.Errorf("PatchPatient by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestPatientAge(t *testing.T) {
+	contract := new(PatientContract)
+	withoutAge := samplePatient()
+	withoutAge.Age = 0
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", withoutAge)
+
+	key, _ := patientRepository.Key(ctx, "PATIENT1")
+	detailsJSON, _ := ctx.Stub.GetPrivateData(patientCollection, key)
+	if strings.Contains(string(detailsJSON), `"age"`) {
+		t.Errorf("private details store the age: %s", detailsJSON)
+	}
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	ctx.Stub.SetTxTime(time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC))
+	patient, err := contract.ReadPatient(ctx, "PATIENT1")
+	if err != nil || patient.Age != 35 {
+		t.Errorf("ReadPatient a year later = %+v, %v; want age 35", patient, err)
+	}
+
+	age, err := contract.GetPatientAgeAt(ctx, "PATIENT1", "2000-06-01")
+	if err != nil || age != 10 {
+		t.Errorf("GetPatientAgeAt(2000-06-01) = %d, %v; want 10", age, err)
+	}
+	var fieldErrors validation.Errors
+	for _, date := range []string{"1989-12-31", "01/06/2000"} {
+		if _, err := contract.GetPatientAgeAt(ctx, "PATIENT1", date); !errors.As(err, &fieldErrors) {
+			t.Errorf("GetPatientAgeAt(%s) = %v, want field errors", date, err)
+		}
+	}
+	var notFound *errs.NotFoundError
+	if _, err := contract.GetPatientAgeAt(ctx, "PATIENT9", "2000-06-01"); !errors.As(err, &notFound) {
+		t.Errorf("GetPatientAgeAt of a missing patient = %v, want a NotFoundError", err)
+	}
+
+	// Submitted ages are checked against the date of birth as of the transaction
+	stale := samplePatient()
+	setTransientPatient(t, ctx, stale)
+	if err := contract.UpdatePatient(ctx, "PATIENT1", 0); !errors.As(err, &fieldErrors) || fieldErrors[0].Field != "age" {
+		t.Errorf("UpdatePatient with last year's age = %v, want an age error", err)
+	}
+	unborn := samplePatient()
+	unborn.Age = 0
+	unborn.DOB = "2025-06-02"
+	setTransientPatient(t, ctx, unborn)
+	if err := contract.UpdatePatient(ctx, "PATIENT1", 0); !errors.As(err, &fieldErrors) || fieldErrors[0].Field != "dob" {
+		t.Errorf("UpdatePatient with a future date of birth = %v, want a dob error", err)
+	}
+}
+
+func TestDeletePatient(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+	(&dependents{}).install(ctx)
+
+	var denied *errs.PermissionError
+	ctx = ctx.Next(chaincodetest.NewClient(access.InsuranceMSP))
+	if err := contract.DeletePatient(ctx, "PATIENT1", "registered twice", false); !errors.As(err, &denied) {
+		t.Errorf("DeletePatient by the insurer = %v, want a PermissionError", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.DeletePatient(ctx, "PATIENT1", "", false); err == nil || errs.From(err).Code != errs.ValidationFailed {
+		t.Errorf("DeletePatient without a reason = %v, want %s", err, errs.ValidationFailed)
+	}
+	if err := contract.DeletePatient(ctx, "PATIENT1", "registered twice", false); err != nil {
+		t.Fatal(err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventPatientDeleted || event.RecordID != "PATIENT1" {
+		t.Errorf("event = %+v", event)
+	}
+
+	// The patient is hidden, but kept along with the private details
+	var notFound *errs.NotFoundError
+	if _, err := contract.ReadPatient(ctx, "PATIENT1"); !errors.As(err, &notFound) {
+		t.Errorf("ReadPatient of a deleted patient = %v, want a NotFoundError", err)
+	}
+	if _, err := contract.GetPatientAgeAt(ctx, "PATIENT1", "2024-01-01"); !errors.As(err, &notFound) {
+		t.Errorf("GetPatientAgeAt of a deleted patient = %v, want a NotFoundError", err)
+	}
+	if exists, _ := contract.PatientExists(ctx, "PATIENT1"); !exists {
+		t.Error("deleted PATIENT1 no longer exists")
+	}
+	if records, err := contract.GetAllPatients(ctx); err != nil || len(records) != 0 {
+		t.Errorf("GetAllPatients = %v, %v; want no patients", records, err)
+	}
+	deleted, err := contract.GetDeletedPatients(ctx)
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("GetDeletedPatients = %v, %v", deleted, err)
+	}
+	if d := deleted[0]; !d.Deleted || d.DeletedReason != "registered twice" || d.DeletedBy != chaincodetest.Hospital.ID {
+		t.Errorf("deleted patient = %+v", d.Metadata)
+	}
+	if details, _ := readPatientDetails(ctx, "PATIENT1"); details == nil {
+		t.Error("the private details of PATIENT1 are gone")
+	}
+
+	if err := contract.DeletePatient(ctx, "PATIENT1", "registered twice", false); !errors.As(err, &notFound) {
+		t.Errorf("DeletePatient of a deleted patient = %v, want a NotFoundError", err)
+	}
+}
+
+func TestDeletePatientWithDependents(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+	d := &dependents{claims: map[string]string{"CLAIM1": "Closed", "CLAIM2": "Submitted"}, treatments: []string{"TREATMENT1", "TREATMENT2"}}
+	d.install(ctx)
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	var inUse *errs.InUseError
+	err := contract.DeletePatient(ctx, "PATIENT1", "registered twice", true)
+	if !errors.As(err, &inUse) || inUse.Dependents != "open claims" || len(inUse.DependentIDs) != 1 || inUse.DependentIDs[0] != "CLAIM2" {
+		t.Errorf("DeletePatient with an open claim = %v, want an InUseError naming CLAIM2", err)
+	}
+
+	// Closed claims stay, treatments only go along when asked to
+	d.claims["CLAIM2"] = "Closed"
+	err = contract.DeletePatient(ctx, "PATIENT1", "registered twice", false)
+	if !errors.As(err, &inUse) || inUse.Dependents != "treatments" || len(inUse.DependentIDs) != 2 {
+		t.Errorf("DeletePatient with treatments = %v, want an InUseError naming both", err)
+	}
+	if _, err := contract.ReadPatient(ctx, "PATIENT1"); err != nil || len(d.deleted) != 0 {
+		t.Fatalf("after refused deletes, ReadPatient = %v and treatments %v are deleted", err, d.deleted)
+	}
+
+	if err := contract.DeletePatient(ctx, "PATIENT1", "registered twice", true); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.deleted) != 2 || d.deleted[0] != "TREATMENT1" || d.deleted[1] != "TREATMENT2" {
+		t.Errorf("cascade deleted treatments %v, want TREATMENT1 and TREATMENT2", d.deleted)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventPatientDeleted {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Purging has to wait until nothing refers to the patient any more
+	ctx = ctx.Next(chaincodetest.HospitalAdmin)
+	if err := contract.PurgePatient(ctx, "PATIENT1"); !errors.As(err, &inUse) || inUse.Dependents != "claims" {
+		t.Errorf("PurgePatient with closed claims = %v, want an InUseError", err)
+	}
+	chaincodetest.WithClaims(ctx, nil)
+	if err := contract.PurgePatient(ctx, "PATIENT1"); !errors.As(err, &inUse) || inUse.Dependents != "treatments" {
+		t.Errorf("PurgePatient with treatments = %v, want an InUseError", err)
+	}
+	d.treatments = nil
+	if err := contract.PurgePatient(ctx, "PATIENT1"); err != nil {
+		t.Errorf("PurgePatient without dependents = %v", err)
+	}
+}
+
+func TestRestorePatient(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+	(&dependents{}).install(ctx)
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.RestorePatient(ctx, "PATIENT1"); err == nil || errs.From(err).Code != errs.InvalidState {
+		t.Errorf("RestorePatient of a patient that is not deleted = %v, want %s", err, errs.InvalidState)
+	}
+	if err := contract.DeletePatient(ctx, "PATIENT1", "registered twice", false); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.RestorePatient(ctx, "PATIENT1"); err != nil {
+		t.Fatal(err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventPatientRestored {
+		t.Errorf("event = %+v", event)
+	}
+
+	patient, err := contract.ReadPatient(ctx, "PATIENT1")
+	if err != nil || patient.Deleted || patient.Version != 3 || withoutMetadata(patient) != samplePatient() {
+		t.Errorf("ReadPatient of the restored patient = %+v, %v", patient, err)
+	}
+}
+
+func TestPurgePatient(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+	(&dependents{}).install(ctx)
+
+	ctx = ctx.Next(chaincodetest.HospitalAdmin)
+	if err := contract.PurgePatient(ctx, "PATIENT1"); err == nil || errs.From(err).Code != errs.InvalidState {
+		t.Errorf("PurgePatient of a patient that is not deleted = %v, want %s", err, errs.InvalidState)
+	}
+	if err := contract.DeletePatient(ctx, "PATIENT1", "test data", false); err != nil {
+		t.Fatal(err)
+	}
+
+	var denied *errs.PermissionError
+	ctx.Client = chaincodetest.Hospital
+	if err := contract.PurgePatient(ctx, "PATIENT1"); !errors.As(err, &denied) {
+		t.Errorf("PurgePatient by a hospital without the admin role = %v, want a PermissionError", err)
+	}
+
+	ctx.Client = chaincodetest.HospitalAdmin
+	if err := contract.PurgePatient(ctx, "PATIENT1"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := contract.PatientExists(ctx, "PATIENT1"); exists {
+		t.Error("PATIENT1 still exists")
+	}
+	var notFound *errs.NotFoundError
+	if _, err := readPatientDetails(ctx, "PATIENT1"); !errors.As(err, &notFound) {
+		t.Errorf("reading the details of a purged patient = %v, want them gone", err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventPatientPurged {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestVerifyPatientHash(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+
+	// The TPA cannot read the collection but can still check a copy it was given, whose
+	// age may be out of date
+	ctx = ctx.Next(chaincodetest.NewClient(access.TPAMSP))
+	ctx.Stub.TransientMap = map[string][]byte{transientPatientKey: []byte(`{
+		"smokerStatus": "1", "name": "John Doe", "age": 30, "gender": "Male", "bloodType": "O+",
+		"height": 180, "weight": 75, "address": "123 Main St", "dob": "1990-01-01",
+		"aadharNumber": "234567890124", "insuranceNumber": "INS123456",
+		"phoneNumber": "1234567890", "emailID": "john.doe@example.com"}`)}
+	match, err := contract.VerifyPatientHash(ctx, "PATIENT1")
+	if err != nil || !match {
+		t.Errorf("VerifyPatientHash of the committed details = %v, %v; want true", match, err)
+	}
+
+	tampered := samplePatient()
+	tampered.Weight = 70
+	setTransientPatient(t, ctx, tampered)
+	match, err = contract.VerifyPatientHash(ctx, "PATIENT1")
+	if err != nil || match {
+		t.Errorf("VerifyPatientHash of changed details = %v, %v; want false", match, err)
+	}
+
+	var notFound *errs.NotFoundError
+	if _, err := contract.VerifyPatientHash(ctx, "PATIENT9"); !errors.As(err, &notFound) {
+		t.Errorf("VerifyPatientHash of a missing patient = %v, want a NotFoundError", err)
+	}
+
+	ctx.Stub.TransientMap = nil
+	if _, err := contract.VerifyPatientHash(ctx, "PATIENT1"); err == nil {
+		t.Error("VerifyPatientHash without transient data succeeded")
+	}
+}
+
+func TestVerifyPatientAadhar(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+
+	// insuranceclaimcc checks the Aadhaar number on claims filed by the hospitals
+	for aadharNumber, want := range map[string]bool{"234567890124": true, "987654321096": false} {
+		match, err := contract.VerifyPatientAadhar(ctx, "PATIENT1", aadharNumber)
+		if err != nil || match != want {
+			t.Errorf("VerifyPatientAadhar(%s) = %v, %v; want %v", aadharNumber, match, err, want)
+		}
+	}
+
+	var notFound *errs.NotFoundError
+	if _, err := contract.VerifyPatientAadhar(ctx, "PATIENT9", "234567890124"); !errors.As(err, &notFound) {
+		t.Errorf("VerifyPatientAadhar of a missing patient = %v, want a NotFoundError", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.NewClient(access.TPAMSP))
+	var denied *errs.PermissionError
+	if _, err := contract.VerifyPatientAadhar(ctx, "PATIENT1", "234567890124"); !errors.As(err, &denied) {
+		t.Errorf("VerifyPatientAadhar by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestGetAllPatients(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := chaincodetest.NewContext(access.HealthcareMSP)
+	if err := contract.InitLedger(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx = createPatient(t, ctx, "PATIENT3", samplePatient())
+
+	records, err := contract.GetAllPatients(ctx)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("GetAllPatients = %d records, %v; want 3", len(records), err)
+	}
+
+	page, err := contract.GetAllPatientsWithPagination(ctx, 2, "")
+	if err != nil || page.FetchedRecordsCount != 2 || page.Bookmark == "" {
+		t.Fatalf("first page = %+v, %v", page, err)
+	}
+	page, err = contract.GetAllPatientsWithPagination(ctx, 2, page.Bookmark)
+	if err != nil || page.FetchedRecordsCount != 1 || page.Records[0].PatientID != "PATIENT3" || page.Bookmark != "" {
+		t.Fatalf("second page = %+v, %v", page, err)
+	}
+
+	if _, err := contract.GetAllPatientsWithPagination(ctx, 0, ""); err == nil {
+		t.Error("GetAllPatientsWithPagination with page size 0 succeeded")
+	}
+}
+
+func TestInitLedger(t *testing.T) {
+	contract := new(PatientContract)
+
+	var denied *errs.PermissionError
+	if err := contract.InitLedger(chaincodetest.NewContext(access.InsuranceMSP)); !errors.As(err, &denied) {
+		t.Errorf("InitLedger by the insurer = %v, want a PermissionError", err)
+	}
+
+	ctx := chaincodetest.NewContext(access.HealthcareMSP)
+	if err := contract.InitLedger(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, patientID := range []string{"PATIENT1", "PATIENT2"} {
+		patient, err := contract.ReadPatient(ctx, patientID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validatePatient(patient, chaincodetest.Epoch); err != nil {
+			t.Errorf("sample %s is invalid: %v", patientID, err)
+		}
+	}
+}
+
+func TestGetPatientHistory(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := createPatient(t, chaincodetest.NewContext(access.HealthcareMSP), "PATIENT1", samplePatient())
+	(&dependents{}).install(ctx)
+	updated := samplePatient()
+	updated.InsuranceNumber = "INS999999"
+	ctx = ctx.Next(chaincodetest.Hospital)
+	setTransientPatient(t, ctx, updated)
+	if err := contract.UpdatePatient(ctx, "PATIENT1", 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.DeletePatient(ctx, "PATIENT1", "test data", false); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(chaincodetest.HospitalAdmin)
+	if err := contract.PurgePatient(ctx, "PATIENT1"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := contract.GetPatientHistory(ctx, "PATIENT1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 || !history[0].IsDelete || !history[1].Record.Deleted ||
+		history[2].Record.InsuranceNumber != "INS999999" || history[3].Record.InsuranceNumber != "INS123456" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	contract := new(PatientContract)
+	ctx := chaincodetest.NewContext(access.HealthcareMSP)
+
+	// A patient as stored before composite keys and private data
+	legacyJSON, err := json.Marshal(samplePatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Stub.PutState("PATIENT1", legacyJSON); err != nil {
+		t.Fatal(err)
+	}
+	// A patient whose public record still holds salted hashes of its details
+	hashedKey, err := patientRepository.Key(ctx, "PATIENT2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashedJSON := `{"patientID": "PATIENT2", "insuranceNumber": "INS654321", "salt": "0f1e", "aadharHash": "9a8b", "detailsHash": "7c6d", "version": 3}`
+	if err := ctx.Stub.PutState(hashedKey, []byte(hashedJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := contract.MigrateKeys(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateKeys = %d, %v; want 1", migrated, err)
+	}
+	migrated, err = contract.MigratePrivateData(ctx)
+	if err != nil || migrated != 2 {
+		t.Fatalf("MigratePrivateData = %d, %v; want 2", migrated, err)
+	}
+	migrated, err = contract.MigratePrivateData(ctx)
+	if err != nil || migrated != 0 {
+		t.Errorf("second MigratePrivateData = %d, %v; want 0", migrated, err)
+	}
+
+	patient, err := contract.ReadPatient(ctx, "PATIENT1")
+	if err != nil || withoutMetadata(patient) != samplePatient() {
+		t.Errorf("ReadPatient after migration = %+v, %v", patient, err)
+	}
+	record, err := contract.ReadPatientRecord(ctx, "PATIENT1")
+	if err != nil || record.InsuranceNumber != "INS123456" {
+		t.Errorf("ReadPatientRecord after migration = %+v, %v", record, err)
+	}
+	if hashed := string(ctx.Stub.State[hashedKey]); strings.Contains(hashed, "salt") || strings.Contains(hashed, "Hash") ||
+		!strings.Contains(hashed, `"version":4`) {
+		t.Errorf("hashed record after migration = %s, want version 4 without the hashes", hashed)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.InsuranceMSP)
+	var denied *errs.PermissionError
+	if _, err := contract.MigrateKeys(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigrateKeys by the insurer = %v, want a PermissionError", err)
+	}
+	if _, err := contract.MigratePrivateData(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigratePrivateData by the insurer = %v, want a PermissionError", err)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"common/access"
+	"common/errs"
+	"common/ledger"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// patientCollection is the private data collection holding patient details, shared by
+// the hospitals and the insurer (see collections_config)
+const patientCollection = "Org1Org2PrivateCollection"
+
+// transientPatientKey is the transient map key patient details are passed under, so
+// that they never appear in the transaction's arguments
+const transientPatientKey = "patient"
+
+// PatientRecord is what the public ledger keeps about a patient: the identifiers other
+// chaincodes need. Nothing derived from the private details is kept, as a hash of an
+// Aadhaar number is brute forced in seconds; other chaincodes check an Aadhaar number
+// with VerifyPatientAadhar and committed details with VerifyPatientHash instead.
+type PatientRecord struct {
+	PatientID       string `json:"patientID"`
+	InsuranceNumber string `json:"insuranceNumber"`
+	ledger.Metadata
+}
+
+// readTransientJSON returns the JSON passed in the transient map under transientPatientKey
+func readTransientJSON(ctx contractapi.TransactionContextInterface) ([]byte, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	patientJSON, ok := transientMap[transientPatientKey]
+	if !ok {
+		return nil, errs.New(errs.ValidationFailed, "patient details must be passed in the transient map under %q", transientPatientKey)
+	}
+	return patientJSON, nil
+}
+
+// readTransientPatient decodes the patient details passed in the transient map
+func readTransientPatient(ctx contractapi.TransactionContextInterface) (*Patient, error) {
+	patientJSON, err := readTransientJSON(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var patient Patient
+	err = json.Unmarshal(patientJSON, &patient)
+	if err != nil {
+		return nil, errs.New(errs.ValidationFailed, "failed to decode transient patient details: %v", err)
+	}
+
+	return &patient, nil
+}
+
+// putPatient writes a patient's details, without the derived age and the metadata, to
+// the private collection and its public record, with the next version, to the world state
+func putPatient(ctx contractapi.TransactionContextInterface, patientID string, patient *Patient) error {
+	details := *patient
+	details.Age = 0
+	details.Metadata = ledger.Metadata{}
+	patientJSON, err := json.Marshal(&details)
+	if err != nil {
+		return err
+	}
+
+	record := PatientRecord{
+		PatientID:       patientID,
+		InsuranceNumber: patient.InsuranceNumber,
+	}
+	key, err := patientRepository.Key(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutPrivateData(patientCollection, key, patientJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put private patient details: %v", err)
+	}
+
+	return patientRepository.Put(ctx, patientID, &record)
+}
+
+// VerifyPatientHash reports whether the patient details passed as JSON in the transient
+// map under "patient" are the ones committed for patientID. The candidate is compared with
+// the private data hash, so it works for organizations that cannot read the collection.
+// The candidate's age and metadata are ignored, as they are not stored with the details.
+func (s *PatientContract) VerifyPatientHash(ctx contractapi.TransactionContextInterface, patientID string) (bool, error) {
+	candidate, err := readTransientPatient(ctx)
+	if err != nil {
+		return false, err
+	}
+	// Re-encode the candidate so that field order and whitespace do not matter
+	candidate.Age = 0
+	candidate.Metadata = ledger.Metadata{}
+	candidateJSON, err := json.Marshal(candidate)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := patientRepository.Key(ctx, patientID)
+	if err != nil {
+		return false, err
+	}
+	committedHash, err := ctx.GetStub().GetPrivateDataHash(patientCollection, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read private data hash: %v", err)
+	}
+	if committedHash == nil {
+		return false, patientRepository.NotFound(patientID)
+	}
+
+	hash := sha256.Sum256(candidateJSON)
+	return bytes.Equal(hash[:], committedHash), nil
+}
+
+// VerifyPatientAadhar reports whether aadharNumber is the one in a patient's private
+// details, e.g. the one on a claim filed by insuranceclaimcc. It reads the private
+// collection, so only clients of its members, the hospitals and the insurer, may call it.
+func (s *PatientContract) VerifyPatientAadhar(ctx contractapi.TransactionContextInterface, patientID string, aadharNumber string) (bool, error) {
+	err := access.Authorize(ctx, "VerifyPatientAadhar", access.HealthcareMSP, access.InsuranceMSP)
+	if err != nil {
+		return false, err
+	}
+
+	// Soft deleted patients keep their details, but are not to be claimed for
+	_, err = patientRepository.Read(ctx, patientID)
+	if err != nil {
+		return false, err
+	}
+	patient, err := readPatientDetails(ctx, patientID)
+	if err != nil {
+		return false, err
+	}
+
+	return patient.AadharNumber == aadharNumber, nil
+}
+
+// MigratePrivateData moves patient details still stored in plain world state into the
+// private collection, leaving only the public record behind, and drops the salted hashes
+// public records used to hold. It returns how many records were migrated. Earlier
+// versions remain in the ledger's history and blocks.
+func (s *PatientContract) MigratePrivateData(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigratePrivateData", access.HealthcareMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(patientRepository.ObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var fields map[string]json.RawMessage
+		err = json.Unmarshal(queryResponse.Value, &fields)
+		if err != nil {
+			return 0, err
+		}
+		_, plain := fields["aadharNumber"]
+		_, hashed := fields["salt"]
+		if !plain && !hashed {
+			continue
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return 0, err
+		}
+		if plain {
+			var patient Patient
+			err = json.Unmarshal(queryResponse.Value, &patient)
+			if err != nil {
+				return 0, err
+			}
+			err = putPatient(ctx, attributes[0], &patient)
+		} else {
+			// Records written with salted hashes of the details are rewritten without them
+			var record PatientRecord
+			err = json.Unmarshal(queryResponse.Value, &record)
+			if err != nil {
+				return 0, err
+			}
+			err = patientRepository.Put(ctx, attributes[0], &record)
+		}
+		if err != nil {
+			return 0, err
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// TreatmentHistoryEntry is one committed version of a treatment's public record
+type TreatmentHistoryEntry struct {
+	TxID      string           `json:"txID"`
+	Timestamp string           `json:"timestamp"` // RFC 3339, UTC
+	IsDelete  bool             `json:"isDelete"`
+	Record    *TreatmentRecord `json:"record,omitempty" metadata:",optional"` // nil when the version is a deletion
+}
+
+// GetTreatmentHistory returns every committed version of a treatment's public record
+func (s *TreatmentContract) GetTreatmentHistory(ctx contractapi.TransactionContextInterface, treatmentID string) ([]*TreatmentHistoryEntry, error) {
+	versions, err := treatmentRepository.History(ctx, treatmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []*TreatmentHistoryEntry
+	for _, version := range versions {
+		history = append(history, &TreatmentHistoryEntry{
+			TxID:      version.TxID,
+			Timestamp: version.Timestamp,
+			IsDelete:  version.IsDelete,
+			Record:    version.Record,
+		})
+	}
+
+	return history, nil
+}
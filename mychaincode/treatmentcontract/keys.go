@@ -0,0 +1,22 @@
+package main
+
+import (
+	"common/access"
+	"common/ledger"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// treatmentRepository stores treatment records under composite keys of object type "treatment~id"
+var treatmentRepository = ledger.Repository[TreatmentRecord]{ObjectType: "treatment~id", Kind: "treatment", IDName: "ID"}
+
+// MigrateKeys moves treatment records stored under bare keys such as TREATMENT1 to their
+// composite keys, returning how many records were moved
+func (s *TreatmentContract) MigrateKeys(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigrateKeys", access.HealthcareMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	return treatmentRepository.MigrateKeys(ctx)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"common/access"
+	"common/errs"
+	"common/ledger"
+	"common/money"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// treatmentCollection is the private data collection holding the clinical details of
+// treatments, shared by the hospitals and the insurer (see collections_config). Its hash
+// is on every peer, so any organization can check details against it.
+const treatmentCollection = "Org1Org2PrivateCollection"
+
+// transientTreatmentKey is the transient map key clinical details are passed under, so
+// that they never appear in the transaction's arguments
+const transientTreatmentKey = "treatment"
+
+// TreatmentRecord is what the public ledger keeps about a treatment: what the claim
+// chaincode needs to check and bill a claim for it. The clinical details are kept in the
+// private collection as TreatmentDetails.
+type TreatmentRecord struct {
+	PatientID     string      `json:"patientID"`
+	HospitalName  string      `json:"hospitalName"`
+	AdmissionDate string      `json:"admissionDate"`
+	ReleaseDate   string      `json:"releaseDate"`
+	BillingAmount money.Money `json:"billingAmount"`
+	ledger.Metadata
+}
+
+// TreatmentDetails are the clinical details of a treatment, kept in the private collection
+type TreatmentDetails struct {
+	MedicalCondition string `json:"medicalCondition"`
+	RoomNumber       string `json:"roomNumber"`
+	AdmissionType    string `json:"admissionType"`
+	Medication       string `json:"medication"`
+	DoctorName       string `json:"doctorName"`
+}
+
+// record returns the public part of a treatment
+func (t *Treatment) record() *TreatmentRecord {
+	return &TreatmentRecord{
+		PatientID:     t.PatientID,
+		HospitalName:  t.HospitalName,
+		AdmissionDate: t.AdmissionDate,
+		ReleaseDate:   t.ReleaseDate,
+		BillingAmount: t.BillingAmount,
+		Metadata:      t.Metadata,
+	}
+}
+
+// details returns the clinical details of a treatment
+func (t *Treatment) details() *TreatmentDetails {
+	return &TreatmentDetails{
+		MedicalCondition: t.MedicalCondition,
+		RoomNumber:       t.RoomNumber,
+		AdmissionType:    t.AdmissionType,
+		Medication:       t.Medication,
+		DoctorName:       t.DoctorName,
+	}
+}
+
+// newTreatment joins a treatment's public record and its clinical details
+func newTreatment(record *TreatmentRecord, details *TreatmentDetails) *Treatment {
+	return &Treatment{
+		MedicalCondition: details.MedicalCondition,
+		HospitalName:     record.HospitalName,
+		RoomNumber:       details.RoomNumber,
+		AdmissionType:    details.AdmissionType,
+		Medication:       details.Medication,
+		PatientID:        record.PatientID,
+		AdmissionDate:    record.AdmissionDate,
+		ReleaseDate:      record.ReleaseDate,
+		BillingAmount:    record.BillingAmount,
+		DoctorName:       details.DoctorName,
+		Metadata:         record.Metadata,
+	}
+}
+
+// readTransientJSON returns the JSON passed in the transient map under transientTreatmentKey,
+// or nil if there is none and the details are optional
+func readTransientJSON(ctx contractapi.TransactionContextInterface, optional bool) ([]byte, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	detailsJSON, ok := transientMap[transientTreatmentKey]
+	if !ok && !optional {
+		return nil, errs.New(errs.ValidationFailed, "the clinical details must be passed in the transient map under %q", transientTreatmentKey)
+	}
+	return detailsJSON, nil
+}
+
+// readTransientDetails decodes the clinical details passed in the transient map
+func readTransientDetails(ctx contractapi.TransactionContextInterface) (*TreatmentDetails, error) {
+	detailsJSON, err := readTransientJSON(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var details TreatmentDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		return nil, errs.New(errs.ValidationFailed, "failed to decode transient treatment details: %v", err)
+	}
+
+	return &details, nil
+}
+
+// readTreatmentDetails reads the clinical details of a treatment from the private collection
+func readTreatmentDetails(ctx contractapi.TransactionContextInterface, treatmentID string) (*TreatmentDetails, error) {
+	key, err := treatmentRepository.Key(ctx, treatmentID)
+	if err != nil {
+		return nil, err
+	}
+	detailsJSON, err := ctx.GetStub().GetPrivateData(treatmentCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from private collection: %v", err)
+	}
+	if detailsJSON == nil {
+		return nil, treatmentRepository.NotFound(treatmentID)
+	}
+
+	var details TreatmentDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// readTreatment reads a treatment's public record and its clinical details
+func readTreatment(ctx contractapi.TransactionContextInterface, treatmentID string) (*Treatment, error) {
+	record, err := treatmentRepository.Read(ctx, treatmentID)
+	if err != nil {
+		return nil, err
+	}
+	details, err := readTreatmentDetails(ctx, treatmentID)
+	if err != nil {
+		return nil, err
+	}
+	return newTreatment(record, details), nil
+}
+
+// putTreatment writes a treatment's clinical details to the private collection and its
+// public record, with the next version, to the world state
+func putTreatment(ctx contractapi.TransactionContextInterface, treatmentID string, treatment *Treatment) error {
+	detailsJSON, err := json.Marshal(treatment.details())
+	if err != nil {
+		return err
+	}
+	key, err := treatmentRepository.Key(ctx, treatmentID)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutPrivateData(treatmentCollection, key, detailsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put private treatment details: %v", err)
+	}
+
+	return treatmentRepository.Put(ctx, treatmentID, treatment.record())
+}
+
+// VerifyTreatmentHash reports whether the clinical details passed as JSON in the
+// transient map under "treatment" are the ones committed for treatmentID. The candidate
+// is compared with the private data hash, so it works for organizations that cannot read
+// the collection. A whole treatment may be passed; only its clinical details are
+// compared, as the rest is public and read with ReadTreatmentRecord.
+func (s *TreatmentContract) VerifyTreatmentHash(ctx contractapi.TransactionContextInterface, treatmentID string) (bool, error) {
+	candidate, err := readTransientDetails(ctx)
+	if err != nil {
+		return false, err
+	}
+	// Re-encode the candidate so that field order, whitespace and public fields do not matter
+	candidateJSON, err := json.Marshal(candidate)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := treatmentRepository.Key(ctx, treatmentID)
+	if err != nil {
+		return false, err
+	}
+	committedHash, err := ctx.GetStub().GetPrivateDataHash(treatmentCollection, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read private data hash: %v", err)
+	}
+	if committedHash == nil {
+		return false, errs.New(errs.NotFound, "treatment with ID %s has no private record to verify against", treatmentID).With("id", treatmentID)
+	}
+
+	hash := sha256.Sum256(candidateJSON)
+	return bytes.Equal(hash[:], committedHash), nil
+}
+
+// MigratePrivateData moves the clinical details of treatments still stored in the world
+// state into the private collection, replacing the full copy earlier versions kept there,
+// and leaves only the public record in the world state. It returns how many treatments
+// were migrated. Earlier versions remain in the ledger's history and blocks.
+func (s *TreatmentContract) MigratePrivateData(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigratePrivateData", access.HealthcareMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(treatmentRepository.ObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		public, err := hasPublicDetails(queryResponse.Value)
+		if err != nil {
+			return 0, err
+		}
+		if !public {
+			continue
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return 0, err
+		}
+		err = rewriteTreatment(ctx, attributes[0], queryResponse.Value)
+		if err != nil {
+			return 0, err
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// hasPublicDetails reports whether a treatment record in the world state still holds
+// clinical details, as written before they moved to the private collection
+func hasPublicDetails(recordJSON []byte) (bool, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(recordJSON, &fields)
+	if err != nil {
+		return false, err
+	}
+	_, public := fields["medicalCondition"]
+	return public, nil
+}
+
+// rewriteTreatment writes back a treatment record read from the world state. Clinical
+// details it still holds are moved to the private collection; otherwise those in the
+// collection are kept.
+func rewriteTreatment(ctx contractapi.TransactionContextInterface, treatmentID string, recordJSON []byte) error {
+	public, err := hasPublicDetails(recordJSON)
+	if err != nil {
+		return err
+	}
+	var treatment Treatment
+	err = json.Unmarshal(recordJSON, &treatment)
+	if err != nil {
+		return err
+	}
+	if public {
+		return putTreatment(ctx, treatmentID, &treatment)
+	}
+	return treatmentRepository.Put(ctx, treatmentID, treatment.record())
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The rich queries below need CouchDB as the state database. Each names the index it
+// relies on; the index definitions ship in META-INF/statedb/couchdb/indexes.
+
+// QueryTreatmentIDsByPatient returns the IDs of the treatments of a patient, e.g. for
+// the patient chaincode to check before deleting the patient
+func (s *TreatmentContract) QueryTreatmentIDsByPatient(ctx contractapi.TransactionContextInterface, patientID string) ([]string, error) {
+	query := map[string]interface{}{
+		"selector":  map[string]string{"patientID": patientID},
+		"use_index": []string{"_design/indexPatientDoc", "indexPatient"},
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return treatmentRepository.QueryIDs(ctx, string(queryJSON))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"common/access"
+	"common/chaincodetest"
+)
+
+func TestQueryTreatmentIDsByPatient(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	ctx = createTreatment(t, ctx, "TREATMENT2", sampleArgs())
+	other := sampleArgs()
+	other.patientID = "PATIENT2"
+	ctx = createTreatment(t, ctx, "TREATMENT3", other)
+
+	ids, err := contract.QueryTreatmentIDsByPatient(ctx, "PATIENT1")
+	if err != nil || len(ids) != 2 || ids[0] != "TREATMENT1" || ids[1] != "TREATMENT2" {
+		t.Errorf("QueryTreatmentIDsByPatient(PATIENT1) = %v, %v", ids, err)
+	}
+
+	// Deleted treatments are left out
+	chaincodetest.WithClaims(ctx, nil)
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.DeleteTreatment(ctx, "TREATMENT1", "entered twice"); err != nil {
+		t.Fatal(err)
+	}
+	ids, err = contract.QueryTreatmentIDsByPatient(ctx, "PATIENT1")
+	if err != nil || len(ids) != 1 || ids[0] != "TREATMENT2" {
+		t.Errorf("QueryTreatmentIDsByPatient after a delete = %v, %v", ids, err)
+	}
+	if ids, err := contract.QueryTreatmentIDsByPatient(ctx, "PATIENT9"); err != nil || len(ids) != 0 {
+		t.Errorf("QueryTreatmentIDsByPatient(PATIENT9) = %v, %v", ids, err)
+	}
+}
@@ -1,24 +1,48 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 
+	"common/access"
+	"common/errs"
+	"common/events"
+	"common/invoke"
+	"common/ledger"
+	"common/money"
+	"common/patch"
+	"common/validation"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// Treatment represents the structure of a treatment record
+// Treatment is a treatment as clients see it: its public TreatmentRecord joined with its
+// clinical TreatmentDetails from the private collection, see privatedata.go
 type Treatment struct {
-	MedicalCondition string  `json:"medicalCondition"`
-	HospitalName     string  `json:"hospitalName"`
-	RoomNumber       string  `json:"roomNumber"`
-	AdmissionType    string  `json:"admissionType"`
-	Medication       string  `json:"medication"`
-	PatientID        string  `json:"patientID"`
-	AdmissionDate    string  `json:"admissionDate"`
-	ReleaseDate      string  `json:"releaseDate"`
-	BillingAmount    float64 `json:"billingAmount"`
-	DoctorName       string  `json:"doctorName"`
+	MedicalCondition string      `json:"medicalCondition"`
+	HospitalName     string      `json:"hospitalName"`
+	RoomNumber       string      `json:"roomNumber"`
+	AdmissionType    string      `json:"admissionType"`
+	Medication       string      `json:"medication"`
+	PatientID        string      `json:"patientID"`
+	AdmissionDate    string      `json:"admissionDate"`
+	ReleaseDate      string      `json:"releaseDate"`
+	BillingAmount    money.Money `json:"billingAmount"`
+	DoctorName       string      `json:"doctorName"`
+
+	ledger.Metadata // of the treatment's TreatmentRecord, never stored with the details
+}
+
+// validateTreatment checks the fields of a treatment record, adding every invalid one to v
+func validateTreatment(v *validation.Validator, treatment *Treatment) {
+	v.Required("medicalCondition", treatment.MedicalCondition)
+	v.Required("hospitalName", treatment.HospitalName)
+	v.Required("patientID", treatment.PatientID)
+	v.DateOrder("admissionDate", treatment.AdmissionDate, "releaseDate", treatment.ReleaseDate)
+	if treatment.BillingAmount.Amount < 0 {
+		v.Fail("billingAmount", "must not be negative")
+	}
+	v.Required("doctorName", treatment.DoctorName)
 }
 
 // TreatmentContract provides functions for managing treatment records
@@ -28,6 +52,11 @@ type TreatmentContract struct {
 
 // InitLedger initializes the ledger with some sample data (optional)
 func (s *TreatmentContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	err := access.Authorize(ctx, "InitLedger", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
 	treatments := []Treatment{
 		{
 			MedicalCondition: "Fever",
@@ -38,7 +67,7 @@ func (s *TreatmentContract) InitLedger(ctx contractapi.TransactionContextInterfa
 			PatientID:        "PATIENT1",
 			AdmissionDate:    "2023-10-01",
 			ReleaseDate:      "2023-10-05",
-			BillingAmount:    500.50,
+			BillingAmount:    money.Money{Amount: 50050, Currency: money.DefaultCurrency},
 			DoctorName:       "Dr. Smith",
 		},
 		{
@@ -50,18 +79,14 @@ func (s *TreatmentContract) InitLedger(ctx contractapi.TransactionContextInterfa
 			PatientID:        "PATIENT2",
 			AdmissionDate:    "2023-09-15",
 			ReleaseDate:      "2023-09-25",
-			BillingAmount:    1200.75,
+			BillingAmount:    money.Money{Amount: 120075, Currency: money.DefaultCurrency},
 			DoctorName:       "Dr. Johnson",
 		},
 	}
 
 	for i, treatment := range treatments {
 		treatmentID := fmt.Sprintf("TREATMENT%d", i+1)
-		treatmentJSON, err := json.Marshal(treatment)
-		if err != nil {
-			return err
-		}
-		err = ctx.GetStub().PutState(treatmentID, treatmentJSON)
+		err = putTreatment(ctx, treatmentID, &treatment)
 		if err != nil {
 			return fmt.Errorf("failed to put to world state: %v", err)
 		}
@@ -70,160 +95,372 @@ func (s *TreatmentContract) InitLedger(ctx contractapi.TransactionContextInterfa
 	return nil
 }
 
-// CreateTreatment adds a new treatment record to the ledger
+// CreateTreatment adds a new treatment to the ledger. billingAmount is parsed with
+// money.Parse, e.g. "1200.75" or "INR 1200.75". The clinical details are passed as JSON
+// in the transient map under "treatment", e.g. {"medicalCondition": "Fever", ...}, and
+// stored in the private collection; the world state only gets the TreatmentRecord.
 func (s *TreatmentContract) CreateTreatment(
 	ctx contractapi.TransactionContextInterface,
 	treatmentID string,
-	medicalCondition string,
 	hospitalName string,
-	roomNumber string,
-	admissionType string,
-	medication string,
 	patientID string,
 	admissionDate string,
 	releaseDate string,
-	billingAmount float64,
-	doctorName string,
+	billingAmount string,
 ) error {
-	exists, err := s.TreatmentExists(ctx, treatmentID)
+	err := access.Authorize(ctx, "CreateTreatment", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	exists, err := treatmentRepository.Exists(ctx, treatmentID)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("treatment with ID %s already exists", treatmentID)
+		return treatmentRepository.AlreadyExists(treatmentID)
 	}
+	details, err := readTransientDetails(ctx)
+	if err != nil {
+		return err
+	}
+	var v validation.Validator
+	billing, err := money.Parse(billingAmount)
+	v.AddError("billingAmount", err)
 
-	treatment := Treatment{
-		MedicalCondition: medicalCondition,
-		HospitalName:     hospitalName,
-		RoomNumber:       roomNumber,
-		AdmissionType:    admissionType,
-		Medication:       medication,
-		PatientID:        patientID,
-		AdmissionDate:    admissionDate,
-		ReleaseDate:      releaseDate,
-		BillingAmount:    billingAmount,
-		DoctorName:       doctorName,
+	treatment := newTreatment(&TreatmentRecord{
+		PatientID:     patientID,
+		HospitalName:  hospitalName,
+		AdmissionDate: admissionDate,
+		ReleaseDate:   releaseDate,
+		BillingAmount: billing,
+	}, details)
+	validateTreatment(&v, treatment)
+	err = v.Err()
+	if err != nil {
+		return err
 	}
 
-	treatmentJSON, err := json.Marshal(treatment)
+	err = putTreatment(ctx, treatmentID, treatment)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(treatmentID, treatmentJSON)
+	return events.Emit(ctx, EventTreatmentCreated, treatmentID, "", "")
 }
 
-// ReadTreatment retrieves a treatment record from the ledger using treatmentID
+// ReadTreatment retrieves a treatment, with its clinical details from the private
+// collection. Only members of the collection can read them; others, such as the claim
+// chaincode acting for the TPA, should use ReadTreatmentRecord.
 func (s *TreatmentContract) ReadTreatment(ctx contractapi.TransactionContextInterface, treatmentID string) (*Treatment, error) {
-	treatmentJSON, err := ctx.GetStub().GetState(treatmentID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if treatmentJSON == nil {
-		return nil, fmt.Errorf("treatment with ID %s does not exist", treatmentID)
-	}
-
-	var treatment Treatment
-	err = json.Unmarshal(treatmentJSON, &treatment)
-	if err != nil {
-		return nil, err
-	}
+	return readTreatment(ctx, treatmentID)
+}
 
-	return &treatment, nil
+// ReadTreatmentRecord retrieves the public record of a treatment from the world state
+func (s *TreatmentContract) ReadTreatmentRecord(ctx contractapi.TransactionContextInterface, treatmentID string) (*TreatmentRecord, error) {
+	return treatmentRepository.Read(ctx, treatmentID)
 }
 
-// UpdateTreatment updates an existing treatment record in the ledger
+// UpdateTreatment replaces an existing treatment, its clinical details passed in the
+// transient map as for CreateTreatment. It fails with CONFLICT unless expectedVersion is
+// 0 or the treatment's current version. Once the insurer has approved or closed a claim
+// for the treatment, its patient and billing amount can no longer change.
 func (s *TreatmentContract) UpdateTreatment(
 	ctx contractapi.TransactionContextInterface,
 	treatmentID string,
-	medicalCondition string,
 	hospitalName string,
-	roomNumber string,
-	admissionType string,
-	medication string,
 	patientID string,
 	admissionDate string,
 	releaseDate string,
-	billingAmount float64,
-	doctorName string,
+	billingAmount string,
+	expectedVersion int,
 ) error {
-	exists, err := s.TreatmentExists(ctx, treatmentID)
+	err := access.Authorize(ctx, "UpdateTreatment", access.HealthcareMSP)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("treatment with ID %s does not exist", treatmentID)
+
+	existing, err := treatmentRepository.Read(ctx, treatmentID)
+	if err != nil {
+		return err
+	}
+	err = treatmentRepository.CheckVersion(treatmentID, existing, expectedVersion)
+	if err != nil {
+		return err
 	}
+	details, err := readTransientDetails(ctx)
+	if err != nil {
+		return err
+	}
+	var v validation.Validator
+	billing, err := money.Parse(billingAmount)
+	v.AddError("billingAmount", err)
 
-	treatment := Treatment{
-		MedicalCondition: medicalCondition,
-		HospitalName:     hospitalName,
-		RoomNumber:       roomNumber,
-		AdmissionType:    admissionType,
-		Medication:       medication,
-		PatientID:        patientID,
-		AdmissionDate:    admissionDate,
-		ReleaseDate:      releaseDate,
-		BillingAmount:    billingAmount,
-		DoctorName:       doctorName,
+	treatment := newTreatment(&TreatmentRecord{
+		PatientID:     patientID,
+		HospitalName:  hospitalName,
+		AdmissionDate: admissionDate,
+		ReleaseDate:   releaseDate,
+		BillingAmount: billing,
+	}, details)
+	validateTreatment(&v, treatment)
+	err = v.Err()
+	if err != nil {
+		return err
+	}
+	err = checkClaimedFieldsUnchanged(ctx, treatmentID, existing, treatment)
+	if err != nil {
+		return err
 	}
 
-	treatmentJSON, err := json.Marshal(treatment)
+	err = putTreatment(ctx, treatmentID, treatment)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(treatmentID, treatmentJSON)
+	return events.Emit(ctx, EventTreatmentUpdated, treatmentID, "", "")
 }
 
-// DeleteTreatment deletes a treatment record from the ledger
-func (s *TreatmentContract) DeleteTreatment(ctx contractapi.TransactionContextInterface, treatmentID string) error {
-	exists, err := s.TreatmentExists(ctx, treatmentID)
+// PatchTreatment changes only the fields named in patch, a JSON object such as
+// {"releaseDate": "2024-01-10"}, keeping the others as stored. The billing amount is given
+// as {"amount": 50050, "currency": "INR"} in paise, or as a plain number of rupees.
+// Clinical details are patched the same way, but through the transient map under
+// "treatment"; patch may then be empty. Like UpdateTreatment, it checks expectedVersion
+// unless it is 0, and refuses the same changes to a treatment with decided claims.
+func (s *TreatmentContract) PatchTreatment(ctx contractapi.TransactionContextInterface, treatmentID string, patchJSON string, expectedVersion int) error {
+	err := access.Authorize(ctx, "PatchTreatment", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	record, err := treatmentRepository.Read(ctx, treatmentID)
+	if err != nil {
+		return err
+	}
+	err = treatmentRepository.CheckVersion(treatmentID, record, expectedVersion)
+	if err != nil {
+		return err
+	}
+	existing := *record
+	details, err := readTreatmentDetails(ctx, treatmentID)
+	if err != nil {
+		return err
+	}
+	detailsPatch, err := readTransientJSON(ctx, true)
+	if err != nil {
+		return err
+	}
+	if patchJSON == "" && detailsPatch == nil {
+		return errs.New(errs.ValidationFailed, "a patch must change at least one field")
+	}
+	if patchJSON != "" {
+		err = patch.Apply(record, []byte(patchJSON), ledger.MetadataFields...)
+		if err != nil {
+			return err
+		}
+	}
+	if detailsPatch != nil {
+		err = patch.Apply(details, detailsPatch)
+		if err != nil {
+			return err
+		}
+	}
+	treatment := newTreatment(record, details)
+	var v validation.Validator
+	validateTreatment(&v, treatment)
+	err = v.Err()
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("treatment with ID %s does not exist", treatmentID)
+	err = checkClaimedFieldsUnchanged(ctx, treatmentID, &existing, treatment)
+	if err != nil {
+		return err
 	}
 
-	return ctx.GetStub().DelState(treatmentID)
+	err = putTreatment(ctx, treatmentID, treatment)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventTreatmentUpdated, treatmentID, "", "")
 }
 
-// TreatmentExists checks if a treatment record exists in the ledger
-func (s *TreatmentContract) TreatmentExists(ctx contractapi.TransactionContextInterface, treatmentID string) (bool, error) {
-	treatmentJSON, err := ctx.GetStub().GetState(treatmentID)
+// checkClaimedFieldsUnchanged fails with INVALID_STATE if the treatment's patient or
+// billing amount would change while the insurer has decided a claim filed for it
+func checkClaimedFieldsUnchanged(ctx contractapi.TransactionContextInterface, treatmentID string, existing *TreatmentRecord, treatment *Treatment) error {
+	if treatment.PatientID == existing.PatientID && treatment.BillingAmount == existing.BillingAmount {
+		return nil
+	}
+	claimIDs, err := invoke.DecidedClaimIDs(ctx, "QueryClaimsByTreatment", treatmentID)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return err
+	}
+	if len(claimIDs) > 0 {
+		return errs.New(errs.InvalidState, "treatment with ID %s has decided claims, its patient and billing amount can no longer change", treatmentID).
+			With("treatmentID", treatmentID).With("claimIDs", claimIDs)
+	}
+	return nil
+}
+
+// DeleteTreatment soft deletes a treatment record for the given reason. The record is
+// kept, marked deleted, but no longer read or listed until RestoreTreatment. A treatment
+// that an open claim was filed for cannot be deleted.
+func (s *TreatmentContract) DeleteTreatment(ctx contractapi.TransactionContextInterface, treatmentID string, reason string) error {
+	err := access.Authorize(ctx, "DeleteTreatment", access.HealthcareMSP)
+	if err != nil {
+		return err
 	}
 
-	return treatmentJSON != nil, nil
+	err = checkNoOpenClaims(ctx, treatmentID)
+	if err != nil {
+		return err
+	}
+	_, err = treatmentRepository.SoftDelete(ctx, treatmentID, reason)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventTreatmentDeleted, treatmentID, "", "")
 }
 
-// GetAllTreatments returns all treatment records in the ledger
-func (s *TreatmentContract) GetAllTreatments(ctx contractapi.TransactionContextInterface) ([]*Treatment, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+// checkNoOpenClaims fails with an *errs.InUseError if a claim that is not closed was
+// filed for the treatment
+func checkNoOpenClaims(ctx contractapi.TransactionContextInterface, treatmentID string) error {
+	claimIDs, err := invoke.OpenClaimIDs(ctx, "QueryClaimsByTreatment", treatmentID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if len(claimIDs) > 0 {
+		return treatmentRepository.InUse(treatmentID, "open claims", claimIDs)
+	}
+	return nil
+}
+
+// RestoreTreatment undoes the soft deletion of a treatment record
+func (s *TreatmentContract) RestoreTreatment(ctx contractapi.TransactionContextInterface, treatmentID string) error {
+	err := access.Authorize(ctx, "RestoreTreatment", access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	_, err = treatmentRepository.Restore(ctx, treatmentID)
+	if err != nil {
+		return err
+	}
+
+	return events.Emit(ctx, EventTreatmentRestored, treatmentID, "", "")
+}
+
+// PurgeTreatment removes a soft deleted treatment record from the world state and the
+// private collection for good, unless claims were filed for it. Only the hospitals'
+// admins may call it.
+func (s *TreatmentContract) PurgeTreatment(ctx contractapi.TransactionContextInterface, treatmentID string) error {
+	err := access.RequireRole(ctx, "PurgeTreatment", access.AdminRole, access.HealthcareMSP)
+	if err != nil {
+		return err
+	}
+
+	// Closed claims keep referring to a deleted treatment, but must not lose it
+	claimIDs, err := invoke.ClaimIDs(ctx, "QueryClaimsByTreatment", treatmentID)
+	if err != nil {
+		return err
+	}
+	if len(claimIDs) > 0 {
+		return treatmentRepository.InUse(treatmentID, "claims", claimIDs)
+	}
+	err = treatmentRepository.Purge(ctx, treatmentID)
+	if err != nil {
+		return err
+	}
+	key, err := treatmentRepository.Key(ctx, treatmentID)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelPrivateData(treatmentCollection, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete private treatment record: %v", err)
+	}
+
+	return events.Emit(ctx, EventTreatmentPurged, treatmentID, "", "")
+}
+
+// TreatmentExists checks if a treatment record exists in the ledger, including soft
+// deleted ones, whose IDs cannot be reused
+func (s *TreatmentContract) TreatmentExists(ctx contractapi.TransactionContextInterface, treatmentID string) (bool, error) {
+	return treatmentRepository.Exists(ctx, treatmentID)
+}
+
+// MigrateMoney rewrites treatment records whose billing amount is still stored as a
+// floating point number into Money, returning how many records were converted.
+// Run MigrateKeys first.
+func (s *TreatmentContract) MigrateMoney(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := access.Authorize(ctx, "MigrateMoney", access.HealthcareMSP)
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(treatmentRepository.ObjectType, []string{})
+	if err != nil {
+		return 0, err
 	}
 	defer resultsIterator.Close()
 
-	var treatments []*Treatment
+	migrated := 0
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 
-		var treatment Treatment
-		err = json.Unmarshal(queryResponse.Value, &treatment)
+		legacy, err := money.HasLegacyAmount(queryResponse.Value, "billingAmount")
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		treatments = append(treatments, &treatment)
+		if !legacy {
+			continue
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return 0, err
+		}
+		err = rewriteTreatment(ctx, attributes[0], queryResponse.Value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to put to world state: %v", err)
+		}
+		migrated++
 	}
 
-	return treatments, nil
+	return migrated, nil
+}
+
+// GetAllTreatments returns the public records of all treatments in the ledger except the
+// soft deleted ones
+func (s *TreatmentContract) GetAllTreatments(ctx contractapi.TransactionContextInterface) ([]*TreatmentRecord, error) {
+	return treatmentRepository.All(ctx)
+}
+
+// GetDeletedTreatments returns the public records of the soft deleted treatments
+func (s *TreatmentContract) GetDeletedTreatments(ctx contractapi.TransactionContextInterface) ([]*TreatmentRecord, error) {
+	return treatmentRepository.Deleted(ctx)
+}
+
+// TreatmentPage is one page of treatment records along with the bookmark for the next page
+type TreatmentPage struct {
+	Records             []*TreatmentRecord `json:"records"`
+	FetchedRecordsCount int32              `json:"fetchedRecordsCount"`
+	Bookmark            string             `json:"bookmark"`
+}
+
+// GetAllTreatmentsWithPagination returns up to pageSize treatments starting at bookmark.
+// Pass an empty bookmark for the first page and the returned bookmark for the next.
+func (s *TreatmentContract) GetAllTreatmentsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*TreatmentPage, error) {
+	page, err := treatmentRepository.Page(ctx, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TreatmentPage{Records: page.Records, FetchedRecordsCount: page.FetchedRecordsCount, Bookmark: page.Bookmark}, nil
 }
 
 func main() {
@@ -233,7 +470,8 @@ func main() {
 		return
 	}
 
-	if err := chaincode.Start(); err != nil {
+	// Wrapped, every error reaches clients as an errs.Error they can branch on by code
+	if err := shim.Start(errs.WithCodes(chaincode)); err != nil {
 		fmt.Printf("Error starting treatment chaincode: %v\n", err)
 	}
-}
\ No newline at end of file
+}
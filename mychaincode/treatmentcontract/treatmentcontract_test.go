@@ -0,0 +1,667 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"common/access"
+	"common/chaincodetest"
+	"common/errs"
+	"common/invoke"
+	"common/ledger"
+	"common/money"
+	"common/validation"
+)
+
+// treatmentArgs are the arguments of CreateTreatment and UpdateTreatment after the
+// treatment ID, along with the clinical details they take through the transient map
+type treatmentArgs struct {
+	medicalCondition, hospitalName, roomNumber, admissionType, medication string
+	patientID, admissionDate, releaseDate, billingAmount, doctorName      string
+	version                                                               int // expected by update, 0 for any
+}
+
+// sampleArgs returns the arguments of a valid treatment
+func sampleArgs() treatmentArgs {
+	return treatmentArgs{
+		medicalCondition: "Fever",
+		hospitalName:     "City Hospital",
+		roomNumber:       "101",
+		admissionType:    "Emergency",
+		medication:       "Paracetamol",
+		patientID:        "PATIENT1",
+		admissionDate:    "2023-10-01",
+		releaseDate:      "2023-10-05",
+		billingAmount:    "500.50",
+		doctorName:       "Dr. Smith",
+	}
+}
+
+// detailsJSON encodes the clinical details of a as they are passed and stored
+func detailsJSON(a treatmentArgs) []byte {
+	detailsJSON, _ := json.Marshal(TreatmentDetails{
+		MedicalCondition: a.medicalCondition,
+		RoomNumber:       a.roomNumber,
+		AdmissionType:    a.admissionType,
+		Medication:       a.medication,
+		DoctorName:       a.doctorName,
+	})
+	return detailsJSON
+}
+
+func create(ctx *chaincodetest.Context, treatmentID string, a treatmentArgs) error {
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: detailsJSON(a)}
+	return new(TreatmentContract).CreateTreatment(ctx, treatmentID, a.hospitalName, a.patientID, a.admissionDate, a.releaseDate, a.billingAmount)
+}
+
+func update(ctx *chaincodetest.Context, treatmentID string, a treatmentArgs) error {
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: detailsJSON(a)}
+	return new(TreatmentContract).UpdateTreatment(ctx, treatmentID, a.hospitalName, a.patientID, a.admissionDate, a.releaseDate, a.billingAmount, a.version)
+}
+
+// createTreatment creates a treatment in a transaction of its own submitted by the hospital
+func createTreatment(t *testing.T, ctx *chaincodetest.Context, treatmentID string, a treatmentArgs) *chaincodetest.Context {
+	t.Helper()
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := create(ctx, treatmentID, a); err != nil {
+		t.Fatalf("CreateTreatment(%s) = %v", treatmentID, err)
+	}
+	return ctx
+}
+
+func TestCreateTreatment(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+
+	treatment, err := contract.ReadTreatment(ctx, "TREATMENT1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Treatment{
+		MedicalCondition: "Fever",
+		HospitalName:     "City Hospital",
+		RoomNumber:       "101",
+		AdmissionType:    "Emergency",
+		Medication:       "Paracetamol",
+		PatientID:        "PATIENT1",
+		AdmissionDate:    "2023-10-01",
+		ReleaseDate:      "2023-10-05",
+		BillingAmount:    money.Money{Amount: 50050, Currency: "INR"},
+		DoctorName:       "Dr. Smith",
+		Metadata: ledger.Metadata{
+			Version:           1,
+			LastModifiedTxID:  ctx.Stub.TxID,
+			LastModifiedAt:    "2024-01-01T00:01:00Z",
+			LastModifiedBy:    chaincodetest.Hospital.ID,
+			LastModifiedByMSP: access.HealthcareMSP,
+		},
+	}
+	if *treatment != want {
+		t.Errorf("ReadTreatment = %+v, want %+v", treatment, want)
+	}
+
+	// The clinical details are only in the private collection, the rest only in the world state
+	key, _ := treatmentRepository.Key(ctx, "TREATMENT1")
+	if private, _ := ctx.Stub.GetPrivateData(treatmentCollection, key); string(private) != string(detailsJSON(sampleArgs())) {
+		t.Errorf("private details = %s", private)
+	}
+	if public, _ := ctx.Stub.GetState(key); strings.Contains(string(public), "Fever") || !strings.Contains(string(public), "City Hospital") {
+		t.Errorf("public record = %s", public)
+	}
+	record, err := contract.ReadTreatmentRecord(ctx, "TREATMENT1")
+	if err != nil || *record != *want.record() {
+		t.Errorf("ReadTreatmentRecord = %+v, %v", record, err)
+	}
+
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventTreatmentCreated || event.RecordID != "TREATMENT1" {
+		t.Errorf("event = %+v", event)
+	}
+	if exists, err := contract.TreatmentExists(ctx, "TREATMENT1"); err != nil || !exists {
+		t.Errorf("TreatmentExists = %v, %v", exists, err)
+	}
+}
+
+func TestCreateTreatmentErrors(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+
+	var exists *errs.AlreadyExistsError
+	if err := create(ctx, "TREATMENT1", sampleArgs()); !errors.As(err, &exists) {
+		t.Errorf("CreateTreatment of an existing ID = %v, want an AlreadyExistsError", err)
+	}
+
+	tests := map[string]func(a *treatmentArgs){
+		"medicalCondition": func(a *treatmentArgs) { a.medicalCondition = "" },
+		"hospitalName":     func(a *treatmentArgs) { a.hospitalName = " " },
+		"patientID":        func(a *treatmentArgs) { a.patientID = "" },
+		"doctorName":       func(a *treatmentArgs) { a.doctorName = "" },
+		"admissionDate":    func(a *treatmentArgs) { a.admissionDate = "1st October" },
+		"releaseDate":      func(a *treatmentArgs) { a.releaseDate = "2023-09-30" },
+		"billingAmount":    func(a *treatmentArgs) { a.billingAmount = "five hundred" },
+	}
+	for field, change := range tests {
+		a := sampleArgs()
+		change(&a)
+		var fieldErrors validation.Errors
+		err := create(ctx, "TREATMENT2", a)
+		if !errors.As(err, &fieldErrors) || len(fieldErrors) != 1 || fieldErrors[0].Field != field {
+			t.Errorf("CreateTreatment with invalid %s = %v", field, err)
+		}
+	}
+
+	negative := sampleArgs()
+	negative.billingAmount = "-1"
+	var fieldErrors validation.Errors
+	if err := create(ctx, "TREATMENT2", negative); !errors.As(err, &fieldErrors) || fieldErrors[0].Message != "must not be negative" {
+		t.Errorf("CreateTreatment with a negative bill = %v", err)
+	}
+
+	a := sampleArgs()
+	ctx.Stub.TransientMap = nil
+	err := new(TreatmentContract).CreateTreatment(ctx, "TREATMENT2", a.hospitalName, a.patientID, a.admissionDate, a.releaseDate, a.billingAmount)
+	if err == nil || errs.From(err).Code != errs.ValidationFailed {
+		t.Errorf("CreateTreatment without clinical details = %v, want %s", err, errs.ValidationFailed)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.InsuranceMSP)
+	var denied *errs.PermissionError
+	if err := create(ctx, "TREATMENT2", sampleArgs()); !errors.As(err, &denied) {
+		t.Errorf("CreateTreatment by the insurer = %v, want a PermissionError", err)
+	}
+
+	if exists, _ := contract.TreatmentExists(ctx, "TREATMENT2"); exists {
+		t.Error("a failed CreateTreatment wrote TREATMENT2")
+	}
+}
+
+func TestUpdateTreatment(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	chaincodetest.WithClaims(ctx, nil)
+
+	a := sampleArgs()
+	a.releaseDate = "2023-10-07"
+	a.billingAmount = "INR 750"
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := update(ctx, "TREATMENT1", a); err != nil {
+		t.Fatal(err)
+	}
+	treatment, err := contract.ReadTreatment(ctx, "TREATMENT1")
+	if err != nil || treatment.ReleaseDate != "2023-10-07" || treatment.BillingAmount.Amount != 75000 {
+		t.Errorf("ReadTreatment after update = %+v, %v", treatment, err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventTreatmentUpdated {
+		t.Errorf("event = %+v", event)
+	}
+
+	var notFound *errs.NotFoundError
+	if err := update(ctx, "TREATMENT9", sampleArgs()); !errors.As(err, &notFound) {
+		t.Errorf("UpdateTreatment of a missing treatment = %v, want a NotFoundError", err)
+	}
+
+	var conflict *errs.ConflictError
+	a.version = 1
+	if err := update(ctx, "TREATMENT1", a); !errors.As(err, &conflict) {
+		t.Errorf("UpdateTreatment of version 1 = %v, want a ConflictError", err)
+	}
+	a.version = 2
+	if err := update(ctx, "TREATMENT1", a); err != nil {
+		t.Errorf("UpdateTreatment of the current version = %v", err)
+	}
+
+	a.version = 0
+	a.admissionDate = "2023-11-01"
+	var fieldErrors validation.Errors
+	if err := update(ctx, "TREATMENT1", a); !errors.As(err, &fieldErrors) {
+		t.Errorf("UpdateTreatment releasing before admission = %v, want field errors", err)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.TPAMSP)
+	var denied *errs.PermissionError
+	if err := update(ctx, "TREATMENT1", sampleArgs()); !errors.As(err, &denied) {
+		t.Errorf("UpdateTreatment by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestPatchTreatment(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	chaincodetest.WithClaims(ctx, nil)
+	before, _ := contract.ReadTreatment(ctx, "TREATMENT1")
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.PatchTreatment(ctx, "TREATMENT1", `{"releaseDate": "2023-10-07", "billingAmount": {"amount": 75000, "currency": "INR"}}`, 1); err != nil {
+		t.Fatal(err)
+	}
+	want := *before
+	want.ReleaseDate = "2023-10-07"
+	want.BillingAmount.Amount = 75000
+	treatment, err := contract.ReadTreatment(ctx, "TREATMENT1")
+	if err != nil || treatment.Version != 2 || treatment.LastModifiedTxID != ctx.Stub.TxID {
+		t.Fatalf("ReadTreatment after patch = %+v, %v, want version 2", treatment, err)
+	}
+	want.Metadata = treatment.Metadata
+	if *treatment != want {
+		t.Errorf("ReadTreatment after patch = %+v, %v", treatment, err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventTreatmentUpdated {
+		t.Errorf("event = %+v", event)
+	}
+
+	tests := []struct {
+		treatmentID string
+		patch       string
+		code        errs.Code
+	}{
+		{"TREATMENT9", `{"releaseDate": "2023-10-07"}`, errs.NotFound},
+		{"TREATMENT1", `{"admissionDate": "2023-11-01"}`, errs.ValidationFailed},
+		{"TREATMENT1", `{"hospitalName": null}`, errs.ValidationFailed},
+		{"TREATMENT1", `{"ward": "B"}`, errs.ValidationFailed},
+		{"TREATMENT1", `{"doctorName": "Dr. Jones"}`, errs.ValidationFailed}, // clinical details go in the transient map
+		{"TREATMENT1", ``, errs.ValidationFailed},
+		{"TREATMENT1", `"releaseDate"`, errs.ValidationFailed},
+		{"TREATMENT1", `{"lastModifiedBy": "someone else"}`, errs.ValidationFailed},
+	}
+	for _, tt := range tests {
+		if err := contract.PatchTreatment(ctx, tt.treatmentID, tt.patch, 0); errs.From(err).Code != tt.code {
+			t.Errorf("PatchTreatment(%s, %s) = %v, want %s", tt.treatmentID, tt.patch, err, tt.code)
+		}
+	}
+	if err := contract.PatchTreatment(ctx, "TREATMENT1", `{"releaseDate": "2023-10-08"}`, 1); errs.From(err).Code != errs.Conflict {
+		t.Errorf("PatchTreatment of version 1 = %v, want CONFLICT", err)
+	}
+
+	// Clinical details are patched through the transient map
+	ctx = ctx.Next(chaincodetest.Hospital)
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: []byte(`{"roomNumber": "102"}`)}
+	if err := contract.PatchTreatment(ctx, "TREATMENT1", "", 2); err != nil {
+		t.Fatal(err)
+	}
+	treatment, err = contract.ReadTreatment(ctx, "TREATMENT1")
+	if err != nil || treatment.RoomNumber != "102" || treatment.Medication != "Paracetamol" || treatment.ReleaseDate != "2023-10-07" || treatment.Version != 3 {
+		t.Errorf("ReadTreatment after patching the details = %+v, %v", treatment, err)
+	}
+	for _, detailsPatch := range []string{`{"doctorName": ""}`, `{"doctorName": null}`, `{"releaseDate": "2023-10-08"}`} {
+		ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: []byte(detailsPatch)}
+		if err := contract.PatchTreatment(ctx, "TREATMENT1", "", 0); errs.From(err).Code != errs.ValidationFailed {
+			t.Errorf("PatchTreatment of the details with %s = %v, want %s", detailsPatch, err, errs.ValidationFailed)
+		}
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.TPAMSP)
+	var denied *errs.PermissionError
+	if err := contract.PatchTreatment(ctx, "TREATMENT1", `{"releaseDate": "2023-10-08"}`, 0); !errors.As(err, &denied) {
+		t.Errorf("PatchTreatment by the TPA = %v, want a PermissionError", err)
+	}
+}
+
+func TestUpdateTreatmentWithDecidedClaims(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	chaincodetest.WithClaims(ctx, map[string]string{"CLAIM1": "Rejected", "CLAIM2": "Approved"})
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	a := sampleArgs()
+	a.billingAmount = "INR 750"
+	if err := update(ctx, "TREATMENT1", a); errs.From(err).Code != errs.InvalidState {
+		t.Errorf("UpdateTreatment of the billing amount = %v, want %s", err, errs.InvalidState)
+	}
+	for _, patchJSON := range []string{`{"patientID": "PATIENT2"}`, `{"billingAmount": 750}`} {
+		if err := contract.PatchTreatment(ctx, "TREATMENT1", patchJSON, 0); errs.From(err).Code != errs.InvalidState {
+			t.Errorf("PatchTreatment(%s) = %v, want %s", patchJSON, err, errs.InvalidState)
+		}
+	}
+
+	// What was not paid for may still change
+	if err := contract.PatchTreatment(ctx, "TREATMENT1", `{"releaseDate": "2023-10-07"}`, 0); err != nil {
+		t.Errorf("PatchTreatment of the release date = %v", err)
+	}
+
+	chaincodetest.WithClaims(ctx, map[string]string{"CLAIM1": "Rejected"})
+	if err := update(ctx, "TREATMENT1", a); err != nil {
+		t.Errorf("UpdateTreatment of the billing amount with only a rejected claim = %v", err)
+	}
+}
+
+func TestReadTreatmentMissing(t *testing.T) {
+	var notFound *errs.NotFoundError
+	_, err := new(TreatmentContract).ReadTreatment(chaincodetest.NewContext(access.InsuranceMSP), "TREATMENT9")
+	if !errors.As(err, &notFound) || errs.From(err).Message != "treatment with ID TREATMENT9 does not exist" {
+		t.Errorf("ReadTreatment of a missing treatment = %v", err)
+	}
+}
+
+func TestDeleteTreatment(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	chaincodetest.WithClaims(ctx, map[string]string{"CLAIM1": "Closed"})
+
+	ctx = ctx.Next(chaincodetest.NewClient(access.InsuranceMSP))
+	var denied *errs.PermissionError
+	if err := contract.DeleteTreatment(ctx, "TREATMENT1", "entered twice"); !errors.As(err, &denied) {
+		t.Errorf("DeleteTreatment by the insurer = %v, want a PermissionError", err)
+	}
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.DeleteTreatment(ctx, "TREATMENT1", ""); err == nil || errs.From(err).Code != errs.ValidationFailed {
+		t.Errorf("DeleteTreatment without a reason = %v, want %s", err, errs.ValidationFailed)
+	}
+	if err := contract.DeleteTreatment(ctx, "TREATMENT1", "entered twice"); err != nil {
+		t.Fatal(err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventTreatmentDeleted {
+		t.Errorf("event = %+v", event)
+	}
+
+	// The treatment is hidden, but kept along with its clinical details
+	var notFound *errs.NotFoundError
+	if _, err := contract.ReadTreatment(ctx, "TREATMENT1"); !errors.As(err, &notFound) {
+		t.Errorf("ReadTreatment of a deleted treatment = %v, want a NotFoundError", err)
+	}
+	if exists, _ := contract.TreatmentExists(ctx, "TREATMENT1"); !exists {
+		t.Error("deleted TREATMENT1 no longer exists")
+	}
+	if treatments, err := contract.GetAllTreatments(ctx); err != nil || len(treatments) != 0 {
+		t.Errorf("GetAllTreatments = %v, %v; want no treatments", treatments, err)
+	}
+	deleted, err := contract.GetDeletedTreatments(ctx)
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("GetDeletedTreatments = %v, %v", deleted, err)
+	}
+	if d := deleted[0]; !d.Deleted || d.DeletedReason != "entered twice" || d.DeletedBy != chaincodetest.Hospital.ID {
+		t.Errorf("deleted treatment = %+v", d.Metadata)
+	}
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: detailsJSON(sampleArgs())}
+	if match, err := contract.VerifyTreatmentHash(ctx, "TREATMENT1"); err != nil || !match {
+		t.Errorf("VerifyTreatmentHash of the deleted treatment's details = %v, %v; want true", match, err)
+	}
+
+	if err := contract.DeleteTreatment(ctx, "TREATMENT1", "entered twice"); !errors.As(err, &notFound) {
+		t.Errorf("DeleteTreatment of a deleted treatment = %v, want a NotFoundError", err)
+	}
+}
+
+func TestDeleteTreatmentWithOpenClaims(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	chaincodetest.WithClaims(ctx, map[string]string{"CLAIM1": "Closed", "CLAIM2": "UnderReview"})
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	err := contract.DeleteTreatment(ctx, "TREATMENT1", "entered twice")
+	var inUse *errs.InUseError
+	if !errors.As(err, &inUse) || errs.From(err).Code != errs.InvalidState || len(inUse.DependentIDs) != 1 || inUse.DependentIDs[0] != "CLAIM2" {
+		t.Errorf("DeleteTreatment with an open claim = %v, want an InUseError naming CLAIM2", err)
+	}
+	if _, err := contract.ReadTreatment(ctx, "TREATMENT1"); err != nil {
+		t.Errorf("ReadTreatment after a refused delete = %v", err)
+	}
+
+	delete(ctx.Stub.Chaincodes, invoke.ClaimChaincode)
+	if err := contract.DeleteTreatment(ctx, "TREATMENT1", "entered twice"); err == nil {
+		t.Error("DeleteTreatment succeeded although the claims could not be checked")
+	}
+}
+
+func TestRestoreTreatment(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	chaincodetest.WithClaims(ctx, nil)
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.RestoreTreatment(ctx, "TREATMENT1"); err == nil || errs.From(err).Code != errs.InvalidState {
+		t.Errorf("RestoreTreatment of a treatment that is not deleted = %v, want %s", err, errs.InvalidState)
+	}
+	if err := contract.DeleteTreatment(ctx, "TREATMENT1", "entered twice"); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := contract.RestoreTreatment(ctx, "TREATMENT1"); err != nil {
+		t.Fatal(err)
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventTreatmentRestored {
+		t.Errorf("event = %+v", event)
+	}
+
+	treatment, err := contract.ReadTreatment(ctx, "TREATMENT1")
+	if err != nil || treatment.Deleted || treatment.Version != 3 {
+		t.Fatalf("ReadTreatment of the restored treatment = %+v, %v", treatment, err)
+	}
+	candidateJSON, _ := json.Marshal(treatment)
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: candidateJSON}
+	if match, err := contract.VerifyTreatmentHash(ctx, "TREATMENT1"); err != nil || !match {
+		t.Errorf("VerifyTreatmentHash of the restored record = %v, %v; want true", match, err)
+	}
+}
+
+func TestPurgeTreatment(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	chaincodetest.WithClaims(ctx, nil)
+
+	ctx = ctx.Next(chaincodetest.HospitalAdmin)
+	if err := contract.PurgeTreatment(ctx, "TREATMENT1"); err == nil || errs.From(err).Code != errs.InvalidState {
+		t.Errorf("PurgeTreatment of a treatment that is not deleted = %v, want %s", err, errs.InvalidState)
+	}
+	if err := contract.DeleteTreatment(ctx, "TREATMENT1", "test data"); err != nil {
+		t.Fatal(err)
+	}
+
+	var denied *errs.PermissionError
+	ctx.Client = chaincodetest.Hospital
+	if err := contract.PurgeTreatment(ctx, "TREATMENT1"); !errors.As(err, &denied) {
+		t.Errorf("PurgeTreatment by a hospital without the admin role = %v, want a PermissionError", err)
+	}
+
+	// A closed claim may still refer to the deleted treatment
+	ctx.Client = chaincodetest.HospitalAdmin
+	chaincodetest.WithClaims(ctx, map[string]string{"CLAIM1": "Closed"})
+	var inUse *errs.InUseError
+	if err := contract.PurgeTreatment(ctx, "TREATMENT1"); !errors.As(err, &inUse) {
+		t.Errorf("PurgeTreatment with a closed claim = %v, want an InUseError", err)
+	}
+	chaincodetest.WithClaims(ctx, nil)
+	if err := contract.PurgeTreatment(ctx, "TREATMENT1"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := contract.TreatmentExists(ctx, "TREATMENT1"); exists {
+		t.Error("TREATMENT1 still exists")
+	}
+	key, _ := treatmentRepository.Key(ctx, "TREATMENT1")
+	if private, _ := ctx.Stub.GetPrivateData(treatmentCollection, key); private != nil {
+		t.Error("the private copy of TREATMENT1 still exists")
+	}
+	if event := chaincodetest.LastEvent(t, ctx); event.EventType != EventTreatmentPurged {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestVerifyTreatmentHash(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	treatment, _ := contract.ReadTreatment(ctx, "TREATMENT1")
+
+	ctx = ctx.Next(chaincodetest.NewClient(access.TPAMSP))
+	candidateJSON, _ := json.MarshalIndent(treatment, "", "  ")
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: candidateJSON}
+	match, err := contract.VerifyTreatmentHash(ctx, "TREATMENT1")
+	if err != nil || !match {
+		t.Errorf("VerifyTreatmentHash of the committed record = %v, %v; want true", match, err)
+	}
+
+	// Only the clinical details are hashed; the public fields are read with ReadTreatmentRecord
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: detailsJSON(sampleArgs())}
+	match, err = contract.VerifyTreatmentHash(ctx, "TREATMENT1")
+	if err != nil || !match {
+		t.Errorf("VerifyTreatmentHash of the committed details = %v, %v; want true", match, err)
+	}
+
+	treatment.Medication = "Ibuprofen"
+	candidateJSON, _ = json.Marshal(treatment)
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: candidateJSON}
+	match, err = contract.VerifyTreatmentHash(ctx, "TREATMENT1")
+	if err != nil || match {
+		t.Errorf("VerifyTreatmentHash of changed details = %v, %v; want false", match, err)
+	}
+
+	if _, err := contract.VerifyTreatmentHash(ctx, "TREATMENT9"); err == nil || errs.From(err).Code != errs.NotFound {
+		t.Errorf("VerifyTreatmentHash of a missing treatment = %v, want NOT_FOUND", err)
+	}
+
+	ctx.Stub.TransientMap = map[string][]byte{transientTreatmentKey: []byte("not json")}
+	if _, err := contract.VerifyTreatmentHash(ctx, "TREATMENT1"); err == nil || errs.From(err).Code != errs.ValidationFailed {
+		t.Errorf("VerifyTreatmentHash of malformed JSON = %v, want VALIDATION_FAILED", err)
+	}
+
+	ctx.Stub.TransientMap = nil
+	if _, err := contract.VerifyTreatmentHash(ctx, "TREATMENT1"); err == nil || errs.From(err).Code != errs.ValidationFailed {
+		t.Errorf("VerifyTreatmentHash without transient data = %v, want VALIDATION_FAILED", err)
+	}
+}
+
+func TestGetAllTreatments(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := chaincodetest.NewContext(access.HealthcareMSP)
+	if err := contract.InitLedger(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx = createTreatment(t, ctx, "TREATMENT3", sampleArgs())
+
+	treatments, err := contract.GetAllTreatments(ctx)
+	if err != nil || len(treatments) != 3 {
+		t.Fatalf("GetAllTreatments = %d treatments, %v; want 3", len(treatments), err)
+	}
+
+	page, err := contract.GetAllTreatmentsWithPagination(ctx, 2, "")
+	if err != nil || page.FetchedRecordsCount != 2 || page.Bookmark == "" {
+		t.Fatalf("first page = %+v, %v", page, err)
+	}
+	page, err = contract.GetAllTreatmentsWithPagination(ctx, 2, page.Bookmark)
+	if err != nil || page.FetchedRecordsCount != 1 || page.Bookmark != "" {
+		t.Fatalf("second page = %+v, %v", page, err)
+	}
+
+	if _, err := contract.GetAllTreatmentsWithPagination(ctx, -1, ""); err == nil {
+		t.Error("GetAllTreatmentsWithPagination with a negative page size succeeded")
+	}
+}
+
+func TestInitLedger(t *testing.T) {
+	var denied *errs.PermissionError
+	if err := new(TreatmentContract).InitLedger(chaincodetest.NewContext(access.TPAMSP)); !errors.As(err, &denied) {
+		t.Errorf("InitLedger by the TPA = %v, want a PermissionError", err)
+	}
+
+	ctx := chaincodetest.NewContext(access.HealthcareMSP)
+	if err := new(TreatmentContract).InitLedger(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, treatmentID := range []string{"TREATMENT1", "TREATMENT2"} {
+		treatment, err := new(TreatmentContract).ReadTreatment(ctx, treatmentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v validation.Validator
+		validateTreatment(&v, treatment)
+		if err := v.Err(); err != nil {
+			t.Errorf("sample treatment %s is invalid: %v", treatmentID, err)
+		}
+	}
+}
+
+func TestGetTreatmentHistory(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := createTreatment(t, chaincodetest.NewContext(access.HealthcareMSP), "TREATMENT1", sampleArgs())
+	a := sampleArgs()
+	a.releaseDate = "2023-10-07"
+	ctx = ctx.Next(chaincodetest.Hospital)
+	if err := update(ctx, "TREATMENT1", a); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := contract.GetTreatmentHistory(ctx, "TREATMENT1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Record.ReleaseDate != "2023-10-07" || history[0].TxID != ctx.Stub.TxID ||
+		history[1].Record.ReleaseDate != "2023-10-05" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	contract := new(TreatmentContract)
+	ctx := chaincodetest.NewContext(access.HealthcareMSP)
+
+	// A treatment as stored before composite keys and Money
+	legacy := `{"medicalCondition":"Fever","hospitalName":"City Hospital","patientID":"PATIENT1",` +
+		`"admissionDate":"2023-10-01","releaseDate":"2023-10-05","billingAmount":500.5,"doctorName":"Dr. Smith"}`
+	if err := ctx.Stub.PutState("TREATMENT1", []byte(legacy)); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := contract.MigrateKeys(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateKeys = %d, %v; want 1", migrated, err)
+	}
+	migrated, err = contract.MigrateMoney(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateMoney = %d, %v; want 1", migrated, err)
+	}
+	migrated, err = contract.MigrateMoney(ctx)
+	if err != nil || migrated != 0 {
+		t.Errorf("second MigrateMoney = %d, %v; want 0", migrated, err)
+	}
+
+	key, _ := treatmentRepository.Key(ctx, "TREATMENT1")
+	stored, _ := ctx.Stub.GetState(key)
+	if legacy, _ := money.HasLegacyAmount(stored, "billingAmount"); legacy {
+		t.Errorf("billing amount still stored as a number: %s", stored)
+	}
+	treatment, err := contract.ReadTreatment(ctx, "TREATMENT1")
+	if err != nil || treatment.BillingAmount != (money.Money{Amount: 50050, Currency: "INR"}) || treatment.MedicalCondition != "Fever" {
+		t.Errorf("ReadTreatment after migration = %+v, %v", treatment, err)
+	}
+
+	// A treatment as stored before its clinical details moved to the private collection:
+	// in full in the world state, with a copy including the metadata in the collection
+	full := `{"medicalCondition":"Fracture","hospitalName":"General Hospital","roomNumber":"202","admissionType":"Inpatient",` +
+		`"medication":"Painkillers","patientID":"PATIENT2","admissionDate":"2023-09-15","releaseDate":"2023-09-25",` +
+		`"billingAmount":{"amount":120075,"currency":"INR"},"doctorName":"Dr. Johnson","version":1}`
+	key2, _ := treatmentRepository.Key(ctx, "TREATMENT2")
+	ctx.Stub.PutState(key2, []byte(full))
+	ctx.Stub.PutPrivateData(treatmentCollection, key2, []byte(full))
+
+	ctx = ctx.Next(chaincodetest.Hospital)
+	migrated, err = contract.MigratePrivateData(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigratePrivateData = %d, %v; want 1", migrated, err)
+	}
+	if public, _ := ctx.Stub.GetState(key2); strings.Contains(string(public), "Fracture") {
+		t.Errorf("public record after migration = %s", public)
+	}
+	private, _ := ctx.Stub.GetPrivateData(treatmentCollection, key2)
+	if strings.Contains(string(private), "version") || !strings.Contains(string(private), "Fracture") {
+		t.Errorf("private details after migration = %s", private)
+	}
+	treatment, err = contract.ReadTreatment(ctx, "TREATMENT2")
+	if err != nil || treatment.DoctorName != "Dr. Johnson" || treatment.BillingAmount.Amount != 120075 || treatment.Version != 2 {
+		t.Errorf("ReadTreatment after migration = %+v, %v", treatment, err)
+	}
+	if migrated, err := contract.MigratePrivateData(ctx); err != nil || migrated != 0 {
+		t.Errorf("second MigratePrivateData = %d, %v; want 0", migrated, err)
+	}
+
+	ctx.Client = chaincodetest.NewClient(access.InsuranceMSP)
+	var denied *errs.PermissionError
+	if _, err := contract.MigrateKeys(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigrateKeys by the insurer = %v, want a PermissionError", err)
+	}
+	if _, err := contract.MigrateMoney(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigrateMoney by the insurer = %v, want a PermissionError", err)
+	}
+	if _, err := contract.MigratePrivateData(ctx); !errors.As(err, &denied) {
+		t.Errorf("MigratePrivateData by the insurer = %v, want a PermissionError", err)
+	}
+}
@@ -2,6 +2,13 @@ import React, { useState, useEffect } from 'react';
 import axios from 'axios';
 import './App.css';
 
+// The chaincode keeps amounts as {amount, currency} in minor units (paise for INR)
+const formatMoney = ({ amount, currency }) => {
+  const sign = amount < 0 ? '-' : '';
+  const minor = Math.abs(amount);
+  return `${currency} ${sign}${Math.floor(minor / 100)}.${String(minor % 100).padStart(2, '0')}`;
+};
+
 function App() {
   const [claims, setClaims] = useState([]);
   const [selectedClaim, setSelectedClaim] = useState(null);
@@ -23,12 +30,10 @@ function App() {
     }
   };
 
-  const updateClaimStatus = async (claimID, newStatus) => {
+  // action is one of the insurer's claim transitions: review, approve, reject
+  const updateClaimStatus = async (claimID, action) => {
     try {
-      await axios.put(`http://localhost:3002/claims/${claimID}`, {
-        ...selectedClaim,
-        status: newStatus
-      });
+      await axios.post(`http://localhost:3003/claims/${claimID}/${action}`);
       fetchClaims();
       setSelectedClaim(null);
     } catch (error) {
@@ -88,7 +93,8 @@ function App() {
         patientID: treatmentDetails.patientID,
         admissionDate: treatmentDetails.admissionDate,
         releaseDate: treatmentDetails.releaseDate,
-        billingAmount: treatmentDetails.billingAmount,
+        // The model was trained on amounts in rupees
+        billingAmount: treatmentDetails.billingAmount.amount / 100,
         doctorName: treatmentDetails.doctorName
       }
     };
@@ -143,12 +149,17 @@ function App() {
                   <button onClick={() => setSelectedClaim(claim)}>
                     View Details
                   </button>
-                  {claim.status === 'PENDING' && (
+                  {claim.status === 'Submitted' && (
+                    <button onClick={() => updateClaimStatus(claim.claimID, 'review')}>
+                      Start Review
+                    </button>
+                  )}
+                  {claim.status === 'UnderReview' && (
                     <>
-                      <button className="approve" onClick={() => updateClaimStatus(claim.claimID, 'APPROVED')}>
+                      <button className="approve" onClick={() => updateClaimStatus(claim.claimID, 'approve')}>
                         Approve
                       </button>
-                      <button className="reject" onClick={() => updateClaimStatus(claim.claimID, 'REJECTED')}>
+                      <button className="reject" onClick={() => updateClaimStatus(claim.claimID, 'reject')}>
                         Reject
                       </button>
                     </>
@@ -201,7 +212,7 @@ function App() {
 
                   <div className="detail-group">
                     <h4>Billing Information</h4>
-                    <p><strong>Total Amount:</strong> ₹{treatmentDetails.billingAmount.toFixed(2)}</p>
+                    <p><strong>Total Amount:</strong> {formatMoney(treatmentDetails.billingAmount)}</p>
                   </div>
                 </div>
               )}
@@ -9,8 +9,7 @@ function InsuranceClaimApp() {
     treatmentID: '',
     patientID: '',
     aadharNumber: '',
-    insuranceNumber: '',
-    status: 'Pending'
+    insuranceNumber: ''
   });
   const [generatedClaimId, setGeneratedClaimId] = useState('');
   const [message, setMessage] = useState('');
@@ -44,8 +43,7 @@ function InsuranceClaimApp() {
         
         await axios.post('http://localhost:3002/claims', {
             ...formData,
-            claimID,  // Add generated claim ID to payload
-            status: 'Pending'
+            claimID  // Add generated claim ID to payload
         });
 
         showMessage(`Claim submitted successfully! Your Claim ID: ${claimID}`);
@@ -62,8 +60,7 @@ function InsuranceClaimApp() {
       treatmentID: '',
       patientID: '',
       aadharNumber: '',
-      insuranceNumber: '',
-      status: 'Pending'
+      insuranceNumber: ''
     });
   };
 
@@ -83,12 +80,12 @@ function InsuranceClaimApp() {
             <label>Status:</label>
             <input
               type="text"
-              value="Pending"
+              value="Submitted"
               readOnly
               className="status-disabled"
             />
             <small className="status-note">
-              All new claims are submitted as Pending
+              All new claims start as Submitted
             </small>
           </div>
         </div>
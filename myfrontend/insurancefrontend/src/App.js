@@ -3,14 +3,24 @@ import React, { useState, useEffect } from 'react';
 import axios from 'axios';
 import './App.css';
 
+// The chaincode keeps amounts as {amount, currency} in minor units (paise for INR), and
+// takes them back as decimal strings such as "500.50"
+const toDecimal = ({ amount }) => {
+  const sign = amount < 0 ? '-' : '';
+  const minor = Math.abs(amount);
+  return `${sign}${Math.floor(minor / 100)}.${String(minor % 100).padStart(2, '0')}`;
+};
+
+const formatMoney = (money) => `${money.currency} ${toDecimal(money)}`;
+
 function App() {
   const [insurances, setInsurances] = useState([]);
   const [formData, setFormData] = useState({
     name: '',
     aadharNumber: '',
+    dob: '',
     startDate: '',
     endDate: '',
-    age: '',
     claimLimit: '',
     alreadyClaimed: ''
   });
@@ -56,18 +66,29 @@ function App() {
   };
 
   const handleEdit = (insurance) => {
-    setFormData(insurance);
+    setFormData({
+      ...insurance,
+      claimLimit: toDecimal(insurance.claimLimit),
+      alreadyClaimed: toDecimal(insurance.alreadyClaimed)
+    });
     setEditingId(insurance.insuranceNumber);
   };
 
+  // Policies are soft deleted, and the ledger records why
   const handleDelete = async (id) => {
-    if (window.confirm('Are you sure you want to delete this insurance?')) {
-      try {
-        await axios.delete(`http://localhost:3003/insurances/${id}`);
-        fetchInsurances();
-      } catch (error) {
-        alert('Error deleting insurance: ' + error.message);
-      }
+    const reason = window.prompt('Why is this insurance being deleted?');
+    if (reason === null) {
+      return;
+    }
+    if (!reason.trim()) {
+      alert('A reason is required to delete an insurance');
+      return;
+    }
+    try {
+      await axios.delete(`http://localhost:3003/insurances/${id}`, { params: { reason: reason.trim() } });
+      fetchInsurances();
+    } catch (error) {
+      alert('Error deleting insurance: ' + (error.response?.data || error.message));
     }
   };
 
@@ -75,9 +96,9 @@ function App() {
     setFormData({
       name: '',
       aadharNumber: '',
+      dob: '',
       startDate: '',
       endDate: '',
-      age: '',
       claimLimit: '',
       alreadyClaimed: ''
     });
@@ -135,11 +156,11 @@ function App() {
 
         <div className="form-row">
           <div className="form-group">
-            <label>Age:</label>
+            <label>Date of Birth:</label>
             <input
-              type="number"
-              value={formData.age}
-              onChange={(e) => setFormData({...formData, age: e.target.value})}
+              type="date"
+              value={formData.dob}
+              onChange={(e) => setFormData({...formData, dob: e.target.value})}
               required
             />
           </div>
@@ -148,6 +169,7 @@ function App() {
             <label>Claim Limit:</label>
             <input
               type="number"
+              step="0.01"
               value={formData.claimLimit}
               onChange={(e) => setFormData({...formData, claimLimit: e.target.value})}
               required
@@ -155,15 +177,18 @@ function App() {
           </div>
         </div>
 
-        <div className="form-group">
-          <label>Already Claimed:</label>
-          <input
-            type="text"
-            value={formData.alreadyClaimed}
-            onChange={(e) => setFormData({...formData, alreadyClaimed: e.target.value})}
-            required
-          />
-        </div>
+        {/* Once a policy exists, only approved claims change the claimed amount */}
+        {!editingId && (
+          <div className="form-group">
+            <label>Already Claimed:</label>
+            <input
+              type="text"
+              value={formData.alreadyClaimed}
+              onChange={(e) => setFormData({...formData, alreadyClaimed: e.target.value})}
+              required
+            />
+          </div>
+        )}
 
         <div className="form-actions">
           <button type="submit">{editingId ? 'Update' : 'Create'}</button>
@@ -183,6 +208,7 @@ function App() {
                 <p>Insurance ID: {insurance.insuranceNumber}</p>
                 <p>Aadhar: {insurance.aadharNumber}</p>
                 <p>Dates: {new Date(insurance.startDate).toLocaleDateString()} - {new Date(insurance.endDate).toLocaleDateString()}</p>
+                <p>Claimed: {formatMoney(insurance.alreadyClaimed)} of {formatMoney(insurance.claimLimit)}</p>
               </div>
               <div className="insurance-actions">
                 <button onClick={() => handleEdit(insurance)}>Edit</button>
@@ -76,10 +76,10 @@ function App() {
     const treatmentID = `TREATMENT${Date.now()}`;
 
     try {
+      // The amount goes to the chaincode as typed, e.g. "500.50", so no float rounding creeps in
       const response = await axios.post('http://localhost:3001/treatments', {
         ...treatmentDetails,
-        treatmentID,
-        billingAmount: parseFloat(treatmentDetails.billingAmount)
+        treatmentID
       });
 
       setMessage(`Success! Treatment Record Created with ID: ${treatmentID}`);